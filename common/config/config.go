@@ -100,6 +100,11 @@ var PreConsumedQuota int64 = 500
 var ApproximateTokenEnabled = false
 var RetryTimes = 0
 
+// StickySessionMode routes the requests of a session to the channel and key that served it before, so that
+// the prompt cache of the provider is hit. It is one of user, token or prefix, and empty disables it.
+var StickySessionMode = ""
+var StickySessionTTL = 3600 // unit is second
+
 var RootUserEmail = ""
 
 var IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
@@ -162,5 +167,30 @@ var RelayProxy = env.String("RELAY_PROXY", "")
 var UserContentRequestProxy = env.String("USER_CONTENT_REQUEST_PROXY", "")
 var UserContentRequestTimeout = env.Int("USER_CONTENT_REQUEST_TIMEOUT", 30)
 
+// files uploaded through /v1/files
+var FileStorageType = env.String("FILE_STORAGE_TYPE", "local")
+var FileStoragePath = env.String("FILE_STORAGE_PATH", "files")
+var FileMaxSize = env.Int("FILE_MAX_SIZE", 512) // unit is MB
+
+// batches created through /v1/batches
+var BatchRatio = 0.5
+var BatchWorkerCount = env.Int("BATCH_WORKER_COUNT", 8)
+var BatchChannelRateLimit = env.Int("BATCH_CHANNEL_RATE_LIMIT", 0) // requests per minute of each channel, 0 means unlimited
+var BatchMaxRequests = env.Int("BATCH_MAX_REQUESTS", 50000)
+
 var EnforceIncludeUsage = env.Bool("ENFORCE_INCLUDE_USAGE", false)
 var TestPrompt = env.String("TEST_PROMPT", "Output only your specific model name with no additional text.")
+
+var AbilityProbeFrequency = env.Int("ABILITY_PROBE_FREQUENCY", 10) // unit is minute, the auto-disabled models of the channels are tested again, 0 disables it
+
+// recovery of the auto-disabled channels, the interval between two probes of a channel doubles after each failure
+var ChannelRecoveryInterval = env.Int("CHANNEL_RECOVERY_INTERVAL", 60)          // unit is second, 0 disables it
+var ChannelRecoveryMaxInterval = env.Int("CHANNEL_RECOVERY_MAX_INTERVAL", 3600) // unit is second
+var ChannelProbeHistorySize = env.Int("CHANNEL_PROBE_HISTORY_SIZE", 50)         // probes kept for each channel
+
+// circuit breaker of each channel and model
+var CircuitBreakerFailureThreshold = env.Int("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5) // consecutive failures opening the circuit, 0 disables it
+var CircuitBreakerCooldown = env.Int("CIRCUIT_BREAKER_COOLDOWN", 60)                 // unit is second
+
+// origins of the web pages allowed to open realtime sessions besides the ones served by this server, comma separated
+var RealtimeAllowedOrigins = env.String("REALTIME_ALLOWED_ORIGINS", "")
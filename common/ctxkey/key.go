@@ -21,4 +21,9 @@ const (
 	AvailableModels   = "available_models"
 	KeyRequestBody    = "key_request_body"
 	SystemPrompt      = "system_prompt"
+	RerankSearchUnits = "rerank_search_units"
+	KeyFingerprint    = "key_fingerprint" // the key of a multi-key channel used by the request
+	FallbackFrom      = "fallback_from"   // the requested model when a fallback model serves the request
+	StickySessionKey  = "sticky_session_key"
+	StickySession     = "sticky_session" // the *model.StickySession found for the request
 )
@@ -121,6 +121,32 @@ func GetRequestID(ctx context.Context) string {
 	return rawRequestId.(string)
 }
 
+// SetBatchID marks the requests executed for a batch, it is only set in process so clients can not forge it
+func SetBatchID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, BatchIdKey, id)
+}
+
+func GetBatchID(ctx context.Context) string {
+	rawBatchId := ctx.Value(BatchIdKey)
+	if rawBatchId == nil {
+		return ""
+	}
+	return rawBatchId.(string)
+}
+
+// SetFallbackFrom marks a request served by a fallback model, with the model that was requested
+func SetFallbackFrom(ctx context.Context, modelName string) context.Context {
+	return context.WithValue(ctx, fallbackFromKey, modelName)
+}
+
+func GetFallbackFrom(ctx context.Context) string {
+	rawModelName := ctx.Value(fallbackFromKey)
+	if rawModelName == nil {
+		return ""
+	}
+	return rawModelName.(string)
+}
+
 func GetResponseID(c *gin.Context) string {
 	logID := c.GetString(RequestIdKey)
 	return fmt.Sprintf("chatcmpl-%s", logID)
@@ -2,4 +2,8 @@ package helper
 
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
+	BatchIdKey   = "X-Oneapi-Batch-Id"
+	// FallbackModelKey is the response header carrying the model that answered in place of the requested one
+	FallbackModelKey = "X-Oneapi-Fallback-Model"
+	fallbackFromKey  = "fallback_from"
 )
@@ -0,0 +1,30 @@
+package network
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// IsOriginAllowed tells whether the web page that sent the request may use it. The requests without an origin
+// don't come from a browser, the others must come from a page served by this server or from one of
+// config.RealtimeAllowedOrigins.
+func IsOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range strings.Split(config.RealtimeAllowedOrigins, ",") {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "*" || (allowed != "" && strings.EqualFold(allowed, origin)) {
+			return true
+		}
+	}
+	return false
+}
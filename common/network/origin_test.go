@@ -0,0 +1,29 @@
+package network
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestIsOriginAllowed(t *testing.T) {
+	newRequest := func(origin string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, "http://api.example.com/v1/realtime", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+	Convey("TestIsOriginAllowed", t, func() {
+		config.RealtimeAllowedOrigins = "https://app.example.com/, http://localhost:5173"
+		defer func() { config.RealtimeAllowedOrigins = "" }()
+		So(IsOriginAllowed(newRequest("")), ShouldBeTrue)
+		So(IsOriginAllowed(newRequest("https://api.example.com")), ShouldBeTrue)
+		So(IsOriginAllowed(newRequest("https://app.example.com")), ShouldBeTrue)
+		So(IsOriginAllowed(newRequest("http://localhost:5173")), ShouldBeTrue)
+		So(IsOriginAllowed(newRequest("https://evil.example.net")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage keeps files in a directory of the local disk.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+func (s *LocalStorage) Save(key string, reader io.Reader) (int64, error) {
+	// write to a temporary file first, so that a failed upload never leaves a partial file behind
+	file, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	size, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, os.Rename(file.Name(), s.path(key))
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
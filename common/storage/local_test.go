@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorage(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	size, err := storage.Save("file-1", strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+
+	reader, err := storage.Open("file-1")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	assert.Equal(t, "hello", string(data))
+
+	// keys never escape the storage directory
+	reader, err = storage.Open("../file-1")
+	assert.NoError(t, err)
+	_ = reader.Close()
+
+	assert.NoError(t, storage.Delete("file-1"))
+	assert.NoError(t, storage.Delete("file-1"))
+	_, err = storage.Open("file-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var groupQuotaLock sync.RWMutex
+
+// GroupQuota is the total size in bytes of the files a user of the group may keep,
+// groups that are not listed are not limited.
+var GroupQuota = map[string]int64{
+	"default": 1 << 30,
+	"vip":     1 << 30,
+	"svip":    1 << 30,
+}
+
+func GroupQuota2JSONString() string {
+	groupQuotaLock.RLock()
+	defer groupQuotaLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupQuota)
+	if err != nil {
+		logger.SysError("error marshalling group file quota: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupQuotaByJSONString(jsonStr string) error {
+	groupQuotaLock.Lock()
+	defer groupQuotaLock.Unlock()
+	GroupQuota = make(map[string]int64)
+	return json.Unmarshal([]byte(jsonStr), &GroupQuota)
+}
+
+// GetGroupQuota returns the file quota of the group, 0 means unlimited.
+func GetGroupQuota(group string) int64 {
+	groupQuotaLock.RLock()
+	defer groupQuotaLock.RUnlock()
+	return GroupQuota[group]
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// Storage keeps the content of the files uploaded through /v1/files.
+type Storage interface {
+	Save(key string, reader io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var factories = map[string]func() (Storage, error){
+	"local": func() (Storage, error) {
+		return NewLocalStorage(config.FileStoragePath)
+	},
+}
+
+var backend Storage
+
+// Register makes a storage backend available for FILE_STORAGE_TYPE, it must be called before Init.
+func Register(name string, factory func() (Storage, error)) {
+	factories[name] = factory
+}
+
+func Init() error {
+	factory, ok := factories[config.FileStorageType]
+	if !ok {
+		return fmt.Errorf("unknown file storage type: %s", config.FileStorageType)
+	}
+	storage, err := factory()
+	if err != nil {
+		return err
+	}
+	backend = storage
+	return nil
+}
+
+func Get() Storage {
+	return backend
+}
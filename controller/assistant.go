@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/assistants
+
+type OpenAIAssistant struct {
+	Id             string            `json:"id"`
+	Object         string            `json:"object"`
+	CreatedAt      int64             `json:"created_at"`
+	Name           *string           `json:"name"`
+	Description    *string           `json:"description"`
+	Model          string            `json:"model"`
+	Instructions   *string           `json:"instructions"`
+	Tools          []relaymodel.Tool `json:"tools"`
+	ToolResources  map[string]any    `json:"tool_resources"`
+	Metadata       map[string]string `json:"metadata"`
+	Temperature    *float64          `json:"temperature"`
+	TopP           *float64          `json:"top_p"`
+	ResponseFormat json.RawMessage   `json:"response_format"`
+}
+
+// assistantRequest is shared by the creation and the modification, the absent fields are left untouched
+type assistantRequest struct {
+	Model          *string            `json:"model"`
+	Name           *string            `json:"name"`
+	Description    *string            `json:"description"`
+	Instructions   *string            `json:"instructions"`
+	Tools          *[]relaymodel.Tool `json:"tools"`
+	ResponseFormat json.RawMessage    `json:"response_format"`
+	Temperature    *float64           `json:"temperature"`
+	TopP           *float64           `json:"top_p"`
+	Metadata       map[string]string  `json:"metadata"`
+}
+
+// newAssistantObjectId starts the ids with the creation time, so that the objects created
+// in the same second are still listed in their creation order
+func newAssistantObjectId(prefix string) string {
+	return fmt.Sprintf("%s%016x%s", prefix, time.Now().UnixNano(), random.GetRandomString(8))
+}
+
+func marshalMetadata(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+	jsonBytes, _ := json.Marshal(metadata)
+	return string(jsonBytes)
+}
+
+func unmarshalMetadata(metadata string) map[string]string {
+	result := make(map[string]string)
+	if metadata != "" {
+		_ = json.Unmarshal([]byte(metadata), &result)
+	}
+	return result
+}
+
+// marshalTools only accepts function tools, the hosted tools like code_interpreter are not available on the channels
+func marshalTools(tools []relaymodel.Tool) (string, error) {
+	if len(tools) == 0 {
+		return "", nil
+	}
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return "", fmt.Errorf("unsupported tool type: '%s', only function tools are supported", tool.Type)
+		}
+		if tool.Function.Name == "" {
+			return "", fmt.Errorf("the name of the function tool is required")
+		}
+	}
+	jsonBytes, err := json.Marshal(tools)
+	return string(jsonBytes), err
+}
+
+func unmarshalTools(tools string) []relaymodel.Tool {
+	result := make([]relaymodel.Tool, 0)
+	if tools != "" {
+		_ = json.Unmarshal([]byte(tools), &result)
+	}
+	return result
+}
+
+// marshalResponseFormat keeps the response format as sent, "auto" is the same as no format
+func marshalResponseFormat(responseFormat json.RawMessage) string {
+	if len(responseFormat) == 0 || string(responseFormat) == "null" || string(responseFormat) == `"auto"` {
+		return ""
+	}
+	return string(responseFormat)
+}
+
+func unmarshalResponseFormat(responseFormat string) json.RawMessage {
+	if responseFormat == "" {
+		return json.RawMessage(`"auto"`)
+	}
+	return json.RawMessage(responseFormat)
+}
+
+// getListParams parses the pagination of the assistants api, the lists are in descending order by default
+func getListParams(c *gin.Context) (limit int, after string, asc bool) {
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return limit, c.Query("after"), c.Query("order") == "asc"
+}
+
+// writeList writes a page fetched with limit+1 items in the list format of the openai api
+func writeList[T any](c *gin.Context, items []T, limit int, getId func(T) string) {
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     items,
+		"has_more": hasMore,
+	}
+	if len(items) > 0 {
+		response["first_id"] = getId(items[0])
+		response["last_id"] = getId(items[len(items)-1])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func toOpenAIAssistant(assistant *model.Assistant) OpenAIAssistant {
+	return OpenAIAssistant{
+		Id:             assistant.Id,
+		Object:         "assistant",
+		CreatedAt:      assistant.CreatedAt,
+		Name:           nullableString(assistant.Name),
+		Description:    nullableString(assistant.Description),
+		Model:          assistant.Model,
+		Instructions:   nullableString(assistant.Instructions),
+		Tools:          unmarshalTools(assistant.Tools),
+		ToolResources:  map[string]any{},
+		Metadata:       unmarshalMetadata(assistant.Metadata),
+		Temperature:    assistant.Temperature,
+		TopP:           assistant.TopP,
+		ResponseFormat: unmarshalResponseFormat(assistant.ResponseFormat),
+	}
+}
+
+// applyAssistantRequest copies the fields present in the request to the assistant
+func applyAssistantRequest(assistant *model.Assistant, request *assistantRequest) error {
+	if request.Model != nil {
+		assistant.Model = *request.Model
+	}
+	if request.Name != nil {
+		assistant.Name = *request.Name
+	}
+	if request.Description != nil {
+		assistant.Description = *request.Description
+	}
+	if request.Instructions != nil {
+		assistant.Instructions = *request.Instructions
+	}
+	if request.Tools != nil {
+		tools, err := marshalTools(*request.Tools)
+		if err != nil {
+			return err
+		}
+		assistant.Tools = tools
+	}
+	if request.ResponseFormat != nil {
+		assistant.ResponseFormat = marshalResponseFormat(request.ResponseFormat)
+	}
+	if request.Temperature != nil {
+		assistant.Temperature = request.Temperature
+	}
+	if request.TopP != nil {
+		assistant.TopP = request.TopP
+	}
+	if request.Metadata != nil {
+		assistant.Metadata = marshalMetadata(request.Metadata)
+	}
+	return nil
+}
+
+func getOwnedAssistant(c *gin.Context) (*model.Assistant, bool) {
+	assistantId := c.Param("id")
+	assistant, err := model.GetAssistantById(assistantId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No assistant found with id '%s'.", assistantId))
+		return nil, false
+	}
+	return assistant, true
+}
+
+func CreateAssistant(c *gin.Context) {
+	var request assistantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if request.Model == nil || *request.Model == "" {
+		openAIError(c, http.StatusBadRequest, "missing_required_parameter", "Missing required parameter: 'model'.")
+		return
+	}
+	assistant := &model.Assistant{
+		Id:      newAssistantObjectId("asst_"),
+		UserId:  c.GetInt(ctxkey.Id),
+		TokenId: c.GetInt(ctxkey.TokenId),
+	}
+	if err := applyAssistantRequest(assistant, &request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err := assistant.Insert(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "create_assistant_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIAssistant(assistant))
+}
+
+func ListAssistants(c *gin.Context) {
+	limit, after, asc := getListParams(c)
+	assistants, err := model.GetAssistants(c.GetInt(ctxkey.Id), after, limit+1, asc)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_assistants_failed", err.Error())
+		return
+	}
+	data := make([]OpenAIAssistant, 0, len(assistants))
+	for _, assistant := range assistants {
+		data = append(data, toOpenAIAssistant(assistant))
+	}
+	writeList(c, data, limit, func(assistant OpenAIAssistant) string { return assistant.Id })
+}
+
+func RetrieveAssistant(c *gin.Context) {
+	assistant, ok := getOwnedAssistant(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIAssistant(assistant))
+}
+
+func ModifyAssistant(c *gin.Context) {
+	assistant, ok := getOwnedAssistant(c)
+	if !ok {
+		return
+	}
+	var request assistantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if request.Model != nil && *request.Model == "" {
+		openAIError(c, http.StatusBadRequest, "invalid_request", "The model can not be empty.")
+		return
+	}
+	if err := applyAssistantRequest(assistant, &request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err := assistant.Update(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "modify_assistant_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIAssistant(assistant))
+}
+
+func DeleteAssistant(c *gin.Context) {
+	assistant, ok := getOwnedAssistant(c)
+	if !ok {
+		return
+	}
+	if err := assistant.Delete(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "delete_assistant_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      assistant.Id,
+		"object":  "assistant.deleted",
+		"deleted": true,
+	})
+}
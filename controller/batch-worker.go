@@ -0,0 +1,419 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// batchEndpoints are the endpoints a batch may target, all of them are served by RelayTextHelper
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+}
+
+const (
+	batchMaxLineSize     = 16 << 20
+	batchMaxErrors       = 100
+	batchMaxRetries      = 3
+	batchPollInterval    = 10 * time.Second
+	batchRetryBackoff    = 5 * time.Second
+	batchProgressPeriod  = time.Second
+	batchResultsFileMime = "application/jsonl"
+)
+
+type batchRequestLine struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type batchLineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+type batchResultResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchResultLine struct {
+	Id       string               `json:"id"`
+	CustomId string               `json:"custom_id"`
+	Response *batchResultResponse `json:"response"`
+	Error    *batchLineError      `json:"error"`
+}
+
+type batchTask struct {
+	ctx     context.Context
+	key     string
+	line    *batchRequestLine
+	results chan<- *batchResultLine
+}
+
+var (
+	// batchEngine routes the requests of batches through the same middlewares as the relay router,
+	// so that token checks, channel selection, retries and billing behave exactly like online requests
+	batchEngine  *gin.Engine
+	batchTasks   chan *batchTask
+	batchNotify  = make(chan struct{}, 1)
+	batchRunning sync.Map
+)
+
+// StartBatchWorkers starts the worker pool executing the batches created through /v1/batches,
+// it must only be called on the master node.
+func StartBatchWorkers() {
+	batchEngine = gin.New()
+	for endpoint := range batchEndpoints {
+		batchEngine.POST(endpoint, middleware.RequestId(), middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute(), middleware.BatchChannelRateLimit(), Relay)
+	}
+	batchTasks = make(chan *batchTask)
+	for i := 0; i < config.BatchWorkerCount; i++ {
+		go batchWorker()
+	}
+	failInterruptedBatches()
+	go func() {
+		for {
+			// cancelling batches that are not running here were cancelled before they started
+			batches, err := model.GetBatchesByStatus(model.BatchStatusValidating, model.BatchStatusCancelling)
+			if err != nil {
+				logger.SysError("failed to get pending batches: " + err.Error())
+			}
+			for _, batch := range batches {
+				if _, running := batchRunning.LoadOrStore(batch.Id, true); !running {
+					go runBatch(batch)
+				}
+			}
+			select {
+			case <-batchNotify:
+			case <-time.After(batchPollInterval):
+			}
+		}
+	}()
+	logger.SysLog(fmt.Sprintf("batch workers started, worker count: %d", config.BatchWorkerCount))
+}
+
+// notifyBatchWorkers makes the master node pick up a new batch without waiting for the next poll
+func notifyBatchWorkers() {
+	select {
+	case batchNotify <- struct{}{}:
+	default:
+	}
+}
+
+// failInterruptedBatches closes the batches left running by a restart, they can not be resumed
+// because part of their requests may have been executed and billed already.
+func failInterruptedBatches() {
+	batches, err := model.GetBatchesByStatus(model.BatchStatusInProgress, model.BatchStatusFinalizing)
+	if err != nil {
+		logger.SysError("failed to get interrupted batches: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		failBatch(batch, []batchLineError{{Code: "batch_interrupted", Message: "The batch was interrupted by a server restart."}})
+	}
+}
+
+func batchWorker() {
+	for task := range batchTasks {
+		task.results <- executeBatchRequest(task)
+	}
+}
+
+func executeBatchRequest(task *batchTask) *batchResultLine {
+	result := &batchResultLine{
+		Id:       "batch_req_" + random.GetUUID(),
+		CustomId: task.line.CustomId,
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(task.ctx, http.MethodPost, task.line.Url, bytes.NewReader(task.line.Body))
+		if err != nil {
+			result.Error = &batchLineError{Code: "invalid_request", Message: err.Error()}
+			return result
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer sk-"+task.key)
+		w := httptest.NewRecorder()
+		batchEngine.ServeHTTP(w, req)
+		if w.Code == http.StatusTooManyRequests && attempt < batchMaxRetries && task.ctx.Err() == nil {
+			// the upstream is saturated, give it some time before trying again
+			select {
+			case <-task.ctx.Done():
+			case <-time.After(batchRetryBackoff << attempt):
+			}
+			continue
+		}
+		body := w.Body.Bytes()
+		if !json.Valid(body) {
+			body, _ = json.Marshal(string(body))
+		}
+		result.Response = &batchResultResponse{
+			StatusCode: w.Code,
+			RequestId:  w.Header().Get(helper.RequestIdKey),
+			Body:       body,
+		}
+		return result
+	}
+}
+
+func marshalBatchErrors(lineErrors []batchLineError) string {
+	jsonBytes, _ := json.Marshal(lineErrors)
+	return string(jsonBytes)
+}
+
+// readBatchInput parses and validates the input file of the batch
+func readBatchInput(batch *model.Batch) ([]*batchRequestLine, []batchLineError) {
+	reader, err := storage.Get().Open(batch.InputFileId)
+	if err != nil {
+		return nil, []batchLineError{{Code: "file_not_found", Message: "The input file can not be read.", Param: "input_file_id"}}
+	}
+	defer reader.Close()
+	var lines []*batchRequestLine
+	var lineErrors []batchLineError
+	customIds := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), batchMaxLineSize)
+	for lineNumber := 1; scanner.Scan() && len(lineErrors) < batchMaxErrors; lineNumber++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		line := &batchRequestLine{}
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		switch {
+		case json.Unmarshal(text, line) != nil:
+			lineErrors = append(lineErrors, batchLineError{Code: "invalid_json_line", Message: "This line is not parseable as valid JSON.", Line: lineNumber})
+		case line.CustomId == "":
+			lineErrors = append(lineErrors, batchLineError{Code: "missing_required_parameter", Message: "The custom_id is required.", Param: "custom_id", Line: lineNumber})
+		case customIds[line.CustomId]:
+			lineErrors = append(lineErrors, batchLineError{Code: "duplicate_custom_id", Message: "The custom_id for this request is a duplicate of another request.", Param: "custom_id", Line: lineNumber})
+		case line.Method != http.MethodPost:
+			lineErrors = append(lineErrors, batchLineError{Code: "invalid_method", Message: "Only POST requests are supported.", Param: "method", Line: lineNumber})
+		case line.Url != batch.Endpoint:
+			lineErrors = append(lineErrors, batchLineError{Code: "mismatched_endpoint", Message: fmt.Sprintf("The url %s does not match the endpoint %s of the batch.", line.Url, batch.Endpoint), Param: "url", Line: lineNumber})
+		case json.Unmarshal(line.Body, &body) != nil:
+			lineErrors = append(lineErrors, batchLineError{Code: "invalid_request", Message: "The body must be a JSON object.", Param: "body", Line: lineNumber})
+		case body.Model == "":
+			lineErrors = append(lineErrors, batchLineError{Code: "missing_required_parameter", Message: "The model is required.", Param: "body.model", Line: lineNumber})
+		case body.Stream:
+			lineErrors = append(lineErrors, batchLineError{Code: "invalid_request", Message: "Streaming is not supported in batches.", Param: "body.stream", Line: lineNumber})
+		default:
+			customIds[line.CustomId] = true
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		lineErrors = append(lineErrors, batchLineError{Code: "invalid_file", Message: err.Error()})
+	}
+	if len(lineErrors) == 0 && len(lines) == 0 {
+		lineErrors = append(lineErrors, batchLineError{Code: "empty_file", Message: "The input file contains no requests."})
+	}
+	if len(lines) > config.BatchMaxRequests {
+		lineErrors = append(lineErrors, batchLineError{Code: "too_many_requests", Message: fmt.Sprintf("The input file can contain at most %d requests.", config.BatchMaxRequests)})
+	}
+	return lines, lineErrors
+}
+
+// saveBatchResults turns a temporary result file into a file of the user, an empty result has no file
+func saveBatchResults(batch *model.Batch, tempFile *os.File, name string) (string, error) {
+	if _, err := tempFile.Seek(0, 0); err != nil {
+		return "", err
+	}
+	file := &model.File{
+		Id:       "file-" + random.GetUUID(),
+		UserId:   batch.UserId,
+		TokenId:  batch.TokenId,
+		Filename: fmt.Sprintf("%s_%s.jsonl", batch.Id, name),
+		Purpose:  "batch_output",
+		MimeType: batchResultsFileMime,
+	}
+	size, err := storage.Get().Save(file.Id, tempFile)
+	if err != nil || size == 0 {
+		_ = storage.Get().Delete(file.Id)
+		return "", err
+	}
+	file.Bytes = size
+	if err = file.Insert(); err != nil {
+		_ = storage.Get().Delete(file.Id)
+		return "", err
+	}
+	return file.Id, nil
+}
+
+func failBatch(batch *model.Batch, lineErrors []batchLineError) {
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = helper.GetTimestamp()
+	batch.Errors = marshalBatchErrors(lineErrors)
+	if err := batch.Update(); err != nil {
+		logger.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+	logger.SysLog(fmt.Sprintf("batch %s failed: %s", batch.Id, lineErrors[0].Message))
+}
+
+func runBatch(batch *model.Batch) {
+	defer batchRunning.Delete(batch.Id)
+	if batch.Status == model.BatchStatusCancelling {
+		batch.Status = model.BatchStatusCancelled
+		batch.CancelledAt = helper.GetTimestamp()
+		if err := batch.Update(); err != nil {
+			logger.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		}
+		return
+	}
+	lines, lineErrors := readBatchInput(batch)
+	if len(lineErrors) > 0 {
+		failBatch(batch, lineErrors)
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, []batchLineError{{Code: "token_not_found", Message: "The token that created the batch no longer exists."}})
+		return
+	}
+	outputFile, err := os.CreateTemp("", "batch-output-*")
+	if err != nil {
+		failBatch(batch, []batchLineError{{Code: "server_error", Message: err.Error()}})
+		return
+	}
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+	errorFile, err := os.CreateTemp("", "batch-error-*")
+	if err != nil {
+		failBatch(batch, []batchLineError{{Code: "server_error", Message: err.Error()}})
+		return
+	}
+	defer os.Remove(errorFile.Name())
+	defer errorFile.Close()
+
+	batch.Status = model.BatchStatusInProgress
+	batch.InProgressAt = helper.GetTimestamp()
+	batch.RequestTotal = len(lines)
+	if err = batch.Update(); err != nil {
+		logger.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+	logger.SysLog(fmt.Sprintf("batch %s started with %d requests", batch.Id, len(lines)))
+
+	ctx, cancel := context.WithDeadline(helper.SetBatchID(context.Background(), batch.Id), time.Unix(batch.ExpiresAt, 0))
+	defer cancel()
+	results := make(chan *batchResultLine)
+	dispatched := make(chan int, 1)
+	go func() {
+		count := 0
+		for _, line := range lines {
+			select {
+			case <-ctx.Done():
+			case batchTasks <- &batchTask{ctx: ctx, key: token.Key, line: line, results: results}:
+				count++
+				continue
+			}
+			break
+		}
+		dispatched <- count
+	}()
+
+	output := json.NewEncoder(outputFile)
+	errorOutput := json.NewEncoder(errorFile)
+	writeResult := func(result *batchResultLine) {
+		if result.Error == nil && result.Response.StatusCode == http.StatusOK {
+			batch.RequestCompleted++
+			err = output.Encode(result)
+		} else {
+			batch.RequestFailed++
+			err = errorOutput.Encode(result)
+		}
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to write result of batch %s: %s", batch.Id, err.Error()))
+		}
+	}
+	cancelled := false
+	ticker := time.NewTicker(batchProgressPeriod)
+	defer ticker.Stop()
+	received, total := 0, -1
+	for total < 0 || received < total {
+		select {
+		case result := <-results:
+			writeResult(result)
+			received++
+		case total = <-dispatched:
+		case <-ticker.C:
+			if err := batch.UpdateRequestCounts(); err != nil {
+				logger.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+			}
+			if status, _ := model.GetBatchStatus(batch.Id); status == model.BatchStatusCancelling && !cancelled {
+				cancelled = true
+				batch.Status = model.BatchStatusCancelling
+				batch.CancellingAt = helper.GetTimestamp()
+				cancel()
+			}
+		}
+	}
+	// the requests that were never sent are reported in the error file
+	code, message := "batch_expired", "This request could not be executed before the completion window expired."
+	if cancelled {
+		code, message = "batch_cancelled", "This request was not executed because the batch was cancelled."
+	}
+	for _, line := range lines[total:] {
+		writeResult(&batchResultLine{
+			Id:       "batch_req_" + random.GetUUID(),
+			CustomId: line.CustomId,
+			Error:    &batchLineError{Code: code, Message: message},
+		})
+	}
+
+	if !cancelled {
+		batch.Status = model.BatchStatusFinalizing
+		batch.FinalizingAt = helper.GetTimestamp()
+		if err = batch.Update(); err != nil {
+			logger.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		}
+	}
+	if batch.OutputFileId, err = saveBatchResults(batch, outputFile, "output"); err != nil {
+		logger.SysError(fmt.Sprintf("failed to save output of batch %s: %s", batch.Id, err.Error()))
+	}
+	if batch.ErrorFileId, err = saveBatchResults(batch, errorFile, "error"); err != nil {
+		logger.SysError(fmt.Sprintf("failed to save error file of batch %s: %s", batch.Id, err.Error()))
+	}
+	now := helper.GetTimestamp()
+	switch {
+	case cancelled:
+		batch.Status = model.BatchStatusCancelled
+		batch.CancelledAt = now
+	case total < len(lines):
+		batch.Status = model.BatchStatusExpired
+		batch.ExpiredAt = now
+	default:
+		batch.Status = model.BatchStatusCompleted
+		batch.CompletedAt = now
+	}
+	if err = batch.Update(); err != nil {
+		logger.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+	logger.SysLog(fmt.Sprintf("batch %s %s, %d completed, %d failed", batch.Id, batch.Status, batch.RequestCompleted, batch.RequestFailed))
+}
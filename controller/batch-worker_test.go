@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const testBatchWorkerCount = 2
+
+var startTestBatchWorkers sync.Once
+
+// newTestBatch saves the requests as the input file of a new batch and hands the batch to the workers
+func newTestBatch(t *testing.T, user *model.User, token *model.Token, lines ...string) *model.Batch {
+	startTestBatchWorkers.Do(func() {
+		config.BatchWorkerCount = testBatchWorkerCount
+		StartBatchWorkers()
+	})
+	fileId := "file-" + random.GetUUID()
+	_, err := storage.Get().Save(fileId, strings.NewReader(strings.Join(lines, "\n")))
+	assert.NoError(t, err)
+	batch := &model.Batch{Id: "batch_" + random.GetUUID(), UserId: user.Id, TokenId: token.Id, Endpoint: "/v1/chat/completions",
+		InputFileId: fileId, CompletionWindow: "24h", Status: model.BatchStatusValidating, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	assert.NoError(t, batch.Insert())
+	notifyBatchWorkers()
+	return batch
+}
+
+func newTestBatchLine(customId string, batchModel string, content string) string {
+	return fmt.Sprintf(`{"custom_id":"%s","method":"POST","url":"/v1/chat/completions","body":{"model":"%s","messages":[{"role":"user","content":"%s"}]}}`,
+		customId, batchModel, content)
+}
+
+// waitTestBatch waits for the batch to reach one of the final statuses
+func waitTestBatch(t *testing.T, batch *model.Batch) *model.Batch {
+	for i := 0; i < 200; i++ {
+		current, err := model.GetBatchById(batch.Id, batch.UserId, batch.TokenId)
+		assert.NoError(t, err)
+		switch current.Status {
+		case model.BatchStatusCompleted, model.BatchStatusFailed, model.BatchStatusCancelled, model.BatchStatusExpired:
+			return current
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("batch %s did not finish", batch.Id)
+	return nil
+}
+
+// readTestBatchResults reads a result file of the batch by custom id
+func readTestBatchResults(t *testing.T, fileId string) map[string]*batchResultLine {
+	results := make(map[string]*batchResultLine)
+	if fileId == "" {
+		return results
+	}
+	reader, err := storage.Get().Open(fileId)
+	if !assert.NoError(t, err) {
+		return results
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var result batchResultLine
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		results[result.CustomId] = &result
+	}
+	return results
+}
+
+func TestBatchWorkers(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	user, token, _ := newTestRelay(t, "batch-pool", func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":{"message":"bad request","type":"invalid_request_error"}}`)
+			return
+		}
+		writeTestCompletion(w, `{"role":"assistant","content":"ok"}`)
+	})
+	lines := []string{newTestBatchLine("fail", "batch-pool", "fail")}
+	for i := 1; i <= 5; i++ {
+		lines = append(lines, newTestBatchLine(fmt.Sprintf("request-%d", i), "batch-pool", "hello"))
+	}
+	batch := waitTestBatch(t, newTestBatch(t, user, token, lines...))
+
+	assert.Equal(t, model.BatchStatusCompleted, batch.Status)
+	assert.Equal(t, 6, batch.RequestTotal)
+	assert.Equal(t, 5, batch.RequestCompleted)
+	assert.Equal(t, 1, batch.RequestFailed)
+	// the requests are shared by the workers of the pool
+	assert.Equal(t, int32(testBatchWorkerCount), maxInFlight.Load())
+
+	outputs := readTestBatchResults(t, batch.OutputFileId)
+	assert.Len(t, outputs, 5)
+	for i := 1; i <= 5; i++ {
+		if result, ok := outputs[fmt.Sprintf("request-%d", i)]; assert.True(t, ok) {
+			assert.Equal(t, http.StatusOK, result.Response.StatusCode)
+			assert.NotEmpty(t, result.Response.RequestId)
+			assert.Contains(t, string(result.Response.Body), `"content":"ok"`)
+			assert.Nil(t, result.Error)
+		}
+	}
+	errorResults := readTestBatchResults(t, batch.ErrorFileId)
+	if result, ok := errorResults["fail"]; assert.Len(t, errorResults, 1) && assert.True(t, ok) {
+		assert.Equal(t, http.StatusBadRequest, result.Response.StatusCode)
+		assert.Contains(t, string(result.Response.Body), "bad request")
+	}
+}
+
+func TestBatchValidation(t *testing.T) {
+	user, token, _ := newTestRelay(t, "batch-invalid", func(w http.ResponseWriter, r *http.Request) {
+		writeTestCompletion(w, `{"role":"assistant","content":"ok"}`)
+	})
+	batch := waitTestBatch(t, newTestBatch(t, user, token,
+		newTestBatchLine("request-1", "batch-invalid", "hello"),
+		newTestBatchLine("request-1", "batch-invalid", "hello"),
+		`{"custom_id":"request-2","method":"GET","url":"/v1/chat/completions","body":{}}`,
+	))
+	assert.Equal(t, model.BatchStatusFailed, batch.Status)
+	assert.Contains(t, batch.Errors, "duplicate_custom_id")
+	assert.Contains(t, batch.Errors, "invalid_method")
+	assert.Empty(t, batch.OutputFileId)
+}
+
+func TestBatchCancel(t *testing.T) {
+	var received atomic.Int32
+	user, token, _ := newTestRelay(t, "batch-cancel", func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		// the requests hang until the batch is cancelled
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		writeTestCompletion(w, `{"role":"assistant","content":"ok"}`)
+	})
+	var lines []string
+	for i := 1; i <= 6; i++ {
+		lines = append(lines, newTestBatchLine(fmt.Sprintf("request-%d", i), "batch-cancel", "hello"))
+	}
+	batch := newTestBatch(t, user, token, lines...)
+	assert.Eventually(t, func() bool { return received.Load() == testBatchWorkerCount }, 5*time.Second, 20*time.Millisecond)
+	cancelled, err := model.CancelBatch(batch.Id, batch.UserId, batch.TokenId)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+	batch = waitTestBatch(t, batch)
+
+	assert.Equal(t, model.BatchStatusCancelled, batch.Status)
+	assert.NotZero(t, batch.CancelledAt)
+	assert.Equal(t, int32(testBatchWorkerCount), received.Load())
+	assert.Zero(t, batch.RequestCompleted)
+	assert.Equal(t, 6, batch.RequestFailed)
+	assert.Empty(t, batch.OutputFileId)
+	// every request is in the error file, the ones never sent say why
+	errorResults := readTestBatchResults(t, batch.ErrorFileId)
+	assert.Len(t, errorResults, 6)
+	notSent := 0
+	for _, result := range errorResults {
+		if result.Error != nil {
+			assert.Equal(t, "batch_cancelled", result.Error.Code)
+			notSent++
+		}
+	}
+	assert.Equal(t, 6-testBatchWorkerCount, notSent)
+}
+
+func TestBatchChannelRateLimit(t *testing.T) {
+	config.BatchChannelRateLimit = 2
+	defer func() { config.BatchChannelRateLimit = 0 }()
+	var received atomic.Int32
+	user, token, _ := newTestRelay(t, "batch-limit", func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		writeTestCompletion(w, `{"role":"assistant","content":"ok"}`)
+	})
+	batch := newTestBatch(t, user, token,
+		newTestBatchLine("request-1", "batch-limit", "hello"),
+		newTestBatchLine("request-2", "batch-limit", "hello"),
+		newTestBatchLine("request-3", "batch-limit", "hello"),
+	)
+	// the third request waits for the channel for the rest of the minute
+	assert.Eventually(t, func() bool { return received.Load() == 2 }, 5*time.Second, 20*time.Millisecond)
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, int32(2), received.Load())
+	_, err := model.CancelBatch(batch.Id, batch.UserId, batch.TokenId)
+	assert.NoError(t, err)
+	batch = waitTestBatch(t, batch)
+
+	assert.Equal(t, model.BatchStatusCancelled, batch.Status)
+	assert.Equal(t, 2, batch.RequestCompleted)
+	assert.Equal(t, 1, batch.RequestFailed)
+	assert.Len(t, readTestBatchResults(t, batch.OutputFileId), 2)
+	errorResults := readTestBatchResults(t, batch.ErrorFileId)
+	if assert.Len(t, errorResults, 1) {
+		for _, result := range errorResults {
+			assert.Equal(t, http.StatusTooManyRequests, result.Response.StatusCode)
+			assert.Contains(t, string(result.Response.Body), "rate limit")
+		}
+	}
+}
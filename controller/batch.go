@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/batch
+
+const batchCompletionWindow = "24h"
+
+type batchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type batchErrorList struct {
+	Object string           `json:"object"`
+	Data   []batchLineError `json:"data"`
+}
+
+type OpenAIBatch struct {
+	Id               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	Errors           *batchErrorList    `json:"errors"`
+	InputFileId      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileId     *string            `json:"output_file_id"`
+	ErrorFileId      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     *int64             `json:"in_progress_at"`
+	ExpiresAt        *int64             `json:"expires_at"`
+	FinalizingAt     *int64             `json:"finalizing_at"`
+	CompletedAt      *int64             `json:"completed_at"`
+	FailedAt         *int64             `json:"failed_at"`
+	ExpiredAt        *int64             `json:"expired_at"`
+	CancellingAt     *int64             `json:"cancelling_at"`
+	CancelledAt      *int64             `json:"cancelled_at"`
+	RequestCounts    batchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata"`
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nullableTime(t int64) *int64 {
+	if t == 0 {
+		return nil
+	}
+	return &t
+}
+
+func toOpenAIBatch(batch *model.Batch) OpenAIBatch {
+	openAIBatch := OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     nullableString(batch.OutputFileId),
+		ErrorFileId:      nullableString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     nullableTime(batch.InProgressAt),
+		ExpiresAt:        nullableTime(batch.ExpiresAt),
+		FinalizingAt:     nullableTime(batch.FinalizingAt),
+		CompletedAt:      nullableTime(batch.CompletedAt),
+		FailedAt:         nullableTime(batch.FailedAt),
+		ExpiredAt:        nullableTime(batch.ExpiredAt),
+		CancellingAt:     nullableTime(batch.CancellingAt),
+		CancelledAt:      nullableTime(batch.CancelledAt),
+		RequestCounts: batchRequestCounts{
+			Total:     batch.RequestTotal,
+			Completed: batch.RequestCompleted,
+			Failed:    batch.RequestFailed,
+		},
+	}
+	if batch.Errors != "" {
+		openAIBatch.Errors = &batchErrorList{Object: "list"}
+		_ = json.Unmarshal([]byte(batch.Errors), &openAIBatch.Errors.Data)
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &openAIBatch.Metadata)
+	}
+	return openAIBatch
+}
+
+func getOwnedBatch(c *gin.Context) (*model.Batch, bool) {
+	batchId := c.Param("id")
+	batch, err := model.GetBatchById(batchId, c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId))
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No such Batch object: %s", batchId))
+		return nil, false
+	}
+	return batch, true
+}
+
+func CreateBatch(c *gin.Context) {
+	var request struct {
+		InputFileId      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !batchEndpoints[request.Endpoint] {
+		openAIError(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("Unsupported endpoint: '%s'", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		openAIError(c, http.StatusBadRequest, "invalid_completion_window", fmt.Sprintf("Unsupported completion window: '%s', only '%s' is supported", request.CompletionWindow, batchCompletionWindow))
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	tokenId := c.GetInt(ctxkey.TokenId)
+	file, err := model.GetFileById(request.InputFileId, userId, tokenId)
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		return
+	}
+	if file.Purpose != "batch" {
+		openAIError(c, http.StatusBadRequest, "invalid_input_file", "The input file must be uploaded with purpose 'batch'")
+		return
+	}
+	batch := &model.Batch{
+		Id:               "batch_" + random.GetUUID(),
+		UserId:           userId,
+		TokenId:          tokenId,
+		Endpoint:         request.Endpoint,
+		InputFileId:      file.Id,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		ExpiresAt:        time.Now().Add(24 * time.Hour).Unix(),
+	}
+	if len(request.Metadata) > 0 {
+		metadata, _ := json.Marshal(request.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err = batch.Insert(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		return
+	}
+	notifyBatchWorkers()
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetBatches(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), c.Query("after"), limit+1)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_batches_failed", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]OpenAIBatch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, toOpenAIBatch(batch))
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(data) > 0 {
+		response["first_id"] = data[0].Id
+		response["last_id"] = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, ok := getOwnedBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch, ok := getOwnedBatch(c)
+	if !ok {
+		return
+	}
+	cancelled, err := model.CancelBatch(batch.Id, batch.UserId, batch.TokenId)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+		return
+	}
+	if !cancelled {
+		openAIError(c, http.StatusConflict, "invalid_batch_status", fmt.Sprintf("Cannot cancel a batch with status '%s'", batch.Status))
+		return
+	}
+	notifyBatchWorkers()
+	batch, ok = getOwnedBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
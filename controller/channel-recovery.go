@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// The auto-disabled channels are probed in the background until they work again. The interval between two
+// probes of a channel starts at CHANNEL_RECOVERY_INTERVAL and doubles after each failed probe, up to
+// CHANNEL_RECOVERY_MAX_INTERVAL, so that a channel down for long is not hammered.
+
+const channelRecoveryTick = 10 * time.Second
+
+type channelRecovery struct {
+	failures  int
+	nextProbe time.Time
+}
+
+// channelRecoveries is only used by the goroutine of AutomaticallyRecoverChannels
+var channelRecoveries = make(map[int]*channelRecovery)
+
+// testRecoveringChannel sends the probes, the tests replace it to leave the upstream out
+var testRecoveringChannel = testChannel
+
+// getRecoveryBackoff returns the interval before the next probe of a channel after its failed probes
+func getRecoveryBackoff(failures int) time.Duration {
+	backoff := time.Duration(config.ChannelRecoveryInterval) * time.Second
+	maxBackoff := time.Duration(config.ChannelRecoveryMaxInterval) * time.Second
+	for i := 0; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func AutomaticallyRecoverChannels() {
+	ctx := context.Background()
+	for {
+		time.Sleep(channelRecoveryTick)
+		if !config.AutomaticEnableChannelEnabled {
+			continue
+		}
+		recoverChannels(ctx, time.Now())
+	}
+}
+
+func recoverChannels(ctx context.Context, now time.Time) {
+	channels, err := model.GetAllChannels(0, 0, "disabled")
+	if err != nil {
+		logger.SysError("failed to get the disabled channels: " + err.Error())
+		return
+	}
+	disabled := make(map[int]bool)
+	for _, channel := range channels {
+		if channel.Status != model.ChannelStatusAutoDisabled {
+			continue
+		}
+		disabled[channel.Id] = true
+		recovery, ok := channelRecoveries[channel.Id]
+		if !ok {
+			// the first probe waits for one interval, the channel has just failed
+			channelRecoveries[channel.Id] = &channelRecovery{nextProbe: now.Add(getRecoveryBackoff(0))}
+			continue
+		}
+		if now.Before(recovery.nextProbe) {
+			continue
+		}
+		if probeChannel(ctx, channel) {
+			delete(channelRecoveries, channel.Id)
+			continue
+		}
+		recovery.failures++
+		recovery.nextProbe = time.Now().Add(getRecoveryBackoff(recovery.failures))
+		time.Sleep(config.RequestInterval)
+	}
+	for channelId := range channelRecoveries {
+		if !disabled[channelId] {
+			delete(channelRecoveries, channelId)
+		}
+	}
+}
+
+// probeChannel tests the channel with its test model and prompt, records the probe and enables the channel
+// if it works again
+func probeChannel(ctx context.Context, channel *model.Channel) bool {
+	probe := &model.ChannelProbe{ChannelId: channel.Id}
+	testRequest, err := buildChannelTestRequest(channel, "")
+	var openaiErr *relaymodel.Error
+	if err == nil {
+		// testChannel rewrites the model of the request to the upstream one
+		probe.Model = testRequest.Model
+		tik := time.Now()
+		_, _, err, openaiErr = testRecoveringChannel(ctx, channel, testRequest)
+		probe.ResponseTime = time.Since(tik).Milliseconds()
+	}
+	probe.Success = err == nil && openaiErr == nil
+	if err != nil {
+		probe.Message = err.Error()
+	} else if openaiErr != nil {
+		probe.Message = openaiErr.Message
+	}
+	if recordErr := model.RecordChannelProbe(probe); recordErr != nil {
+		logger.SysError(fmt.Sprintf("failed to record the probe of channel #%d: %s", channel.Id, recordErr.Error()))
+	}
+	if !monitor.ShouldEnableChannel(err, openaiErr) {
+		return false
+	}
+	monitor.EnableChannel(channel.Id, channel.Name)
+	return true
+}
+
+func GetChannelProbes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	probes, err := model.GetChannelProbes(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    probes,
+	})
+	return
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestRecoverChannels(t *testing.T) {
+	config.AutomaticEnableChannelEnabled = true
+	config.ChannelRecoveryInterval = 10
+	config.ChannelRecoveryMaxInterval = 40
+	defer func() {
+		config.AutomaticEnableChannelEnabled = false
+		config.ChannelRecoveryInterval = 60
+		config.ChannelRecoveryMaxInterval = 3600
+		testRecoveringChannel = testChannel
+	}()
+	channels := map[string]*model.Channel{
+		"recovered": {Name: "recovered", Key: "sk-recovered", Models: "recovered-model", Status: model.ChannelStatusAutoDisabled},
+		"down":      {Name: "down", Key: "sk-down", Models: "down-model", Status: model.ChannelStatusAutoDisabled},
+		"patterns":  {Name: "patterns", Key: "sk-patterns", Models: "patterns-*", Status: model.ChannelStatusAutoDisabled},
+		"manual":    {Name: "manual", Key: "sk-manual", Models: "manual-model", Status: model.ChannelStatusManuallyDisabled},
+	}
+	for _, channel := range channels {
+		assert.NoError(t, channel.Insert())
+	}
+	probes := make(map[string]int)
+	working := map[string]bool{"recovered": true}
+	testRecoveringChannel = func(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (string, string, error, *relaymodel.Error) {
+		probes[channel.Name]++
+		if working[channel.Name] {
+			return "ok", "", nil, nil
+		}
+		return "", "", nil, &relaymodel.Error{Message: "upstream down", Type: "upstream_error"}
+	}
+	getStatus := func(name string) int {
+		channel, err := model.GetChannelById(channels[name].Id, false)
+		assert.NoError(t, err)
+		return channel.Status
+	}
+
+	// the channels have just failed, they are probed after one interval
+	now := time.Now()
+	recoverChannels(context.Background(), now)
+	recoverChannels(context.Background(), now.Add(5*time.Second))
+	assert.Empty(t, probes)
+
+	recoverChannels(context.Background(), now.Add(11*time.Second))
+	assert.Equal(t, map[string]int{"recovered": 1, "down": 1}, probes)
+	assert.Equal(t, model.ChannelStatusEnabled, getStatus("recovered"))
+	assert.NotContains(t, channelRecoveries, channels["recovered"].Id)
+	assert.Equal(t, model.ChannelStatusAutoDisabled, getStatus("down"))
+	assert.Equal(t, model.ChannelStatusManuallyDisabled, getStatus("manual"))
+	// the probes are recorded with the model tested
+	recorded, err := model.GetChannelProbes(channels["recovered"].Id)
+	assert.NoError(t, err)
+	if assert.Len(t, recorded, 1) {
+		assert.True(t, recorded[0].Success)
+		assert.Equal(t, "recovered-model", recorded[0].Model)
+	}
+	// a channel without a model to test fails its probes without sending them
+	recorded, err = model.GetChannelProbes(channels["patterns"].Id)
+	assert.NoError(t, err)
+	if assert.Len(t, recorded, 1) {
+		assert.False(t, recorded[0].Success)
+		assert.Empty(t, recorded[0].Model)
+		assert.NotEmpty(t, recorded[0].Message)
+	}
+
+	// the failed channel waits twice as long before its next probe
+	recovery := channelRecoveries[channels["down"].Id]
+	if assert.NotNil(t, recovery) {
+		assert.Equal(t, 1, recovery.failures)
+		assert.WithinDuration(t, time.Now().Add(20*time.Second), recovery.nextProbe, 2*time.Second)
+	}
+	recoverChannels(context.Background(), now.Add(15*time.Second))
+	assert.Equal(t, 1, probes["down"])
+	recoverChannels(context.Background(), now.Add(25*time.Second))
+	assert.Equal(t, 2, probes["down"])
+	if assert.NotNil(t, recovery) {
+		assert.Equal(t, 2, recovery.failures)
+		assert.WithinDuration(t, time.Now().Add(40*time.Second), recovery.nextProbe, 2*time.Second)
+	}
+
+	// the channel is enabled once it works again
+	working["down"] = true
+	recoverChannels(context.Background(), now.Add(70*time.Second))
+	assert.Equal(t, 3, probes["down"])
+	assert.Equal(t, model.ChannelStatusEnabled, getStatus("down"))
+	assert.NotContains(t, channelRecoveries, channels["down"].Id)
+	assert.Zero(t, probes["manual"])
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
@@ -49,6 +50,39 @@ func buildTestRequest(model string) *relaymodel.GeneralOpenAIRequest {
 	return testRequest
 }
 
+// buildChannelTestRequest uses the test model and prompt of the channel, the model asked for taking precedence
+func buildChannelTestRequest(channel *model.Channel, modelName string) (*relaymodel.GeneralOpenAIRequest, error) {
+	cfg, _ := channel.LoadConfig()
+	if modelName == "" {
+		modelName = cfg.TestModel
+	}
+	modelName, err := getTestModel(channel, modelName)
+	if err != nil {
+		return nil, err
+	}
+	testRequest := buildTestRequest(modelName)
+	if cfg.TestPrompt != "" {
+		testRequest.Messages[0].Content = cfg.TestPrompt
+	}
+	return testRequest, nil
+}
+
+// getTestModel returns the model of the channel tested for the model asked for, the first model listed by the
+// channel when it doesn't serve that one. A pattern names no real model, a channel that only lists patterns
+// must be given a test model.
+func getTestModel(channel *model.Channel, modelName string) (string, error) {
+	if modelName != "" && modelpattern.InList(modelName, channel.Models) {
+		return modelName, nil
+	}
+	for _, name := range strings.Split(channel.Models, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !modelpattern.IsPattern(name) {
+			return name, nil
+		}
+	}
+	return "", errors.New("渠道的模型均为通配符，请设置测试模型")
+}
+
 func parseTestResponse(resp string) (*openai.TextResponse, string, error) {
 	var response openai.TextResponse
 	err := json.Unmarshal([]byte(resp), &response)
@@ -65,7 +99,7 @@ func parseTestResponse(resp string) (*openai.TextResponse, string, error) {
 	return &response, stringContent, nil
 }
 
-func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, err error, openaiErr *relaymodel.Error) {
+func testChannel(ctx context.Context, channel *model.Channel, request *relaymodel.GeneralOpenAIRequest) (responseMessage string, keyFingerprint string, err error, openaiErr *relaymodel.Error) {
 	startTime := time.Now()
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -82,33 +116,25 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	cfg, _ := channel.LoadConfig()
 	c.Set(ctxkey.Config, cfg)
 	middleware.SetupContextForSelectedChannel(c, channel, "")
+	// a multi-key channel is tested with the next key of its rotation
+	keyFingerprint = c.GetString(ctxkey.KeyFingerprint)
 	meta := meta.GetByContext(c)
 	apiType := channeltype.ToAPIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
 	if adaptor == nil {
-		return "", fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
+		return "", keyFingerprint, fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
 	}
 	adaptor.Init(meta)
-	modelName := request.Model
-	modelMap := channel.GetModelMapping()
-	if modelName == "" || !strings.Contains(channel.Models, modelName) {
-		modelNames := strings.Split(channel.Models, ",")
-		if len(modelNames) > 0 {
-			modelName = modelNames[0]
-		}
-	}
-	if modelMap != nil && modelMap[modelName] != "" {
-		modelName = modelMap[modelName]
-	}
+	modelName, _ := modelpattern.Map(request.Model, channel.GetModelMapping())
 	meta.OriginModelName, meta.ActualModelName = request.Model, modelName
 	request.Model = modelName
 	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, request)
 	if err != nil {
-		return "", err, nil
+		return "", keyFingerprint, err, nil
 	}
 	jsonData, err := json.Marshal(convertedRequest)
 	if err != nil {
-		return "", err, nil
+		return "", keyFingerprint, err, nil
 	}
 	defer func() {
 		logContent := fmt.Sprintf("渠道 %s 测试成功，响应：%s", channel.Name, responseMessage)
@@ -133,7 +159,7 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 	c.Request.Body = io.NopCloser(requestBody)
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
-		return "", err, nil
+		return "", keyFingerprint, err, nil
 	}
 	if resp != nil && resp.StatusCode != http.StatusOK {
 		err := controller.RelayErrorHandler(resp)
@@ -141,29 +167,29 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 		if errorMessage != "" {
 			errorMessage = ", error message: " + errorMessage
 		}
-		return "", fmt.Errorf("http status code: %d%s", resp.StatusCode, errorMessage), &err.Error
+		return "", keyFingerprint, fmt.Errorf("http status code: %d%s", resp.StatusCode, errorMessage), &err.Error
 	}
 	usage, _, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
-		return "", fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
+		return "", keyFingerprint, fmt.Errorf("%s", respErr.Error.Message), &respErr.Error
 	}
 	if usage == nil {
-		return "", errors.New("usage is nil"), nil
+		return "", keyFingerprint, errors.New("usage is nil"), nil
 	}
 	rawResponse := w.Body.String()
 	_, responseMessage, err = parseTestResponse(rawResponse)
 	if err != nil {
 		logger.SysError(fmt.Sprintf("failed to parse error: %s, \nresponse: %s", err.Error(), rawResponse))
-		return "", err, nil
+		return "", keyFingerprint, err, nil
 	}
 	result := w.Result()
 	// print result.Body
 	respBody, err := io.ReadAll(result.Body)
 	if err != nil {
-		return "", err, nil
+		return "", keyFingerprint, err, nil
 	}
 	logger.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
-	return responseMessage, nil, nil
+	return responseMessage, keyFingerprint, nil, nil
 }
 
 func TestChannel(c *gin.Context) {
@@ -185,9 +211,16 @@ func TestChannel(c *gin.Context) {
 		return
 	}
 	modelName := c.Query("model")
-	testRequest := buildTestRequest(modelName)
+	testRequest, err := buildChannelTestRequest(channel, modelName)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	tik := time.Now()
-	responseMessage, err, _ := testChannel(ctx, channel, testRequest)
+	responseMessage, _, err, _ := testChannel(ctx, channel, testRequest)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	if err != nil {
@@ -238,9 +271,13 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 	go func() {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == model.ChannelStatusEnabled
+			testRequest, err := buildChannelTestRequest(channel, "")
+			if err != nil {
+				logger.SysError(fmt.Sprintf("failed to test channel #%d: %s", channel.Id, err.Error()))
+				continue
+			}
 			tik := time.Now()
-			testRequest := buildTestRequest("")
-			_, err, openaiErr := testChannel(ctx, channel, testRequest)
+			_, keyFingerprint, err, openaiErr := testChannel(ctx, channel, testRequest)
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
 			if isChannelEnabled && milliseconds > disableThreshold {
@@ -252,7 +289,7 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 				}
 			}
 			if isChannelEnabled && monitor.ShouldDisableChannel(openaiErr, -1) {
-				monitor.DisableChannel(channel.Id, channel.Name, err.Error())
+				monitor.DisableChannelOrKey(channel.Id, channel.Name, keyFingerprint, err.Error())
 			}
 			if !isChannelEnabled && monitor.ShouldEnableChannel(err, openaiErr) {
 				monitor.EnableChannel(channel.Id, channel.Name)
@@ -303,3 +340,35 @@ func AutomaticallyTestChannels(frequency int) {
 		logger.SysLog("channel test finished")
 	}
 }
+
+// probeAbilities tests the models disabled automatically on their own and enables those that work again
+func probeAbilities(ctx context.Context) {
+	abilities, err := model.GetAutoDisabledAbilities()
+	if err != nil {
+		logger.SysError("failed to get the disabled models: " + err.Error())
+		return
+	}
+	for _, ability := range abilities {
+		channel, err := model.GetChannelById(ability.ChannelId, true)
+		if err != nil {
+			continue
+		}
+		testRequest, err := buildChannelTestRequest(channel, ability.Model)
+		if err != nil {
+			continue
+		}
+		_, _, err, openaiErr := testChannel(ctx, channel, testRequest)
+		if monitor.ShouldEnableChannel(err, openaiErr) {
+			monitor.EnableAbility(channel.Id, channel.Name, ability.Model)
+		}
+		time.Sleep(config.RequestInterval)
+	}
+}
+
+func AutomaticallyProbeAbilities(frequency int) {
+	ctx := context.Background()
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		probeAbilities(ctx)
+	}
+}
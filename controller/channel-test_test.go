@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestGetTestModel(t *testing.T) {
+	cases := []struct {
+		name      string
+		models    string
+		modelName string
+		expected  string
+	}{
+		{"listed", "gpt-4o,gpt-4o-mini", "gpt-4o-mini", "gpt-4o-mini"},
+		{"not listed", "gpt-4o,gpt-4o-mini", "claude-3-haiku", "gpt-4o"},
+		{"default", "gpt-4o,gpt-4o-mini", "", "gpt-4o"},
+		// the model asked for may be served through a pattern
+		{"pattern", "gpt-*,gpt-4o-mini", "gpt-4-turbo", "gpt-4-turbo"},
+		// the patterns are no models to test
+		{"patterns skipped", "gpt-*, gpt-4o-mini", "claude-3-haiku", "gpt-4o-mini"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			modelName, err := getTestModel(&model.Channel{Models: c.models}, c.modelName)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, modelName)
+		})
+	}
+
+	t.Run("only patterns", func(t *testing.T) {
+		channel := &model.Channel{Models: "gpt-*,claude-*"}
+		_, err := getTestModel(channel, "")
+		assert.Error(t, err)
+		_, err = buildChannelTestRequest(channel, "")
+		assert.Error(t, err)
+		// the test model of the channel is used instead
+		channel.Config = `{"test_model":"gpt-4o"}`
+		request, err := buildChannelTestRequest(channel, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "gpt-4o", request.Model)
+	})
+}
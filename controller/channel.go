@@ -49,6 +49,33 @@ func SearchChannels(c *gin.Context) {
 	return
 }
 
+// GetChannelTrafficShares reports the share of the requests for a model of a group sent to each channel
+func GetChannelTrafficShares(c *gin.Context) {
+	group := c.Query("group")
+	modelName := c.Query("model")
+	if group == "" || modelName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "group 和 model 不能为空",
+		})
+		return
+	}
+	shares, err := model.GetChannelTrafficShares(group, modelName)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    shares,
+	})
+	return
+}
+
 func GetChannel(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -84,7 +111,40 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if cfg, err := channel.LoadConfig(); err == nil {
+		if err = cfg.ValidateSchedule(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	channel.CreatedTime = helper.GetTimestamp()
+	if channel.IsMultiKey() {
+		// the keys are rotated within a single channel
+		keys := channel.GetKeys()
+		if len(keys) == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥不能为空",
+			})
+			return
+		}
+		channel.Key = strings.Join(keys, "\n")
+		if err = channel.Insert(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+		})
+		return
+	}
 	keys := strings.Split(channel.Key, "\n")
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
@@ -155,6 +215,15 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if cfg, err := channel.LoadConfig(); err == nil {
+		if err = cfg.ValidateSchedule(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -170,3 +239,142 @@ func UpdateChannel(c *gin.Context) {
 	})
 	return
 }
+
+// GetChannelKeys reports the status and the health of the keys of a multi-key channel
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelKeyInfos(channel),
+	})
+	return
+}
+
+func GetChannelAbilities(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	abilities, err := model.GetAbilityInfos(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    abilities,
+	})
+	return
+}
+
+type channelAbilityStatusRequest struct {
+	Model  string `json:"model"`
+	Status int    `json:"status"`
+}
+
+// UpdateChannelAbilityStatus enables or disables a single model of a channel
+func UpdateChannelAbilityStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var request channelAbilityStatusRequest
+	if err = c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if request.Status != model.ChannelStatusEnabled && request.Status != model.ChannelStatusManuallyDisabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的模型状态",
+		})
+		return
+	}
+	if err = model.SetAbilityStatus(id, request.Model, request.Status, ""); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+type channelKeyStatusRequest struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+}
+
+// UpdateChannelKeyStatus enables or disables a key of a multi-key channel
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var request channelKeyStatusRequest
+	if err = c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if request.Status != model.ChannelStatusEnabled && request.Status != model.ChannelStatusManuallyDisabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的密钥状态",
+		})
+		return
+	}
+	if _, err = model.SetChannelKeyStatus(id, request.Fingerprint, request.Status, ""); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/files
+
+var filePurposes = map[string]bool{
+	"assistants": true,
+	"batch":      true,
+	"fine-tune":  true,
+	"vision":     true,
+	"user_data":  true,
+	"evals":      true,
+}
+
+type OpenAIFile struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
+
+func toOpenAIFile(file *model.File) OpenAIFile {
+	return OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+func getOwnedFile(c *gin.Context) (*model.File, bool) {
+	fileId := c.Param("id")
+	file, err := model.GetFileById(fileId, c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId))
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No such File object: %s", fileId))
+		return nil, false
+	}
+	return file, true
+}
+
+func UploadFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	userId := c.GetInt(ctxkey.Id)
+	purpose := c.PostForm("purpose")
+	if !filePurposes[purpose] {
+		openAIError(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid purpose: '%s'", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "missing_file", "The file field is required")
+		return
+	}
+	if header.Size > int64(config.FileMaxSize)<<20 {
+		openAIError(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("File exceeds the maximum size of %d MB", config.FileMaxSize))
+		return
+	}
+	group, err := model.CacheGetUserGroup(userId)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "get_user_group_failed", err.Error())
+		return
+	}
+	mimeType := header.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		if extensionType := mime.TypeByExtension(filepath.Ext(header.Filename)); extensionType != "" {
+			mimeType = extensionType
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+	reader, err := header.Open()
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "read_file_failed", err.Error())
+		return
+	}
+	defer reader.Close()
+	file := &model.File{
+		Id:       "file-" + random.GetUUID(),
+		UserId:   userId,
+		TokenId:  c.GetInt(ctxkey.TokenId),
+		Filename: filepath.Base(header.Filename),
+		Purpose:  purpose,
+		MimeType: mimeType,
+		Bytes:    header.Size,
+	}
+	// the size is reserved from the quota before the file is written
+	quota := storage.GetGroupQuota(group)
+	used, ok, err := file.InsertWithinQuota(quota)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "save_file_failed", err.Error())
+		return
+	}
+	if !ok {
+		openAIError(c, http.StatusForbidden, "file_quota_exceeded", fmt.Sprintf("File storage quota exceeded: %d of %d bytes used", used, quota))
+		return
+	}
+	size, err := storage.Get().Save(file.Id, reader)
+	if err != nil {
+		_ = file.Delete()
+		logger.Errorf(ctx, "save file failed: %s", err.Error())
+		openAIError(c, http.StatusInternalServerError, "save_file_failed", "Failed to save the file")
+		return
+	}
+	if size != file.Bytes {
+		if err = file.UpdateBytes(size); err != nil {
+			logger.Errorf(ctx, "update file size failed: %s", err.Error())
+		}
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetFiles(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), c.Query("purpose"), c.Query("after"), limit+1, c.Query("order") == "asc")
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_files_failed", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, toOpenAIFile(file))
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(data) > 0 {
+		response["first_id"] = data[0].Id
+		response["last_id"] = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, ok := getOwnedFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, ok := getOwnedFile(c)
+	if !ok {
+		return
+	}
+	reader, err := storage.Get().Open(file.Id)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "read_file_failed", err.Error())
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	c.DataFromReader(http.StatusOK, file.Bytes, file.MimeType, reader, nil)
+}
+
+func DeleteFile(c *gin.Context) {
+	file, ok := getOwnedFile(c)
+	if !ok {
+		return
+	}
+	err := storage.Get().Delete(file.Id)
+	if err == nil {
+		err = file.Delete()
+	}
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.Id,
+		"object":  "file",
+		"deleted": true,
+	})
+}
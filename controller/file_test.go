@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func uploadTestFile(t *testing.T, user *model.User, content string) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	assert.NoError(t, writer.WriteField("purpose", "assistants"))
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	assert.NoError(t, err)
+	_, _ = part.Write([]byte(content))
+	assert.NoError(t, writer.Close())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.Set(ctxkey.Id, user.Id)
+	UploadFile(c)
+	return w
+}
+
+func TestUploadFileQuota(t *testing.T) {
+	storage.GroupQuota["file-quota"] = 250
+	defer delete(storage.GroupQuota, "file-quota")
+	user := &model.User{Username: "file-quota", Password: "password", Group: "file-quota", AccessToken: "file-quota", AffCode: "file-quota"}
+	assert.NoError(t, model.DB.Create(user).Error)
+
+	// the concurrent uploads can't go over the quota together
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = uploadTestFile(t, user, strings.Repeat("a", 100)).Code
+		}(i)
+	}
+	wg.Wait()
+	uploaded := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			uploaded++
+		} else {
+			assert.Equal(t, http.StatusForbidden, code)
+		}
+	}
+	assert.Equal(t, 2, uploaded)
+	files, err := model.GetFiles(user.Id, 0, "", "", 10, true)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	w := uploadTestFile(t, user, strings.Repeat("a", 50))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = uploadTestFile(t, user, "a")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "file_quota_exceeded")
+}
@@ -0,0 +1,378 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// https://platform.openai.com/docs/api-reference/fine-tuning
+
+const fineTuningSyncInterval = time.Minute
+
+// fineTuningJobObject holds the fields of the upstream job tracked by one-api
+type fineTuningJobObject struct {
+	Id             string `json:"id"`
+	Model          string `json:"model"`
+	FineTunedModel string `json:"fine_tuned_model"`
+	Status         string `json:"status"`
+}
+
+// fineTuningUpstream sends the fine-tuning requests to one channel, the jobs only exist on the channel that created them
+type fineTuningUpstream struct {
+	channel *model.Channel
+	ctx     *gin.Context
+	meta    *meta.Meta
+	adaptor *openai.Adaptor
+}
+
+func isFineTuningChannel(channelType int) bool {
+	return channelType == channeltype.OpenAI || channelType == channeltype.Azure
+}
+
+// getFineTuningChannel picks a channel of the model among those supporting fine-tuning
+func getFineTuningChannel(group string, modelName string) (*model.Channel, error) {
+	channel, err := model.CacheGetRandomSatisfiedChannelOf(group, modelName, func(channel *model.Channel) bool {
+		return isFineTuningChannel(channel.Type)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no channel supporting fine-tuning for model %s in group %s", modelName, group)
+	}
+	return model.GetChannelById(channel.Id, true)
+}
+
+func newFineTuningUpstream(channel *model.Channel) *fineTuningUpstream {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+	}
+	middleware.SetupContextForSelectedChannel(c, channel, "")
+	upstream := &fineTuningUpstream{
+		channel: channel,
+		ctx:     c,
+		meta:    meta.GetByContext(c),
+		adaptor: &openai.Adaptor{},
+	}
+	upstream.meta.Mode = relaymode.FineTuning
+	upstream.adaptor.Init(upstream.meta)
+	return upstream
+}
+
+// getFineTuningUpstream loads the channel that created the job
+func getFineTuningUpstream(job *model.FineTuningJob) (*fineTuningUpstream, error) {
+	channel, err := model.GetChannelById(job.ChannelId, true)
+	if err != nil {
+		return nil, fmt.Errorf("the channel #%d of the fine-tuning job no longer exists", job.ChannelId)
+	}
+	return newFineTuningUpstream(channel), nil
+}
+
+func (u *fineTuningUpstream) do(method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	u.meta.RequestURLPath = path
+	fullRequestURL, err := u.adaptor.GetRequestURL(u.meta)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, fullRequestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if err = u.adaptor.SetupRequestHeader(u.ctx, req, u.meta); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	return client.HTTPClient.Do(req)
+}
+
+// uploadFile copies a file stored by one-api to the channel, the channel only knows its own files
+func (u *fineTuningUpstream) uploadFile(file *model.File) (string, error) {
+	reader, err := storage.Get().Open(file.Id)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err = writer.WriteField("purpose", "fine-tune"); err != nil {
+		return "", err
+	}
+	part, err := writer.CreateFormFile("file", file.Filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(part, reader); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", err
+	}
+	resp, err := u.do(http.MethodPost, "/v1/files", &body, writer.FormDataContentType())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var uploaded struct {
+		Id string `json:"id"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(responseBody, &uploaded) != nil || uploaded.Id == "" {
+		return "", fmt.Errorf("upload file %s to channel #%d failed: status code %d, %s", file.Id, u.channel.Id, resp.StatusCode, string(responseBody))
+	}
+	return uploaded.Id, nil
+}
+
+// forward sends a request to the channel and copies the response to the client, the body is returned on success
+func (u *fineTuningUpstream) forward(c *gin.Context, method string, path string, body io.Reader) ([]byte, bool) {
+	resp, err := u.do(method, path, body, "application/json")
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "fine-tuning request to channel #%d failed: %s", u.channel.Id, err.Error())
+		openAIError(c, http.StatusBadGateway, "do_request_failed", err.Error())
+		return nil, false
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		openAIError(c, http.StatusBadGateway, "read_response_body_failed", err.Error())
+		return nil, false
+	}
+	c.Data(resp.StatusCode, "application/json", responseBody)
+	return responseBody, resp.StatusCode == http.StatusOK
+}
+
+// syncFineTuningJob saves the job returned by the channel. The fine-tuned model of a succeeded job is registered
+// as an ability of that channel only, and Distribute serves it to the owner of the job only.
+func syncFineTuningJob(job *model.FineTuningJob, responseBody []byte) {
+	var object fineTuningJobObject
+	if err := json.Unmarshal(responseBody, &object); err != nil || object.Id != job.Id {
+		return
+	}
+	job.Status = object.Status
+	job.FineTunedModel = object.FineTunedModel
+	job.Job = string(responseBody)
+	if err := job.Update(); err != nil {
+		logger.SysError(fmt.Sprintf("failed to update fine-tuning job %s: %s", job.Id, err.Error()))
+	}
+	if job.Status == "succeeded" && job.FineTunedModel != "" {
+		if err := job.AddAbilities(); err != nil {
+			logger.SysError(fmt.Sprintf("failed to add model %s to channel #%d: %s", job.FineTunedModel, job.ChannelId, err.Error()))
+		}
+	}
+}
+
+func getOwnedFineTuningJob(c *gin.Context) (*model.FineTuningJob, *fineTuningUpstream, bool) {
+	jobId := c.Param("id")
+	job, err := model.GetFineTuningJobById(jobId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No fine-tuning job found with id '%s'.", jobId))
+		return nil, nil, false
+	}
+	upstream, err := getFineTuningUpstream(job)
+	if err != nil {
+		openAIError(c, http.StatusServiceUnavailable, "channel_not_found", err.Error())
+		return nil, nil, false
+	}
+	return job, upstream, true
+}
+
+func CreateFineTuningJob(c *gin.Context) {
+	var request map[string]any
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	channel, err := model.GetChannelById(c.GetInt(ctxkey.ChannelId), true)
+	if err != nil {
+		openAIError(c, http.StatusServiceUnavailable, "channel_not_found", err.Error())
+		return
+	}
+	modelName, _ := request["model"].(string)
+	if _, ok := c.Get(ctxkey.SpecificChannelId); !ok && !isFineTuningChannel(channel.Type) {
+		// Distribute picks among the channels of any type serving the model
+		channel, err = getFineTuningChannel(c.GetString(ctxkey.Group), modelName)
+		if err != nil {
+			openAIError(c, http.StatusServiceUnavailable, "channel_not_found", err.Error())
+			return
+		}
+	}
+	if !isFineTuningChannel(channel.Type) {
+		openAIError(c, http.StatusBadRequest, "fine_tuning_not_supported", fmt.Sprintf("fine-tuning is not supported by channel type %d", channel.Type))
+		return
+	}
+	if mappedName, ok := modelpattern.Map(modelName, channel.GetModelMapping()); ok {
+		request["model"] = mappedName
+	}
+	upstream := newFineTuningUpstream(channel)
+	userId, tokenId := c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId)
+	for _, field := range []string{"training_file", "validation_file"} {
+		fileId, _ := request[field].(string)
+		if fileId == "" {
+			continue
+		}
+		// the files uploaded through /v1/files are kept by one-api, the other ids are files of the channel
+		file, err := model.GetFileById(fileId, userId, tokenId)
+		if err != nil {
+			continue
+		}
+		if request[field], err = upstream.uploadFile(file); err != nil {
+			logger.Errorf(c.Request.Context(), "%s", err.Error())
+			openAIError(c, http.StatusBadGateway, "upload_file_failed", err.Error())
+			return
+		}
+	}
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "marshal_request_failed", err.Error())
+		return
+	}
+	responseBody, ok := upstream.forward(c, http.MethodPost, "/v1/fine_tuning/jobs", bytes.NewReader(jsonData))
+	if !ok {
+		return
+	}
+	var object fineTuningJobObject
+	if err = json.Unmarshal(responseBody, &object); err != nil || object.Id == "" {
+		logger.Errorf(c.Request.Context(), "invalid fine-tuning job returned by channel #%d: %s", channel.Id, string(responseBody))
+		return
+	}
+	job := &model.FineTuningJob{
+		Id:             object.Id,
+		UserId:         userId,
+		TokenId:        tokenId,
+		ChannelId:      channel.Id,
+		Model:          object.Model,
+		FineTunedModel: object.FineTunedModel,
+		Status:         object.Status,
+		Job:            string(responseBody),
+	}
+	if err = job.Insert(); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save fine-tuning job %s: %s", job.Id, err.Error())
+	}
+}
+
+func ListFineTuningJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	jobs, err := model.GetFineTuningJobs(c.GetInt(ctxkey.Id), c.Query("after"), limit+1)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_fine_tuning_jobs_failed", err.Error())
+		return
+	}
+	hasMore := len(jobs) > limit
+	if hasMore {
+		jobs = jobs[:limit]
+	}
+	data := make([]json.RawMessage, 0, len(jobs))
+	for _, job := range jobs {
+		data = append(data, json.RawMessage(job.Job))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	})
+}
+
+func RetrieveFineTuningJob(c *gin.Context) {
+	job, upstream, ok := getOwnedFineTuningJob(c)
+	if !ok {
+		return
+	}
+	if responseBody, ok := upstream.forward(c, http.MethodGet, "/v1/fine_tuning/jobs/"+job.Id, nil); ok {
+		syncFineTuningJob(job, responseBody)
+	}
+}
+
+func CancelFineTuningJob(c *gin.Context) {
+	job, upstream, ok := getOwnedFineTuningJob(c)
+	if !ok {
+		return
+	}
+	if responseBody, ok := upstream.forward(c, http.MethodPost, "/v1/fine_tuning/jobs/"+job.Id+"/cancel", nil); ok {
+		syncFineTuningJob(job, responseBody)
+	}
+}
+
+// ListFineTuningJobEvents also serves the checkpoints, both are passed through with their pagination
+func ListFineTuningJobEvents(c *gin.Context) {
+	job, upstream, ok := getOwnedFineTuningJob(c)
+	if !ok {
+		return
+	}
+	path := "/v1/fine_tuning/jobs/" + job.Id + "/events"
+	if c.FullPath() == "/v1/fine_tuning/jobs/:id/checkpoints" {
+		path = "/v1/fine_tuning/jobs/" + job.Id + "/checkpoints"
+	}
+	if c.Request.URL.RawQuery != "" {
+		path += "?" + c.Request.URL.RawQuery
+	}
+	upstream.forward(c, http.MethodGet, path, nil)
+}
+
+// StartFineTuningJobSync polls the channels for the jobs that are not finished, so that the fine-tuned
+// models are registered even if their owner never retrieves the job, it must only be called on the master node.
+func StartFineTuningJobSync() {
+	go func() {
+		for {
+			time.Sleep(fineTuningSyncInterval)
+			jobs, err := model.GetActiveFineTuningJobs()
+			if err != nil {
+				logger.SysError("failed to get active fine-tuning jobs: " + err.Error())
+				continue
+			}
+			for _, job := range jobs {
+				if err = refreshFineTuningJob(job); err != nil {
+					logger.SysError(fmt.Sprintf("failed to refresh fine-tuning job %s: %s", job.Id, err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+func refreshFineTuningJob(job *model.FineTuningJob) error {
+	upstream, err := getFineTuningUpstream(job)
+	if err != nil {
+		return err
+	}
+	resp, err := upstream.do(http.MethodGet, "/v1/fine_tuning/jobs/"+job.Id, nil, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(string(responseBody))
+	}
+	syncFineTuningJob(job, responseBody)
+	return nil
+}
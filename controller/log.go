@@ -122,6 +122,27 @@ func GetLogsStat(c *gin.Context) {
 	return
 }
 
+// GetLogsMargin reports the margin of each model of each channel, the quota charged minus the upstream cost
+func GetLogsMargin(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	margins, err := model.GetChannelModelMargins(startTimestamp, endTimestamp, channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    margins,
+	})
+	return
+}
+
 func GetLogsSelfStat(c *gin.Context) {
 	username := c.GetString(ctxkey.Username)
 	logType, _ := strconv.Atoi(c.Query("type"))
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// TestMain runs the tests against a fresh SQLite database
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "one-api-controller")
+	if err != nil {
+		panic(err)
+	}
+	common.RedisEnabled = false
+	// the token encoders are downloaded on first use
+	config.ApproximateTokenEnabled = true
+	client.Init()
+	common.SQLitePath = filepath.Join(dir, "one-api.db")
+	model.InitDB()
+	model.InitLogDB()
+	config.FileStoragePath = filepath.Join(dir, "files")
+	if err = storage.Init(); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = model.CloseDB()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestRelay creates a user with a token and a channel serving the model from the upstream,
+// the name identifies the fixture and is used as the model so that the tests don't share channels
+func newTestRelay(t *testing.T, name string, upstream http.HandlerFunc) (*model.User, *model.Token, *model.Channel) {
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	user := &model.User{Username: name, Password: "password", Group: "default", Quota: 100000000, AccessToken: name, AffCode: name}
+	assert.NoError(t, model.DB.Create(user).Error)
+	// the dashes of a key separate the channel asked for
+	token := &model.Token{UserId: user.Id, Key: strings.ReplaceAll(name, "-", ""), Name: name, Status: model.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	assert.NoError(t, token.Insert())
+	baseURL := server.URL
+	channel := &model.Channel{Name: name, Type: channeltype.OpenAI, Key: "sk-" + name, BaseURL: &baseURL, Models: name,
+		Group: "default", Status: model.ChannelStatusEnabled}
+	assert.NoError(t, channel.Insert())
+	return user, token, channel
+}
@@ -6,13 +6,16 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/model"
 	relay "github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // https://platform.openai.com/docs/api-reference/models/list
@@ -129,23 +132,52 @@ func ListAllModels(c *gin.Context) {
 	})
 }
 
-func ListModels(c *gin.Context) {
-	ctx := c.Request.Context()
-	var availableModels []string
+// getAvailableModels returns the models of the token, or those of the group of the user
+func getAvailableModels(c *gin.Context) []string {
 	if c.GetString(ctxkey.AvailableModels) != "" {
-		availableModels = strings.Split(c.GetString(ctxkey.AvailableModels), ",")
-	} else {
-		userId := c.GetInt(ctxkey.Id)
-		userGroup, _ := model.CacheGetUserGroup(userId)
-		availableModels, _ = model.CacheGetGroupModels(ctx, userGroup)
+		return expandModelPatterns(strings.Split(c.GetString(ctxkey.AvailableModels), ","))
+	}
+	userId := c.GetInt(ctxkey.Id)
+	userGroup, _ := model.CacheGetUserGroup(userId)
+	availableModels, _ := model.CacheGetGroupModels(c.Request.Context(), userGroup)
+	// the fine-tuned models are left out of the models of the group, only their owner can use them
+	fineTunedModels, _ := model.GetFineTunedModels(userId)
+	return expandModelPatterns(append(availableModels, fineTunedModels...))
+}
+
+// expandModelPatterns replaces the patterns with the known models they match, so that clients get real names
+func expandModelPatterns(modelNames []string) []string {
+	expanded := make([]string, 0, len(modelNames))
+	seen := make(map[string]bool)
+	add := func(modelName string) {
+		if !seen[modelName] {
+			seen[modelName] = true
+			expanded = append(expanded, modelName)
+		}
 	}
+	for _, modelName := range modelNames {
+		if !modelpattern.IsPattern(modelName) {
+			add(modelName)
+			continue
+		}
+		for _, knownModel := range models {
+			if modelpattern.Match(modelName, knownModel.Id) {
+				add(knownModel.Id)
+			}
+		}
+	}
+	return expanded
+}
+
+func ListModels(c *gin.Context) {
+	availableModels := getAvailableModels(c)
 	modelSet := make(map[string]bool)
 	for _, availableModel := range availableModels {
 		modelSet[availableModel] = true
 	}
 	availableOpenAIModels := make([]OpenAIModels, 0)
 	for _, model := range models {
-		if _, ok := modelSet[model.Id]; ok {
+		if modelSet[model.Id] {
 			modelSet[model.Id] = false
 			availableOpenAIModels = append(availableOpenAIModels, model)
 		}
@@ -168,6 +200,25 @@ func ListModels(c *gin.Context) {
 	})
 }
 
+// ListOllamaModels serves /api/tags of the Ollama API
+func ListOllamaModels(c *gin.Context) {
+	modifiedAt := time.Unix(1626777600, 0).UTC().Format(time.RFC3339)
+	tags := make([]ollama.ModelTag, 0)
+	for _, modelName := range getAvailableModels(c) {
+		tags = append(tags, ollama.ModelTag{
+			Name:       modelName,
+			Model:      modelName,
+			ModifiedAt: modifiedAt,
+			Details: ollama.ModelDetails{
+				Families: []string{},
+			},
+		})
+	}
+	c.JSON(http.StatusOK, ollama.TagsResponse{
+		Models: tags,
+	})
+}
+
 func RetrieveModel(c *gin.Context) {
 	modelId := c.Param("model")
 	if model, ok := modelsMap[modelId]; ok {
@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// openAIError writes an error in the format of the OpenAI API, with the invalid_request_error type
+func openAIError(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": relaymodel.Error{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
@@ -16,6 +17,8 @@ import (
 	"github.com/songquanpeng/one-api/middleware"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -26,7 +29,9 @@ import (
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations,
+		relaymode.ImagesEdits,
+		relaymode.ImagesVariations:
 		err = controller.RelayImageHelper(c, relayMode)
 	case relaymode.AudioSpeech:
 		fallthrough
@@ -36,6 +41,18 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayAudioHelper(c, relayMode)
 	case relaymode.Proxy:
 		err = controller.RelayProxyHelper(c, relayMode)
+	case relaymode.ClaudeMessages:
+		err = controller.RelayClaudeMessagesHelper(c)
+	case relaymode.GeminiGenerateContent:
+		err = controller.RelayGeminiHelper(c)
+	case relaymode.Responses:
+		err = controller.RelayResponsesHelper(c)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
+	case relaymode.Realtime:
+		err = controller.RelayRealtimeHelper(c)
+	case relaymode.Ollama:
+		err = controller.RelayOllamaHelper(c)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -51,16 +68,22 @@ func Relay(c *gin.Context) {
 	}
 	channelId := c.GetInt(ctxkey.ChannelId)
 	userId := c.GetInt(ctxkey.Id)
+	recorder := &firstWriteRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	start := time.Now()
 	bizErr := relayHelper(c, relayMode)
+	recordRelayResult(c, relayMode, start, recorder, bizErr)
 	if bizErr == nil {
 		monitor.Emit(channelId, true)
+		bindStickySession(c)
 		return
 	}
 	lastFailedChannelId := channelId
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+	fallbackFrom := c.GetString(ctxkey.FallbackFrom)
+	go processChannelRelayError(ctx, userId, channelId, channelName, originalModel, c.GetString(ctxkey.KeyFingerprint), *bizErr)
 	requestId := c.GetString(helper.RequestIdKey)
 	retryTimes := config.RetryTimes
 	if !shouldRetry(c, bizErr.StatusCode) {
@@ -68,7 +91,7 @@ func Relay(c *gin.Context) {
 		retryTimes = 0
 	}
 	for i := retryTimes; i > 0; i-- {
-		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes)
+		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes, nil)
 		if err != nil {
 			logger.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %+v", err)
 			break
@@ -77,25 +100,149 @@ func Relay(c *gin.Context) {
 		if channel.Id == lastFailedChannelId {
 			continue
 		}
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
-		requestBody, err := common.GetRequestBody(c)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-		bizErr = relayHelper(c, relayMode)
+		if fallbackFrom != "" {
+			middleware.SetupContextForFallbackModel(c, channel, fallbackFrom, originalModel)
+		} else {
+			middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		}
+		bizErr = relayAttempt(c, relayMode, recorder)
 		if bizErr == nil {
+			bindStickySession(c)
 			return
 		}
 		channelId := c.GetInt(ctxkey.ChannelId)
 		lastFailedChannelId = channelId
 		channelName := c.GetString(ctxkey.ChannelName)
-		go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+		go processChannelRelayError(ctx, userId, channelId, channelName, c.GetString(ctxkey.OriginalModel), c.GetString(ctxkey.KeyFingerprint), *bizErr)
+	}
+	if bizErr != nil && shouldRetry(c, bizErr.StatusCode) {
+		// the channels of the model are exhausted, the fallback models are tried once each
+		requestModel := originalModel
+		if fallbackFrom != "" {
+			requestModel = fallbackFrom
+		}
+		for _, fallbackModel := range getRemainingFallbacks(requestModel, originalModel) {
+			if !middleware.IsModelAvailable(c, fallbackModel) {
+				continue
+			}
+			channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, fallbackModel, false, nil)
+			if err != nil {
+				continue
+			}
+			logger.Infof(ctx, "falling back to model %s on channel #%d", fallbackModel, channel.Id)
+			middleware.SetupContextForFallbackModel(c, channel, requestModel, fallbackModel)
+			bizErr = relayAttempt(c, relayMode, recorder)
+			if bizErr == nil {
+				bindStickySession(c)
+				return
+			}
+			go processChannelRelayError(ctx, userId, channel.Id, channel.Name, c.GetString(ctxkey.OriginalModel), c.GetString(ctxkey.KeyFingerprint), *bizErr)
+			if !shouldRetry(c, bizErr.StatusCode) {
+				break
+			}
+		}
 	}
 	if bizErr != nil {
+		c.Writer.Header().Del(helper.FallbackModelKey)
 		if bizErr.StatusCode == http.StatusTooManyRequests {
 			bizErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
 		}
 
 		// BUG: bizErr is in race condition
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		renderRelayError(c, relayMode, bizErr)
+	}
+}
+
+// relayAttempt relays the request again to the channel set up in the context
+func relayAttempt(c *gin.Context, relayMode int, recorder *firstWriteRecorder) *model.ErrorWithStatusCode {
+	requestBody, _ := common.GetRequestBody(c)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	recorder.firstWrite = time.Time{}
+	start := time.Now()
+	bizErr := relayHelper(c, relayMode)
+	recordRelayResult(c, relayMode, start, recorder, bizErr)
+	return bizErr
+}
+
+// getRemainingFallbacks returns the fallback models of the requested model that come after the current one
+func getRemainingFallbacks(requestModel string, currentModel string) []string {
+	fallbacks := dbmodel.GetModelFallbacks(requestModel)
+	for i, fallbackModel := range fallbacks {
+		if fallbackModel == currentModel {
+			return fallbacks[i+1:]
+		}
+	}
+	return fallbacks
+}
+
+// bindStickySession binds the session of the request to the channel and key that served it
+func bindStickySession(c *gin.Context) {
+	dbmodel.SetStickySession(c.GetString(ctxkey.StickySessionKey), dbmodel.StickySession{
+		ChannelId:      c.GetInt(ctxkey.ChannelId),
+		KeyFingerprint: c.GetString(ctxkey.KeyFingerprint),
+	})
+}
+
+// firstWriteRecorder notes when the response starts, which is the time to first token of the streams
+type firstWriteRecorder struct {
+	gin.ResponseWriter
+	firstWrite time.Time
+}
+
+func (w *firstWriteRecorder) Write(data []byte) (int, error) {
+	if w.firstWrite.IsZero() {
+		w.firstWrite = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *firstWriteRecorder) WriteString(s string) (int, error) {
+	if w.firstWrite.IsZero() {
+		w.firstWrite = time.Now()
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// recordRelayResult feeds the outcome of a request to the circuit breaker and the health of the channel key,
+// and its latency to the adaptive channel selection
+func recordRelayResult(c *gin.Context, relayMode int, start time.Time, recorder *firstWriteRecorder, bizErr *model.ErrorWithStatusCode) {
+	var ttft, latency time.Duration
+	// the duration of a realtime session says nothing about the channel
+	if relayMode != relaymode.Realtime {
+		latency = time.Since(start)
+		ttft = latency
+		if !recorder.firstWrite.IsZero() {
+			ttft = recorder.firstWrite.Sub(start)
+		}
+	}
+	controller.RecordChannelResult(c.GetInt(ctxkey.ChannelId), c.GetString(ctxkey.OriginalModel), c.GetString(ctxkey.KeyFingerprint), bizErr, ttft, latency)
+}
+
+// renderRelayError writes the error in the format expected by the client of the inbound API
+func renderRelayError(c *gin.Context, relayMode int, bizErr *model.ErrorWithStatusCode) {
+	switch relayMode {
+	case relaymode.ClaudeMessages:
+		c.JSON(bizErr.StatusCode, anthropic.ErrorResponse{
+			Type: "error",
+			Error: anthropic.Error{
+				Type:    bizErr.Error.Type,
+				Message: bizErr.Error.Message,
+			},
+		})
+	case relaymode.GeminiGenerateContent:
+		c.JSON(bizErr.StatusCode, gemini.ErrorResponse{
+			Error: gemini.Error{
+				Code:    bizErr.StatusCode,
+				Message: bizErr.Error.Message,
+				Status:  gemini.ErrorStatus(bizErr.StatusCode),
+			},
+		})
+	case relaymode.Ollama:
+		c.JSON(bizErr.StatusCode, gin.H{
+			"error": bizErr.Error.Message,
+		})
+	default:
 		c.JSON(bizErr.StatusCode, gin.H{
 			"error": bizErr.Error,
 		})
@@ -121,12 +268,15 @@ func shouldRetry(c *gin.Context, statusCode int) bool {
 	return true
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, err model.ErrorWithStatusCode) {
+func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, modelName string, keyFingerprint string, err model.ErrorWithStatusCode) {
 	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
 	// https://platform.openai.com/docs/guides/error-codes/api-errors
-	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
-		monitor.DisableChannel(channelId, channelName, err.Message)
-	} else {
+	if monitor.ShouldDisableAbility(&err.Error, err.StatusCode) {
+		// the other models of the channel keep working, its success rate is left alone
+		monitor.DisableAbility(channelId, channelName, modelName, err.Message)
+	} else if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
+		monitor.DisableChannelOrKey(channelId, channelName, keyFingerprint, err.Message)
+	} else if !controller.IsRateLimited(channelId, &err) {
 		monitor.Emit(channelId, false)
 	}
 }
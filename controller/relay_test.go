@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	dbmodel "github.com/songquanpeng/one-api/model"
+)
+
+func TestGetRemainingFallbacks(t *testing.T) {
+	err := dbmodel.UpdateModelFallbacksByJSONString(`{"gpt-4o":["gpt-4o-mini","claude-3-5-sonnet","gemini-1.5-pro"]}`)
+	assert.NoError(t, err)
+	defer dbmodel.UpdateModelFallbacksByJSONString("{}")
+	cases := []struct {
+		name         string
+		requestModel string
+		currentModel string
+		expected     []string
+	}{
+		{"requested model", "gpt-4o", "gpt-4o", []string{"gpt-4o-mini", "claude-3-5-sonnet", "gemini-1.5-pro"}},
+		{"first fallback", "gpt-4o", "gpt-4o-mini", []string{"claude-3-5-sonnet", "gemini-1.5-pro"}},
+		{"last fallback", "gpt-4o", "gemini-1.5-pro", []string{}},
+		{"no fallbacks", "gpt-4o-mini", "gpt-4o-mini", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, getRemainingFallbacks(c.requestModel, c.currentModel))
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/responses/get
+
+func responseNotFound(c *gin.Context, responseId string) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": relaymodel.Error{
+			Message: fmt.Sprintf("Response with id '%s' not found.", responseId),
+			Type:    "invalid_request_error",
+			Param:   "response_id",
+			Code:    "not_found",
+		},
+	})
+}
+
+func RetrieveResponse(c *gin.Context) {
+	responseId := c.Param("id")
+	record, err := model.GetResponseRecordById(responseId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		responseNotFound(c, responseId)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(record.Response))
+}
+
+func DeleteResponse(c *gin.Context) {
+	responseId := c.Param("id")
+	rowsAffected, err := model.DeleteResponseRecordById(responseId, c.GetInt(ctxkey.Id))
+	if err != nil || rowsAffected == 0 {
+		responseNotFound(c, responseId)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      responseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
@@ -0,0 +1,415 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// runEmitter receives the events of a streamed run
+type runEmitter func(event string, data any)
+
+const runPollInterval = 5 * time.Second
+
+var (
+	// runEngine sends the chat completions of the runs through the same middlewares as the relay router,
+	// so that they may use any channel and are billed to the token that created the run
+	runEngine     *gin.Engine
+	runEngineOnce sync.Once
+	runNotify     = make(chan struct{}, 1)
+	runRunning    sync.Map
+)
+
+// StartRunWorkers executes the runs queued without streaming, it must only be called on the master node.
+// A streamed run is executed by the request that started it and is never queued.
+func StartRunWorkers() {
+	resumeInterruptedRuns()
+	go func() {
+		for {
+			runs, err := model.GetRunsByStatus(model.RunStatusQueued)
+			if err != nil {
+				logger.SysError("failed to get queued runs: " + err.Error())
+			}
+			for _, run := range runs {
+				if _, running := runRunning.LoadOrStore(run.Id, true); !running {
+					go workRun(run)
+				}
+			}
+			select {
+			case <-runNotify:
+			case <-time.After(runPollInterval):
+			}
+		}
+	}()
+	logger.SysLog("run workers started")
+}
+
+// notifyRunWorkers makes the master node pick up a queued run without waiting for the next poll
+func notifyRunWorkers() {
+	select {
+	case runNotify <- struct{}{}:
+	default:
+	}
+}
+
+// resumeInterruptedRuns queues again the runs left executing by a restart, their pending chat completion
+// is sent again, and completes the cancellations that were waiting for it
+func resumeInterruptedRuns() {
+	runs, err := model.GetRunsByStatus(model.RunStatusInProgress, model.RunStatusCancelling)
+	if err != nil {
+		logger.SysError("failed to get interrupted runs: " + err.Error())
+		return
+	}
+	for _, run := range runs {
+		if run.Status == model.RunStatusCancelling {
+			finishRun(run, nil, func(string, any) {})
+			continue
+		}
+		if _, err = model.UpdateRunStatus(run.Id, []string{model.RunStatusInProgress}, map[string]any{"status": model.RunStatusQueued}); err != nil {
+			logger.SysError(fmt.Sprintf("failed to resume run %s: %s", run.Id, err.Error()))
+		}
+	}
+}
+
+// workRun executes a queued run unless it expired or was picked up by another executor
+func workRun(run *model.Run) {
+	defer runRunning.Delete(run.Id)
+	expireRun(run)
+	if claimRun(run) {
+		executeRun(run, nil)
+	}
+}
+
+// claimRun moves a queued run to in_progress, only the executor that moved it executes the run
+func claimRun(run *model.Run) bool {
+	startedAt := run.StartedAt
+	if startedAt == 0 {
+		startedAt = helper.GetTimestamp()
+	}
+	claimed, err := model.UpdateRunStatus(run.Id, []string{model.RunStatusQueued}, map[string]any{
+		"status":     model.RunStatusInProgress,
+		"started_at": startedAt,
+	})
+	if err != nil || !claimed {
+		return false
+	}
+	run.Status = model.RunStatusInProgress
+	run.StartedAt = startedAt
+	return true
+}
+
+func getRunEngine() *gin.Engine {
+	runEngineOnce.Do(func() {
+		runEngine = gin.New()
+		runEngine.POST("/v1/chat/completions", middleware.RequestId(), middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute(), Relay)
+	})
+	return runEngine
+}
+
+// toChatContent converts the content of a thread message to the content of a chat message
+func toChatContent(content []threadMessageContent) any {
+	if len(content) == 1 && content[0].Text != nil {
+		return content[0].Text.Value
+	}
+	var parts []relaymodel.MessageContent
+	for _, part := range content {
+		switch {
+		case part.Text != nil:
+			parts = append(parts, relaymodel.MessageContent{Type: relaymodel.ContentTypeText, Text: part.Text.Value})
+		case part.ImageURL != nil:
+			parts = append(parts, relaymodel.MessageContent{Type: relaymodel.ContentTypeImageURL, ImageURL: part.ImageURL})
+		}
+	}
+	return parts
+}
+
+// buildRunMessages turns the thread history and the tool calls already made by the run into chat messages
+func buildRunMessages(run *model.Run) ([]relaymodel.Message, error) {
+	var messages []relaymodel.Message
+	if run.Instructions != "" {
+		messages = append(messages, relaymodel.Message{Role: "system", Content: run.Instructions})
+	}
+	history, err := model.GetThreadHistory(run.ThreadId, run.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range history {
+		var content []threadMessageContent
+		_ = json.Unmarshal([]byte(message.Content), &content)
+		messages = append(messages, relaymodel.Message{Role: message.Role, Content: toChatContent(content)})
+	}
+	steps, err := model.GetAllRunSteps(run.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		if step.Type != model.RunStepTypeToolCalls || step.Status != model.RunStatusCompleted {
+			continue
+		}
+		var details runStepDetails
+		_ = json.Unmarshal([]byte(step.StepDetails), &details)
+		assistantMessage := relaymodel.Message{Role: "assistant", Content: ""}
+		var toolMessages []relaymodel.Message
+		for _, toolCall := range details.ToolCalls {
+			assistantMessage.ToolCalls = append(assistantMessage.ToolCalls, relaymodel.Tool{
+				Id:   toolCall.Id,
+				Type: toolCall.Type,
+				Function: relaymodel.Function{
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				},
+			})
+			output := ""
+			if toolCall.Function.Output != nil {
+				output = *toolCall.Function.Output
+			}
+			toolMessages = append(toolMessages, relaymodel.Message{Role: "tool", ToolCallId: toolCall.Id, Content: output})
+		}
+		messages = append(messages, assistantMessage)
+		messages = append(messages, toolMessages...)
+	}
+	return messages, nil
+}
+
+func buildRunRequest(run *model.Run) ([]byte, error) {
+	messages, err := buildRunMessages(run)
+	if err != nil {
+		return nil, err
+	}
+	request := relaymodel.GeneralOpenAIRequest{
+		Model:       run.Model,
+		Messages:    messages,
+		Temperature: run.Temperature,
+		TopP:        run.TopP,
+	}
+	if tools := unmarshalTools(run.Tools); len(tools) > 0 {
+		request.Tools = tools
+		if !run.ParallelToolCalls {
+			request.ParallelTooCalls = &run.ParallelToolCalls
+		}
+		if run.ToolChoice != "" {
+			_ = json.Unmarshal([]byte(run.ToolChoice), &request.ToolChoice)
+		}
+	}
+	if run.ResponseFormat != "" {
+		request.ResponseFormat = &relaymodel.ResponseFormat{}
+		_ = json.Unmarshal([]byte(run.ResponseFormat), request.ResponseFormat)
+	}
+	if run.MaxCompletionTokens > 0 {
+		request.MaxCompletionTokens = &run.MaxCompletionTokens
+	}
+	return json.Marshal(request)
+}
+
+// requestRunCompletion sends the chat completion of the run, the error is returned as the last error of the run
+func requestRunCompletion(ctx context.Context, run *model.Run) (*openai.TextResponse, *runLastError) {
+	token, err := model.GetTokenById(run.TokenId)
+	if err != nil {
+		return nil, &runLastError{Code: "server_error", Message: "The token that created the run no longer exists."}
+	}
+	body, err := buildRunRequest(run)
+	if err != nil {
+		return nil, &runLastError{Code: "server_error", Message: err.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, &runLastError{Code: "server_error", Message: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	w := httptest.NewRecorder()
+	getRunEngine().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		var errorResponse struct {
+			Error relaymodel.Error `json:"error"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		lastError := &runLastError{Code: "server_error", Message: errorResponse.Error.Message}
+		if w.Code == http.StatusTooManyRequests {
+			lastError.Code = "rate_limit_exceeded"
+		}
+		if lastError.Message == "" {
+			lastError.Message = fmt.Sprintf("The chat completion failed with status code %d.", w.Code)
+		}
+		return nil, lastError
+	}
+	var response openai.TextResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil || len(response.Choices) == 0 {
+		return nil, &runLastError{Code: "server_error", Message: "The chat completion returned an invalid response."}
+	}
+	return &response, nil
+}
+
+func toolCallArguments(arguments any) string {
+	if s, ok := arguments.(string); ok {
+		return s
+	}
+	if arguments == nil {
+		return "{}"
+	}
+	jsonBytes, _ := json.Marshal(arguments)
+	return string(jsonBytes)
+}
+
+// finishRun moves the run out of in_progress, a run cancelled meanwhile ends up cancelled instead,
+// nil updates only complete the cancellation
+func finishRun(run *model.Run, updates map[string]any, emit runEmitter) {
+	var finished bool
+	var err error
+	if updates != nil {
+		finished, err = model.UpdateRunStatus(run.Id, []string{model.RunStatusInProgress}, updates)
+	}
+	if err == nil && !finished {
+		finished, err = model.UpdateRunStatus(run.Id, []string{model.RunStatusCancelling}, map[string]any{
+			"status":       model.RunStatusCancelled,
+			"cancelled_at": helper.GetTimestamp(),
+		})
+		if finished {
+			_ = model.CloseRunSteps(run.Id, model.RunStatusCancelled, "cancelled_at")
+		}
+	}
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to update run %s: %s", run.Id, err.Error()))
+	}
+	updatedRun, err := model.GetRunByIdOnly(run.Id)
+	if err != nil {
+		return
+	}
+	expireRun(updatedRun)
+	emit("thread.run."+updatedRun.Status, toOpenAIRun(updatedRun))
+}
+
+func failRun(run *model.Run, lastError *runLastError, emit runEmitter) {
+	logger.SysLog(fmt.Sprintf("run %s failed: %s", run.Id, lastError.Message))
+	finishRun(run, map[string]any{
+		"status":     model.RunStatusFailed,
+		"failed_at":  helper.GetTimestamp(),
+		"last_error": marshalRunLastError(lastError.Code, lastError.Message),
+	}, emit)
+	_ = model.CloseRunSteps(run.Id, model.RunStatusFailed, "failed_at")
+}
+
+// executeRun sends one chat completion for a run in progress, the run either pauses for the tool outputs
+// or completes with a new message of the assistant
+func executeRun(run *model.Run, emit runEmitter) {
+	if emit == nil {
+		emit = func(string, any) {}
+	}
+	emit("thread.run.in_progress", toOpenAIRun(run))
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(run.ExpiresAt, 0))
+	defer cancel()
+	response, lastError := requestRunCompletion(ctx, run)
+	if lastError != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			finishRun(run, map[string]any{"status": model.RunStatusExpired}, emit)
+			_ = model.CloseRunSteps(run.Id, model.RunStatusExpired, "expired_at")
+			return
+		}
+		failRun(run, lastError, emit)
+		return
+	}
+	err := model.AddRunUsage(run.Id, response.PromptTokens, response.CompletionTokens)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to update usage of run %s: %s", run.Id, err.Error()))
+	}
+	// the run cancelled during the chat completion keeps the usage but not the output
+	if current, err := model.GetRunByIdOnly(run.Id); err == nil && current.Status == model.RunStatusCancelling {
+		finishRun(run, nil, emit)
+		return
+	}
+
+	choice := response.Choices[0]
+	step := &model.RunStep{
+		Id:               newAssistantObjectId("step_"),
+		UserId:           run.UserId,
+		RunId:            run.Id,
+		ThreadId:         run.ThreadId,
+		AssistantId:      run.AssistantId,
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+	}
+	if len(choice.ToolCalls) > 0 {
+		details := runStepDetails{Type: model.RunStepTypeToolCalls}
+		requiredAction := runRequiredAction{Type: "submit_tool_outputs"}
+		for _, toolCall := range choice.ToolCalls {
+			arguments := toolCallArguments(toolCall.Function.Arguments)
+			details.ToolCalls = append(details.ToolCalls, runStepToolCall{
+				Id:       toolCall.Id,
+				Type:     "function",
+				Function: runStepFunction{Name: toolCall.Function.Name, Arguments: arguments},
+			})
+			requiredAction.SubmitToolOutputs.ToolCalls = append(requiredAction.SubmitToolOutputs.ToolCalls, relaymodel.Tool{
+				Id:       toolCall.Id,
+				Type:     "function",
+				Function: relaymodel.Function{Name: toolCall.Function.Name, Arguments: arguments},
+			})
+		}
+		detailsBytes, _ := json.Marshal(details)
+		step.Type = model.RunStepTypeToolCalls
+		step.Status = model.RunStatusInProgress
+		step.StepDetails = string(detailsBytes)
+		if err = step.Insert(); err != nil {
+			failRun(run, &runLastError{Code: "server_error", Message: err.Error()}, emit)
+			return
+		}
+		emit("thread.run.step.created", toOpenAIRunStep(step))
+		actionBytes, _ := json.Marshal(requiredAction)
+		finishRun(run, map[string]any{
+			"status":          model.RunStatusRequiresAction,
+			"required_action": string(actionBytes),
+		}, emit)
+		return
+	}
+
+	content, _ := json.Marshal([]threadMessageContent{{
+		Type: relaymodel.ContentTypeText,
+		Text: &threadMessageText{Value: choice.StringContent(), Annotations: []any{}},
+	}})
+	message := &model.ThreadMessage{
+		Id:          newAssistantObjectId("msg_"),
+		UserId:      run.UserId,
+		ThreadId:    run.ThreadId,
+		Role:        "assistant",
+		Content:     string(content),
+		AssistantId: run.AssistantId,
+		RunId:       run.Id,
+	}
+	if err = message.Insert(); err != nil {
+		failRun(run, &runLastError{Code: "server_error", Message: err.Error()}, emit)
+		return
+	}
+	emit("thread.message.created", toOpenAIThreadMessage(message))
+	emit("thread.message.completed", toOpenAIThreadMessage(message))
+	detailsBytes, _ := json.Marshal(runStepDetails{
+		Type:            model.RunStepTypeMessageCreation,
+		MessageCreation: &runStepMessageCreation{MessageId: message.Id},
+	})
+	step.Type = model.RunStepTypeMessageCreation
+	step.Status = model.RunStatusCompleted
+	step.StepDetails = string(detailsBytes)
+	step.CompletedAt = helper.GetTimestamp()
+	if err = step.Insert(); err != nil {
+		logger.SysError(fmt.Sprintf("failed to save step of run %s: %s", run.Id, err.Error()))
+	}
+	emit("thread.run.step.created", toOpenAIRunStep(step))
+	emit("thread.run.step.completed", toOpenAIRunStep(step))
+	finishRun(run, map[string]any{
+		"status":       model.RunStatusCompleted,
+		"completed_at": helper.GetTimestamp(),
+	}, emit)
+}
@@ -0,0 +1,614 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/runs
+// https://platform.openai.com/docs/api-reference/run-steps
+
+// runExpiration is the time given to a run, including the time spent waiting for the tool outputs
+const runExpiration = 10 * time.Minute
+
+type runLastError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type runUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type runRequiredAction struct {
+	Type              string `json:"type"`
+	SubmitToolOutputs struct {
+		ToolCalls []relaymodel.Tool `json:"tool_calls"`
+	} `json:"submit_tool_outputs"`
+}
+
+type runStepFunction struct {
+	Name      string  `json:"name"`
+	Arguments string  `json:"arguments"`
+	Output    *string `json:"output"`
+}
+
+type runStepToolCall struct {
+	Id       string          `json:"id"`
+	Type     string          `json:"type"`
+	Function runStepFunction `json:"function"`
+}
+
+type runStepMessageCreation struct {
+	MessageId string `json:"message_id"`
+}
+
+type runStepDetails struct {
+	Type            string                  `json:"type"`
+	MessageCreation *runStepMessageCreation `json:"message_creation,omitempty"`
+	ToolCalls       []runStepToolCall       `json:"tool_calls,omitempty"`
+}
+
+type OpenAIRun struct {
+	Id                  string             `json:"id"`
+	Object              string             `json:"object"`
+	CreatedAt           int64              `json:"created_at"`
+	ThreadId            string             `json:"thread_id"`
+	AssistantId         string             `json:"assistant_id"`
+	Status              string             `json:"status"`
+	RequiredAction      *runRequiredAction `json:"required_action"`
+	LastError           *runLastError      `json:"last_error"`
+	ExpiresAt           *int64             `json:"expires_at"`
+	StartedAt           *int64             `json:"started_at"`
+	CancelledAt         *int64             `json:"cancelled_at"`
+	FailedAt            *int64             `json:"failed_at"`
+	CompletedAt         *int64             `json:"completed_at"`
+	IncompleteDetails   any                `json:"incomplete_details"`
+	Model               string             `json:"model"`
+	Instructions        string             `json:"instructions"`
+	Tools               []relaymodel.Tool  `json:"tools"`
+	Metadata            map[string]string  `json:"metadata"`
+	Usage               *runUsage          `json:"usage"`
+	Temperature         *float64           `json:"temperature"`
+	TopP                *float64           `json:"top_p"`
+	MaxPromptTokens     *int               `json:"max_prompt_tokens"`
+	MaxCompletionTokens *int               `json:"max_completion_tokens"`
+	TruncationStrategy  gin.H              `json:"truncation_strategy"`
+	ResponseFormat      json.RawMessage    `json:"response_format"`
+	ToolChoice          json.RawMessage    `json:"tool_choice"`
+	ParallelToolCalls   bool               `json:"parallel_tool_calls"`
+}
+
+type OpenAIRunStep struct {
+	Id          string         `json:"id"`
+	Object      string         `json:"object"`
+	CreatedAt   int64          `json:"created_at"`
+	AssistantId string         `json:"assistant_id"`
+	ThreadId    string         `json:"thread_id"`
+	RunId       string         `json:"run_id"`
+	Type        string         `json:"type"`
+	Status      string         `json:"status"`
+	StepDetails runStepDetails `json:"step_details"`
+	LastError   *runLastError  `json:"last_error"`
+	ExpiredAt   *int64         `json:"expired_at"`
+	CancelledAt *int64         `json:"cancelled_at"`
+	FailedAt    *int64         `json:"failed_at"`
+	CompletedAt *int64         `json:"completed_at"`
+	Metadata    map[string]any `json:"metadata"`
+	Usage       *runUsage      `json:"usage"`
+}
+
+type runRequest struct {
+	AssistantId            string                 `json:"assistant_id"`
+	Model                  string                 `json:"model"`
+	Instructions           *string                `json:"instructions"`
+	AdditionalInstructions string                 `json:"additional_instructions"`
+	AdditionalMessages     []threadMessageRequest `json:"additional_messages"`
+	Tools                  *[]relaymodel.Tool     `json:"tools"`
+	Metadata               map[string]string      `json:"metadata"`
+	Temperature            *float64               `json:"temperature"`
+	TopP                   *float64               `json:"top_p"`
+	Stream                 bool                   `json:"stream"`
+	MaxCompletionTokens    int                    `json:"max_completion_tokens"`
+	ResponseFormat         json.RawMessage        `json:"response_format"`
+	ToolChoice             json.RawMessage        `json:"tool_choice"`
+	ParallelToolCalls      *bool                  `json:"parallel_tool_calls"`
+	// only used by /v1/threads/runs
+	Thread *threadRequest `json:"thread"`
+}
+
+func isRunActive(status string) bool {
+	for _, activeStatus := range model.RunActiveStatuses {
+		if status == activeStatus {
+			return true
+		}
+	}
+	return false
+}
+
+func marshalRunLastError(code string, message string) string {
+	jsonBytes, _ := json.Marshal(runLastError{Code: code, Message: message})
+	return string(jsonBytes)
+}
+
+func toOpenAIRun(run *model.Run) OpenAIRun {
+	openAIRun := OpenAIRun{
+		Id:                 run.Id,
+		Object:             "thread.run",
+		CreatedAt:          run.CreatedAt,
+		ThreadId:           run.ThreadId,
+		AssistantId:        run.AssistantId,
+		Status:             run.Status,
+		StartedAt:          nullableTime(run.StartedAt),
+		CancelledAt:        nullableTime(run.CancelledAt),
+		FailedAt:           nullableTime(run.FailedAt),
+		CompletedAt:        nullableTime(run.CompletedAt),
+		Model:              run.Model,
+		Instructions:       run.Instructions,
+		Tools:              unmarshalTools(run.Tools),
+		Metadata:           unmarshalMetadata(run.Metadata),
+		Temperature:        run.Temperature,
+		TopP:               run.TopP,
+		TruncationStrategy: gin.H{"type": "auto", "last_messages": nil},
+		ResponseFormat:     unmarshalResponseFormat(run.ResponseFormat),
+		ToolChoice:         json.RawMessage(`"auto"`),
+		ParallelToolCalls:  run.ParallelToolCalls,
+	}
+	if isRunActive(run.Status) {
+		openAIRun.ExpiresAt = nullableTime(run.ExpiresAt)
+	} else {
+		openAIRun.Usage = &runUsage{
+			PromptTokens:     run.PromptTokens,
+			CompletionTokens: run.CompletionTokens,
+			TotalTokens:      run.PromptTokens + run.CompletionTokens,
+		}
+	}
+	if run.RequiredAction != "" && run.Status == model.RunStatusRequiresAction {
+		openAIRun.RequiredAction = &runRequiredAction{}
+		_ = json.Unmarshal([]byte(run.RequiredAction), openAIRun.RequiredAction)
+	}
+	if run.LastError != "" {
+		openAIRun.LastError = &runLastError{}
+		_ = json.Unmarshal([]byte(run.LastError), openAIRun.LastError)
+	}
+	if run.ToolChoice != "" {
+		openAIRun.ToolChoice = json.RawMessage(run.ToolChoice)
+	}
+	if run.MaxCompletionTokens > 0 {
+		openAIRun.MaxCompletionTokens = &run.MaxCompletionTokens
+	}
+	return openAIRun
+}
+
+func toOpenAIRunStep(step *model.RunStep) OpenAIRunStep {
+	openAIStep := OpenAIRunStep{
+		Id:          step.Id,
+		Object:      "thread.run.step",
+		CreatedAt:   step.CreatedAt,
+		AssistantId: step.AssistantId,
+		ThreadId:    step.ThreadId,
+		RunId:       step.RunId,
+		Type:        step.Type,
+		Status:      step.Status,
+		ExpiredAt:   nullableTime(step.ExpiredAt),
+		CancelledAt: nullableTime(step.CancelledAt),
+		FailedAt:    nullableTime(step.FailedAt),
+		CompletedAt: nullableTime(step.CompletedAt),
+		Metadata:    map[string]any{},
+	}
+	_ = json.Unmarshal([]byte(step.StepDetails), &openAIStep.StepDetails)
+	if step.LastError != "" {
+		openAIStep.LastError = &runLastError{}
+		_ = json.Unmarshal([]byte(step.LastError), openAIStep.LastError)
+	}
+	if step.Status != model.RunStatusInProgress {
+		openAIStep.Usage = &runUsage{
+			PromptTokens:     step.PromptTokens,
+			CompletionTokens: step.CompletionTokens,
+			TotalTokens:      step.PromptTokens + step.CompletionTokens,
+		}
+	}
+	return openAIStep
+}
+
+// expireRun closes the runs that are still active after their expiration, the runs are expired
+// lazily when they are read because nothing is running for a run waiting for the tool outputs
+func expireRun(run *model.Run) {
+	if !isRunActive(run.Status) || run.ExpiresAt > helper.GetTimestamp() {
+		return
+	}
+	expired, err := model.UpdateRunStatus(run.Id, model.RunActiveStatuses, map[string]any{"status": model.RunStatusExpired})
+	if err != nil || !expired {
+		return
+	}
+	run.Status = model.RunStatusExpired
+	_ = model.CloseRunSteps(run.Id, model.RunStatusExpired, "expired_at")
+}
+
+func getOwnedRun(c *gin.Context, thread *model.Thread) (*model.Run, bool) {
+	runId := c.Param("runId")
+	run, err := model.GetRunById(runId, thread.Id, thread.UserId)
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No run found with id '%s'.", runId))
+		return nil, false
+	}
+	expireRun(run)
+	return run, true
+}
+
+// getOwnedThreadRun loads the thread and the run addressed by the path
+func getOwnedThreadRun(c *gin.Context) (*model.Run, bool) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return nil, false
+	}
+	return getOwnedRun(c, thread)
+}
+
+// newRun builds a run from the assistant, the fields of the request override the ones of the assistant
+func newRun(c *gin.Context, request *runRequest, threadId string) (*model.Run, error) {
+	if request.AssistantId == "" {
+		return nil, errors.New("missing required parameter: 'assistant_id'")
+	}
+	assistant, err := model.GetAssistantById(request.AssistantId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		return nil, fmt.Errorf("no assistant found with id '%s'", request.AssistantId)
+	}
+	run := &model.Run{
+		Id:                  newAssistantObjectId("run_"),
+		UserId:              assistant.UserId,
+		TokenId:             c.GetInt(ctxkey.TokenId),
+		ThreadId:            threadId,
+		AssistantId:         assistant.Id,
+		Model:               assistant.Model,
+		Instructions:        assistant.Instructions,
+		Tools:               assistant.Tools,
+		ParallelToolCalls:   true,
+		ResponseFormat:      assistant.ResponseFormat,
+		Temperature:         assistant.Temperature,
+		TopP:                assistant.TopP,
+		MaxCompletionTokens: request.MaxCompletionTokens,
+		Status:              model.RunStatusQueued,
+		Metadata:            marshalMetadata(request.Metadata),
+		ExpiresAt:           time.Now().Add(runExpiration).Unix(),
+	}
+	if request.Model != "" {
+		run.Model = request.Model
+	}
+	if request.Instructions != nil {
+		run.Instructions = *request.Instructions
+	}
+	if request.AdditionalInstructions != "" {
+		if run.Instructions != "" {
+			run.Instructions += "\n\n"
+		}
+		run.Instructions += request.AdditionalInstructions
+	}
+	if request.Tools != nil {
+		if run.Tools, err = marshalTools(*request.Tools); err != nil {
+			return nil, err
+		}
+	}
+	if request.ResponseFormat != nil {
+		run.ResponseFormat = marshalResponseFormat(request.ResponseFormat)
+	}
+	if request.Temperature != nil {
+		run.Temperature = request.Temperature
+	}
+	if request.TopP != nil {
+		run.TopP = request.TopP
+	}
+	if request.ParallelToolCalls != nil {
+		run.ParallelToolCalls = *request.ParallelToolCalls
+	}
+	if len(request.ToolChoice) > 0 && string(request.ToolChoice) != "null" && string(request.ToolChoice) != `"auto"` {
+		run.ToolChoice = string(request.ToolChoice)
+	}
+	if request.MaxCompletionTokens < 0 {
+		return nil, errors.New("max_completion_tokens must not be negative")
+	}
+	return run, nil
+}
+
+// startRun saves the run with its additional messages and executes it
+func startRun(c *gin.Context, request *runRequest, run *model.Run) {
+	messages := make([]*model.ThreadMessage, 0, len(request.AdditionalMessages))
+	for i := range request.AdditionalMessages {
+		message, err := newThreadMessage(&request.AdditionalMessages[i], run.ThreadId, run.UserId)
+		if err != nil {
+			openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		messages = append(messages, message)
+	}
+	for _, message := range messages {
+		if err := message.Insert(); err != nil {
+			openAIError(c, http.StatusInternalServerError, "create_message_failed", err.Error())
+			return
+		}
+	}
+	if request.Stream {
+		// the streamed run is executed by this request, it is saved in progress so that the workers leave it alone
+		run.Status = model.RunStatusInProgress
+		run.StartedAt = helper.GetTimestamp()
+	}
+	if err := run.Insert(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "create_run_failed", err.Error())
+		return
+	}
+	dispatchRun(c, run, request.Stream)
+}
+
+// dispatchRun leaves a queued run to the run workers of the master node, a streamed run is already
+// in progress and is executed within the request so that its events can be sent
+func dispatchRun(c *gin.Context, run *model.Run, stream bool) {
+	if !stream {
+		c.JSON(http.StatusOK, toOpenAIRun(run))
+		notifyRunWorkers()
+		return
+	}
+	common.SetEventStreamHeaders(c)
+	emit := func(event string, data any) {
+		jsonData, _ := json.Marshal(data)
+		_, _ = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, jsonData)
+		c.Writer.Flush()
+	}
+	queuedRun := *run
+	queuedRun.Status = model.RunStatusQueued
+	emit("thread.run.created", toOpenAIRun(&queuedRun))
+	emit("thread.run.queued", toOpenAIRun(&queuedRun))
+	executeRun(run, emit)
+	_, _ = fmt.Fprint(c.Writer, "event: done\ndata: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+func CreateRun(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	var request runRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if run := getActiveRun(thread.Id); run != nil {
+		openAIError(c, http.StatusBadRequest, "run_active", fmt.Sprintf("Thread %s already has an active run %s.", thread.Id, run.Id))
+		return
+	}
+	run, err := newRun(c, &request, thread.Id)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	startRun(c, &request, run)
+}
+
+func CreateThreadAndRun(c *gin.Context) {
+	var request runRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if request.Thread == nil {
+		request.Thread = &threadRequest{}
+	}
+	// the run is validated before the thread is created, the thread id is filled in afterward
+	run, err := newRun(c, &request, "")
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	thread, err := createThread(request.Thread, c.GetInt(ctxkey.Id))
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	run.ThreadId = thread.Id
+	startRun(c, &request, run)
+}
+
+func ListRuns(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	limit, after, asc := getListParams(c)
+	runs, err := model.GetRuns(thread.Id, thread.UserId, after, limit+1, asc)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_runs_failed", err.Error())
+		return
+	}
+	data := make([]OpenAIRun, 0, len(runs))
+	for _, run := range runs {
+		expireRun(run)
+		data = append(data, toOpenAIRun(run))
+	}
+	writeList(c, data, limit, func(run OpenAIRun) string { return run.Id })
+}
+
+func RetrieveRun(c *gin.Context) {
+	run, ok := getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIRun(run))
+}
+
+func ModifyRun(c *gin.Context) {
+	run, ok := getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if request.Metadata != nil {
+		run.Metadata = marshalMetadata(request.Metadata)
+		if err := run.UpdateMetadata(); err != nil {
+			openAIError(c, http.StatusInternalServerError, "modify_run_failed", err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, toOpenAIRun(run))
+}
+
+func SubmitToolOutputs(c *gin.Context) {
+	run, ok := getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		ToolOutputs []struct {
+			ToolCallId string `json:"tool_call_id"`
+			Output     string `json:"output"`
+		} `json:"tool_outputs"`
+		Stream bool `json:"stream"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if run.Status != model.RunStatusRequiresAction {
+		openAIError(c, http.StatusBadRequest, "invalid_run_status", fmt.Sprintf("Runs in status \"%s\" do not accept tool outputs.", run.Status))
+		return
+	}
+	step, err := model.GetPendingToolCallsStep(run.Id)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_run_status", "The run has no pending tool calls.")
+		return
+	}
+	var details runStepDetails
+	_ = json.Unmarshal([]byte(step.StepDetails), &details)
+	outputs := make(map[string]string)
+	for _, toolOutput := range request.ToolOutputs {
+		outputs[toolOutput.ToolCallId] = toolOutput.Output
+	}
+	for i := range details.ToolCalls {
+		output, ok := outputs[details.ToolCalls[i].Id]
+		if !ok {
+			openAIError(c, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Expected tool outputs for call_ids %s, got none.", details.ToolCalls[i].Id))
+			return
+		}
+		details.ToolCalls[i].Function.Output = &output
+		delete(outputs, details.ToolCalls[i].Id)
+	}
+	for toolCallId := range outputs {
+		openAIError(c, http.StatusBadRequest, "invalid_request", fmt.Sprintf("Tool call '%s' is not pending on this run.", toolCallId))
+		return
+	}
+	// the status guards against the concurrent submissions and cancellations, the run is held
+	// in progress until its tool outputs are saved
+	resumed, err := model.UpdateRunStatus(run.Id, []string{model.RunStatusRequiresAction}, map[string]any{
+		"status":          model.RunStatusInProgress,
+		"required_action": "",
+	})
+	if err != nil || !resumed {
+		openAIError(c, http.StatusBadRequest, "invalid_run_status", "The run is no longer waiting for tool outputs.")
+		return
+	}
+	jsonBytes, _ := json.Marshal(details)
+	step.StepDetails = string(jsonBytes)
+	step.Status = model.RunStatusCompleted
+	step.CompletedAt = helper.GetTimestamp()
+	if err = step.Update(); err != nil {
+		failRun(run, &runLastError{Code: "server_error", Message: err.Error()}, func(string, any) {})
+		openAIError(c, http.StatusInternalServerError, "submit_tool_outputs_failed", err.Error())
+		return
+	}
+	run.Status = model.RunStatusInProgress
+	run.RequiredAction = ""
+	if !request.Stream {
+		queued, err := model.UpdateRunStatus(run.Id, []string{model.RunStatusInProgress}, map[string]any{"status": model.RunStatusQueued})
+		if err != nil || !queued {
+			// the run was cancelled meanwhile
+			finishRun(run, nil, func(string, any) {})
+			run, _ = model.GetRunByIdOnly(run.Id)
+			c.JSON(http.StatusOK, toOpenAIRun(run))
+			return
+		}
+		run.Status = model.RunStatusQueued
+	}
+	dispatchRun(c, run, request.Stream)
+}
+
+func CancelRun(c *gin.Context) {
+	run, ok := getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	now := helper.GetTimestamp()
+	// the runs that are not executing are cancelled at once, the executing ones are cancelled
+	// by their executor once the pending chat completion returns
+	cancelled, err := model.UpdateRunStatus(run.Id, []string{model.RunStatusQueued, model.RunStatusRequiresAction}, map[string]any{
+		"status":       model.RunStatusCancelled,
+		"cancelled_at": now,
+	})
+	if err == nil && cancelled {
+		_ = model.CloseRunSteps(run.Id, model.RunStatusCancelled, "cancelled_at")
+	} else if err == nil {
+		cancelled, err = model.UpdateRunStatus(run.Id, []string{model.RunStatusInProgress}, map[string]any{"status": model.RunStatusCancelling})
+	}
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "cancel_run_failed", err.Error())
+		return
+	}
+	if !cancelled {
+		openAIError(c, http.StatusBadRequest, "invalid_run_status", fmt.Sprintf("Cannot cancel run with status '%s'.", run.Status))
+		return
+	}
+	run, ok = getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIRun(run))
+}
+
+func ListRunSteps(c *gin.Context) {
+	run, ok := getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	limit, after, asc := getListParams(c)
+	steps, err := model.GetRunSteps(run.Id, run.UserId, after, limit+1, asc)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_run_steps_failed", err.Error())
+		return
+	}
+	data := make([]OpenAIRunStep, 0, len(steps))
+	for _, step := range steps {
+		data = append(data, toOpenAIRunStep(step))
+	}
+	writeList(c, data, limit, func(step OpenAIRunStep) string { return step.Id })
+}
+
+func RetrieveRunStep(c *gin.Context) {
+	run, ok := getOwnedThreadRun(c)
+	if !ok {
+		return
+	}
+	stepId := c.Param("stepId")
+	step, err := model.GetRunStepById(stepId, run.Id, run.UserId)
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No run step found with id '%s'.", stepId))
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIRunStep(step))
+}
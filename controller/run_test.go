@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func writeTestCompletion(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{"id":"chatcmpl-test","object":"chat.completion","created":1,"model":"test","choices":[{"index":0,"message":`+
+		message+`,"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`)
+}
+
+// newTestRun queues a run of the model on a new thread holding one message of the user
+func newTestRun(t *testing.T, user *model.User, token *model.Token, runModel string) *model.Run {
+	thread := &model.Thread{Id: newAssistantObjectId("thread_"), UserId: user.Id}
+	assert.NoError(t, thread.Insert())
+	message := &model.ThreadMessage{Id: newAssistantObjectId("msg_"), UserId: user.Id, ThreadId: thread.Id, Role: "user",
+		Content: `[{"type":"text","text":{"value":"What is the weather?","annotations":[]}}]`}
+	assert.NoError(t, message.Insert())
+	run := &model.Run{Id: newAssistantObjectId("run_"), UserId: user.Id, TokenId: token.Id, ThreadId: thread.Id, Model: runModel,
+		Tools:  `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]`,
+		Status: model.RunStatusQueued, ExpiresAt: time.Now().Add(runExpiration).Unix()}
+	assert.NoError(t, run.Insert())
+	return run
+}
+
+func getTestRun(t *testing.T, id string) *model.Run {
+	run, err := model.GetRunByIdOnly(id)
+	assert.NoError(t, err)
+	return run
+}
+
+func TestExecuteRun(t *testing.T) {
+	user, token, _ := newTestRelay(t, "run-completed", func(w http.ResponseWriter, r *http.Request) {
+		writeTestCompletion(w, `{"role":"assistant","content":"It is sunny."}`)
+	})
+	run := newTestRun(t, user, token, "run-completed")
+	workRun(run)
+
+	run = getTestRun(t, run.Id)
+	assert.Equal(t, model.RunStatusCompleted, run.Status)
+	assert.NotZero(t, run.StartedAt)
+	assert.NotZero(t, run.CompletedAt)
+	assert.Equal(t, 5, run.PromptTokens)
+	assert.Equal(t, 2, run.CompletionTokens)
+	steps, err := model.GetAllRunSteps(run.Id)
+	assert.NoError(t, err)
+	if assert.Len(t, steps, 1) {
+		assert.Equal(t, model.RunStepTypeMessageCreation, steps[0].Type)
+		assert.Equal(t, model.RunStatusCompleted, steps[0].Status)
+	}
+	messages, err := model.GetThreadMessages(run.ThreadId, user.Id, run.Id, "", 20, true)
+	assert.NoError(t, err)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "assistant", messages[0].Role)
+		assert.Contains(t, messages[0].Content, "It is sunny.")
+	}
+
+	// a run that is not queued any more is left alone
+	workRun(run)
+	assert.Equal(t, model.RunStatusCompleted, getTestRun(t, run.Id).Status)
+}
+
+func TestExecuteRunFailed(t *testing.T) {
+	user, token, _ := newTestRelay(t, "run-failed", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"error":{"message":"bad request","type":"invalid_request_error"}}`)
+	})
+	run := newTestRun(t, user, token, "run-failed")
+	workRun(run)
+
+	run = getTestRun(t, run.Id)
+	assert.Equal(t, model.RunStatusFailed, run.Status)
+	assert.NotZero(t, run.FailedAt)
+	assert.Contains(t, run.LastError, "bad request")
+}
+
+func TestRunToolCalls(t *testing.T) {
+	var requests []string
+	user, token, _ := newTestRelay(t, "run-tools", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, string(body))
+		if len(requests) == 1 {
+			writeTestCompletion(w, `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`)
+			return
+		}
+		writeTestCompletion(w, `{"role":"assistant","content":"It is sunny in Paris."}`)
+	})
+	run := newTestRun(t, user, token, "run-tools")
+	workRun(run)
+
+	run = getTestRun(t, run.Id)
+	assert.Equal(t, model.RunStatusRequiresAction, run.Status)
+	var requiredAction runRequiredAction
+	assert.NoError(t, json.Unmarshal([]byte(run.RequiredAction), &requiredAction))
+	assert.Equal(t, "submit_tool_outputs", requiredAction.Type)
+	if assert.Len(t, requiredAction.SubmitToolOutputs.ToolCalls, 1) {
+		assert.Equal(t, "call_1", requiredAction.SubmitToolOutputs.ToolCalls[0].Id)
+		assert.Equal(t, `{"city":"Paris"}`, requiredAction.SubmitToolOutputs.ToolCalls[0].Function.Arguments)
+	}
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/threads/"+run.ThreadId+"/runs/"+run.Id+"/submit_tool_outputs", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: run.ThreadId}, {Key: "runId", Value: run.Id}}
+		c.Set(ctxkey.Id, user.Id)
+		SubmitToolOutputs(c)
+		return w
+	}
+	// the outputs must answer every pending call
+	w := submit(`{"tool_outputs":[{"tool_call_id":"call_2","output":"20C"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, model.RunStatusRequiresAction, getTestRun(t, run.Id).Status)
+
+	// the run is queued for the workers
+	w = submit(`{"tool_outputs":[{"tool_call_id":"call_1","output":"20C"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"queued"`)
+	run = getTestRun(t, run.Id)
+	assert.Equal(t, model.RunStatusQueued, run.Status)
+	assert.Empty(t, run.RequiredAction)
+	// a second submission is refused
+	w = submit(`{"tool_outputs":[{"tool_call_id":"call_1","output":"20C"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	workRun(run)
+	run = getTestRun(t, run.Id)
+	assert.Equal(t, model.RunStatusCompleted, run.Status)
+	assert.Equal(t, 10, run.PromptTokens)
+	// the tool call and its output are sent back to the model
+	if assert.Len(t, requests, 2) {
+		assert.Contains(t, requests[1], `"tool_call_id":"call_1"`)
+		assert.Contains(t, requests[1], `"content":"20C"`)
+	}
+	steps, err := model.GetAllRunSteps(run.Id)
+	assert.NoError(t, err)
+	if assert.Len(t, steps, 2) {
+		assert.Equal(t, model.RunStepTypeToolCalls, steps[0].Type)
+		assert.Equal(t, model.RunStatusCompleted, steps[0].Status)
+		assert.Contains(t, steps[0].StepDetails, `"output":"20C"`)
+		assert.Equal(t, model.RunStepTypeMessageCreation, steps[1].Type)
+	}
+}
+
+func TestRunExpiry(t *testing.T) {
+	var calls atomic.Int32
+	user, token, _ := newTestRelay(t, "run-expiry", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// the chat completion outlasts the run
+		select {
+		case <-r.Context().Done():
+		case <-time.After(3 * time.Second):
+		}
+		writeTestCompletion(w, `{"role":"assistant","content":"Too late."}`)
+	})
+
+	// a run that expired in the queue is not executed
+	run := newTestRun(t, user, token, "run-expiry")
+	assert.NoError(t, model.DB.Model(run).Update("expires_at", time.Now().Add(-time.Second).Unix()).Error)
+	run = getTestRun(t, run.Id)
+	workRun(run)
+	assert.Equal(t, model.RunStatusExpired, getTestRun(t, run.Id).Status)
+	assert.Zero(t, calls.Load())
+
+	// a run expiring during its chat completion is expired without its answer
+	run = newTestRun(t, user, token, "run-expiry")
+	assert.NoError(t, model.DB.Model(run).Update("expires_at", time.Now().Add(time.Second).Unix()).Error)
+	run = getTestRun(t, run.Id)
+	start := time.Now()
+	workRun(run)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, model.RunStatusExpired, getTestRun(t, run.Id).Status)
+	messages, err := model.GetThreadMessages(run.ThreadId, user.Id, run.Id, "", 20, true)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestResumeInterruptedRuns(t *testing.T) {
+	user, token, _ := newTestRelay(t, "run-resume", func(w http.ResponseWriter, r *http.Request) {
+		writeTestCompletion(w, `{"role":"assistant","content":"Resumed."}`)
+	})
+	interrupted := newTestRun(t, user, token, "run-resume")
+	assert.True(t, claimRun(interrupted))
+	cancelling := newTestRun(t, user, token, "run-resume")
+	assert.True(t, claimRun(cancelling))
+	_, err := model.UpdateRunStatus(cancelling.Id, []string{model.RunStatusInProgress}, map[string]any{"status": model.RunStatusCancelling})
+	assert.NoError(t, err)
+
+	resumeInterruptedRuns()
+	run := getTestRun(t, interrupted.Id)
+	assert.Equal(t, model.RunStatusQueued, run.Status)
+	// the run keeps the time it started at
+	assert.Equal(t, interrupted.StartedAt, run.StartedAt)
+	assert.Equal(t, model.RunStatusCancelled, getTestRun(t, cancelling.Id).Status)
+
+	workRun(run)
+	assert.Equal(t, model.RunStatusCompleted, getTestRun(t, run.Id).Status)
+}
@@ -0,0 +1,346 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/threads
+// https://platform.openai.com/docs/api-reference/messages
+
+type OpenAIThread struct {
+	Id            string            `json:"id"`
+	Object        string            `json:"object"`
+	CreatedAt     int64             `json:"created_at"`
+	ToolResources map[string]any    `json:"tool_resources"`
+	Metadata      map[string]string `json:"metadata"`
+}
+
+type threadMessageText struct {
+	Value       string `json:"value"`
+	Annotations []any  `json:"annotations"`
+}
+
+type threadMessageContent struct {
+	Type     string               `json:"type"`
+	Text     *threadMessageText   `json:"text,omitempty"`
+	ImageURL *relaymodel.ImageURL `json:"image_url,omitempty"`
+}
+
+type OpenAIThreadMessage struct {
+	Id                string                 `json:"id"`
+	Object            string                 `json:"object"`
+	CreatedAt         int64                  `json:"created_at"`
+	ThreadId          string                 `json:"thread_id"`
+	Status            string                 `json:"status"`
+	IncompleteDetails any                    `json:"incomplete_details"`
+	CompletedAt       int64                  `json:"completed_at"`
+	IncompleteAt      *int64                 `json:"incomplete_at"`
+	Role              string                 `json:"role"`
+	Content           []threadMessageContent `json:"content"`
+	AssistantId       *string                `json:"assistant_id"`
+	RunId             *string                `json:"run_id"`
+	Attachments       []any                  `json:"attachments"`
+	Metadata          map[string]string      `json:"metadata"`
+}
+
+type threadMessageRequest struct {
+	Role     string            `json:"role"`
+	Content  json.RawMessage   `json:"content"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type threadRequest struct {
+	Messages []threadMessageRequest `json:"messages"`
+	Metadata map[string]string      `json:"metadata"`
+}
+
+func toOpenAIThread(thread *model.Thread) OpenAIThread {
+	return OpenAIThread{
+		Id:            thread.Id,
+		Object:        "thread",
+		CreatedAt:     thread.CreatedAt,
+		ToolResources: map[string]any{},
+		Metadata:      unmarshalMetadata(thread.Metadata),
+	}
+}
+
+func toOpenAIThreadMessage(message *model.ThreadMessage) OpenAIThreadMessage {
+	openAIMessage := OpenAIThreadMessage{
+		Id:          message.Id,
+		Object:      "thread.message",
+		CreatedAt:   message.CreatedAt,
+		ThreadId:    message.ThreadId,
+		Status:      "completed",
+		CompletedAt: message.CreatedAt,
+		Role:        message.Role,
+		Content:     make([]threadMessageContent, 0),
+		AssistantId: nullableString(message.AssistantId),
+		RunId:       nullableString(message.RunId),
+		Attachments: []any{},
+		Metadata:    unmarshalMetadata(message.Metadata),
+	}
+	_ = json.Unmarshal([]byte(message.Content), &openAIMessage.Content)
+	return openAIMessage
+}
+
+// parseThreadMessageContent accepts a string or a list of text and image_url parts
+func parseThreadMessageContent(raw json.RawMessage) ([]threadMessageContent, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []threadMessageContent{{Type: relaymodel.ContentTypeText, Text: &threadMessageText{Value: text, Annotations: []any{}}}}, nil
+	}
+	var parts []struct {
+		Type     string               `json:"type"`
+		Text     string               `json:"text"`
+		ImageURL *relaymodel.ImageURL `json:"image_url"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, errors.New("the content must be a string or a list of content parts")
+	}
+	var content []threadMessageContent
+	for _, part := range parts {
+		switch {
+		case part.Type == relaymodel.ContentTypeText:
+			content = append(content, threadMessageContent{Type: part.Type, Text: &threadMessageText{Value: part.Text, Annotations: []any{}}})
+		case part.Type == relaymodel.ContentTypeImageURL && part.ImageURL != nil && part.ImageURL.Url != "":
+			content = append(content, threadMessageContent{Type: part.Type, ImageURL: part.ImageURL})
+		default:
+			return nil, fmt.Errorf("unsupported content part type: '%s'", part.Type)
+		}
+	}
+	if len(content) == 0 {
+		return nil, errors.New("the content can not be empty")
+	}
+	return content, nil
+}
+
+// newThreadMessage validates a message sent by the client
+func newThreadMessage(request *threadMessageRequest, threadId string, userId int) (*model.ThreadMessage, error) {
+	if request.Role != "user" && request.Role != "assistant" {
+		return nil, fmt.Errorf("invalid role: '%s', the role must be 'user' or 'assistant'", request.Role)
+	}
+	content, err := parseThreadMessageContent(request.Content)
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, _ := json.Marshal(content)
+	return &model.ThreadMessage{
+		Id:       newAssistantObjectId("msg_"),
+		UserId:   userId,
+		ThreadId: threadId,
+		Role:     request.Role,
+		Content:  string(jsonBytes),
+		Metadata: marshalMetadata(request.Metadata),
+	}, nil
+}
+
+// createThread creates a thread with its initial messages
+func createThread(request *threadRequest, userId int) (*model.Thread, error) {
+	thread := &model.Thread{
+		Id:       newAssistantObjectId("thread_"),
+		UserId:   userId,
+		Metadata: marshalMetadata(request.Metadata),
+	}
+	messages := make([]*model.ThreadMessage, 0, len(request.Messages))
+	for i := range request.Messages {
+		message, err := newThreadMessage(&request.Messages[i], thread.Id, userId)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := thread.Insert(); err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		if err := message.Insert(); err != nil {
+			return nil, err
+		}
+	}
+	return thread, nil
+}
+
+func getOwnedThread(c *gin.Context) (*model.Thread, bool) {
+	threadId := c.Param("id")
+	thread, err := model.GetThreadById(threadId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No thread found with id '%s'.", threadId))
+		return nil, false
+	}
+	return thread, true
+}
+
+func getOwnedThreadMessage(c *gin.Context, thread *model.Thread) (*model.ThreadMessage, bool) {
+	messageId := c.Param("messageId")
+	message, err := model.GetThreadMessageById(messageId, thread.Id, thread.UserId)
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "not_found", fmt.Sprintf("No message found with id '%s'.", messageId))
+		return nil, false
+	}
+	return message, true
+}
+
+// getActiveRun returns the run of the thread that is not finished yet, nil if there is none
+func getActiveRun(threadId string) *model.Run {
+	run, err := model.GetActiveRun(threadId)
+	if err != nil {
+		return nil
+	}
+	return run
+}
+
+func CreateThread(c *gin.Context) {
+	var request threadRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	thread, err := createThread(&request, c.GetInt(ctxkey.Id))
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIThread(thread))
+}
+
+func RetrieveThread(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIThread(thread))
+}
+
+func ModifyThread(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if request.Metadata != nil {
+		thread.Metadata = marshalMetadata(request.Metadata)
+		if err := thread.UpdateMetadata(); err != nil {
+			openAIError(c, http.StatusInternalServerError, "modify_thread_failed", err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, toOpenAIThread(thread))
+}
+
+func DeleteThread(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	if run := getActiveRun(thread.Id); run != nil {
+		openAIError(c, http.StatusBadRequest, "run_active", fmt.Sprintf("Can't delete thread %s while a run %s is active.", thread.Id, run.Id))
+		return
+	}
+	if err := thread.Delete(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "delete_thread_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      thread.Id,
+		"object":  "thread.deleted",
+		"deleted": true,
+	})
+}
+
+func CreateThreadMessage(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	var request threadMessageRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if run := getActiveRun(thread.Id); run != nil {
+		openAIError(c, http.StatusBadRequest, "run_active", fmt.Sprintf("Can't add messages to %s while a run %s is active.", thread.Id, run.Id))
+		return
+	}
+	message, err := newThreadMessage(&request, thread.Id, thread.UserId)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err = message.Insert(); err != nil {
+		openAIError(c, http.StatusInternalServerError, "create_message_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIThreadMessage(message))
+}
+
+func ListThreadMessages(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	limit, after, asc := getListParams(c)
+	messages, err := model.GetThreadMessages(thread.Id, thread.UserId, c.Query("run_id"), after, limit+1, asc)
+	if err != nil {
+		openAIError(c, http.StatusBadRequest, "list_messages_failed", err.Error())
+		return
+	}
+	data := make([]OpenAIThreadMessage, 0, len(messages))
+	for _, message := range messages {
+		data = append(data, toOpenAIThreadMessage(message))
+	}
+	writeList(c, data, limit, func(message OpenAIThreadMessage) string { return message.Id })
+}
+
+func RetrieveThreadMessage(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	message, ok := getOwnedThreadMessage(c, thread)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIThreadMessage(message))
+}
+
+func ModifyThreadMessage(c *gin.Context) {
+	thread, ok := getOwnedThread(c)
+	if !ok {
+		return
+	}
+	message, ok := getOwnedThreadMessage(c, thread)
+	if !ok {
+		return
+	}
+	var request struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if request.Metadata != nil {
+		message.Metadata = marshalMetadata(request.Metadata)
+		if err := message.UpdateMetadata(); err != nil {
+			openAIError(c, http.StatusInternalServerError, "modify_message_failed", err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, toOpenAIThreadMessage(message))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -16,6 +17,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -83,6 +85,15 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if config.IsMasterNode && config.AbilityProbeFrequency > 0 {
+		go controller.AutomaticallyProbeAbilities(config.AbilityProbeFrequency)
+	}
+	if config.IsMasterNode && config.ChannelRecoveryInterval > 0 {
+		go controller.AutomaticallyRecoverChannels()
+	}
+	if config.IsMasterNode {
+		go model.WatchChannelSchedules(time.Minute)
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -93,6 +104,14 @@ func main() {
 	}
 	openai.InitTokenEncoders()
 	client.Init()
+	if err := storage.Init(); err != nil {
+		logger.FatalLog("failed to initialize file storage: " + err.Error())
+	}
+	if config.IsMasterNode {
+		controller.StartBatchWorkers()
+		controller.StartRunWorkers()
+		controller.StartFineTuningJobSync()
+	}
 
 	// Initialize i18n
 	if err := i18n.Init(); err != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/network"
@@ -92,6 +93,33 @@ func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		key := c.Request.Header.Get("Authorization")
+		if key == "" {
+			// Anthropic clients send the key in x-api-key
+			key = c.Request.Header.Get("x-api-key")
+		}
+		if key == "" {
+			// Google GenAI clients send the key in x-goog-api-key or the key query parameter
+			key = c.Request.Header.Get("x-goog-api-key")
+		}
+		if key == "" && websocket.IsWebSocketUpgrade(c.Request) {
+			// browsers can't set headers on websockets, the key is sent as a subprotocol
+			for _, protocol := range websocket.Subprotocols(c.Request) {
+				if strings.HasPrefix(protocol, "openai-insecure-api-key.") {
+					key = strings.TrimPrefix(protocol, "openai-insecure-api-key.")
+				}
+			}
+		}
+		if websocket.IsWebSocketUpgrade(c.Request) && !network.IsOriginAllowed(c.Request) {
+			// any web page may open a websocket with a key, only the allowed origins get a session
+			abortWithMessage(c, http.StatusForbidden, "不允许该来源的页面建立连接："+c.Request.Header.Get("Origin"))
+			return
+		}
+		if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
+			key = c.Query("key")
+			query := c.Request.URL.Query()
+			query.Del("key")
+			c.Request.URL.RawQuery = query.Encode()
+		}
 		key = strings.TrimPrefix(key, "Bearer ")
 		key = strings.TrimPrefix(key, "sk-")
 		parts := strings.Split(key, "-")
@@ -163,5 +191,17 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
+		return true
+	}
+	if c.Request.URL.Path == "/v1/responses" {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		return true
+	}
 	return false
 }
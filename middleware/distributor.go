@@ -4,13 +4,15 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
-	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 )
 
 type ModelRequest struct {
@@ -43,8 +45,27 @@ func Distribute() func(c *gin.Context) {
 			}
 		} else {
 			requestModel = c.GetString(ctxkey.RequestModel)
+			if job := getFineTuningJob(requestModel); job != nil && job.UserId != userId {
+				// 微调模型只注册在创建它的渠道上，且只属于创建它的用户
+				abortWithMessage(c, http.StatusForbidden, "无权使用该微调模型")
+				return
+			}
+			sessionKey := getStickySessionKey(c, userGroup, requestModel)
+			session := model.GetStickySession(sessionKey)
+			c.Set(ctxkey.StickySessionKey, sessionKey)
+			if session != nil {
+				c.Set(ctxkey.StickySession, session)
+			}
 			var err error
-			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false, session)
+			if err != nil && channel == nil {
+				if fallbackChannel, fallbackModel := getFallbackChannel(c, userGroup, requestModel); fallbackChannel != nil {
+					logger.Infof(ctx, "no channel for model %s, falling back to model %s", requestModel, fallbackModel)
+					SetupContextForFallbackModel(c, fallbackChannel, requestModel, fallbackModel)
+					c.Next()
+					return
+				}
+			}
 			if err != nil {
 				message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, requestModel)
 				if channel != nil {
@@ -61,6 +82,52 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+func getFineTuningJob(modelName string) *model.FineTuningJob {
+	if !strings.HasPrefix(modelName, "ft:") {
+		return nil
+	}
+	job, err := model.GetFineTuningJobByModel(modelName)
+	if err != nil {
+		return nil
+	}
+	return job
+}
+
+// getFallbackChannel picks a channel of the first model of the fallback chain that has one
+func getFallbackChannel(c *gin.Context, group string, requestModel string) (*model.Channel, string) {
+	for _, fallbackModel := range model.GetModelFallbacks(requestModel) {
+		if !IsModelAvailable(c, fallbackModel) {
+			continue
+		}
+		channel, err := model.CacheGetRandomSatisfiedChannel(group, fallbackModel, false, nil)
+		if err == nil {
+			return channel, fallbackModel
+		}
+	}
+	return nil, ""
+}
+
+// IsModelAvailable tells whether the token of the request may use the model
+func IsModelAvailable(c *gin.Context, modelName string) bool {
+	availableModels := c.GetString(ctxkey.AvailableModels)
+	return availableModels == "" || isModelInList(modelName, availableModels)
+}
+
+// SetupContextForFallbackModel relays the request for requestModel to a channel of fallbackModel.
+// The requested model is mapped to the fallback one, which is then billed at its own ratio.
+func SetupContextForFallbackModel(c *gin.Context, channel *model.Channel, requestModel string, fallbackModel string) {
+	SetupContextForSelectedChannel(c, channel, fallbackModel)
+	modelMapping := make(map[string]string)
+	for from, to := range channel.GetModelMapping() {
+		modelMapping[from] = to
+	}
+	modelMapping[requestModel], _ = modelpattern.Map(fallbackModel, channel.GetModelMapping())
+	c.Set(ctxkey.ModelMapping, modelMapping)
+	c.Set(ctxkey.FallbackFrom, requestModel)
+	c.Request = c.Request.WithContext(helper.SetFallbackFrom(c.Request.Context(), requestModel))
+	c.Header(helper.FallbackModelKey, fallbackModel)
+}
+
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
 	c.Set(ctxkey.Channel, channel.Type)
 	c.Set(ctxkey.ChannelId, channel.Id)
@@ -70,33 +137,17 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
 	c.Set(ctxkey.OriginalModel, modelName) // for retry
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
-	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
-	cfg, _ := channel.LoadConfig()
-	// this is for backward compatibility
-	if channel.Other != nil {
-		switch channel.Type {
-		case channeltype.Azure:
-			if cfg.APIVersion == "" {
-				cfg.APIVersion = *channel.Other
-			}
-		case channeltype.Xunfei:
-			if cfg.APIVersion == "" {
-				cfg.APIVersion = *channel.Other
-			}
-		case channeltype.Gemini:
-			if cfg.APIVersion == "" {
-				cfg.APIVersion = *channel.Other
-			}
-		case channeltype.AIProxyLibrary:
-			if cfg.LibraryID == "" {
-				cfg.LibraryID = *channel.Other
-			}
-		case channeltype.Ali:
-			if cfg.Plugin == "" {
-				cfg.Plugin = *channel.Other
-			}
+	key, fingerprint := channel.NextKey()
+	if session, ok := c.Get(ctxkey.StickySession); ok {
+		// keep the key of the session while it is enabled, the prompt cache of the provider is per key
+		stickySession := session.(*model.StickySession)
+		if stickyKey, ok := channel.GetEnabledKey(stickySession.KeyFingerprint); ok && stickySession.ChannelId == channel.Id {
+			key, fingerprint = stickyKey, stickySession.KeyFingerprint
 		}
 	}
+	c.Set(ctxkey.KeyFingerprint, fingerprint)
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
+	cfg := channel.GetConfig()
 	c.Set(ctxkey.Config, cfg)
 }
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestSetupContextForFallbackModel(t *testing.T) {
+	cases := []struct {
+		name         string
+		modelMapping string
+		expected     map[string]string
+	}{
+		{"no mapping", "", map[string]string{"gpt-4o": "claude-3-5-sonnet"}},
+		{"mapped fallback", `{"claude-3-5-sonnet":"claude-3-5-sonnet-20241022"}`, map[string]string{
+			"gpt-4o":            "claude-3-5-sonnet-20241022",
+			"claude-3-5-sonnet": "claude-3-5-sonnet-20241022",
+		}},
+		{"pattern of the fallback", `{"claude-*":"claude-3-haiku"}`, map[string]string{
+			"gpt-4o":   "claude-3-haiku",
+			"claude-*": "claude-3-haiku",
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			channel := &model.Channel{Id: 1601, Key: "sk-fallback", ModelMapping: &c.modelMapping}
+			SetupContextForFallbackModel(ctx, channel, "gpt-4o", "claude-3-5-sonnet")
+
+			assert.Equal(t, c.expected, ctx.GetStringMapString(ctxkey.ModelMapping))
+			assert.Equal(t, "claude-3-5-sonnet", ctx.GetString(ctxkey.OriginalModel))
+			assert.Equal(t, "gpt-4o", ctx.GetString(ctxkey.FallbackFrom))
+			assert.Equal(t, "claude-3-5-sonnet", ctx.Writer.Header().Get(helper.FallbackModelKey))
+			// the mapping of the channel itself is left as it was
+			assert.NotContains(t, channel.GetModelMapping(), "gpt-4o")
+		})
+	}
+}
+
+func TestDistributeFineTunedModel(t *testing.T) {
+	owner := &model.User{Username: "ft-owner", Password: "password", Group: "default", AccessToken: "ft-owner", AffCode: "ft-owner"}
+	other := &model.User{Username: "ft-other", Password: "password", Group: "default", AccessToken: "ft-other", AffCode: "ft-other"}
+	assert.NoError(t, model.DB.Create(owner).Error)
+	assert.NoError(t, model.DB.Create(other).Error)
+	// both channels serve the base model, the job was created on the second one
+	channels := []*model.Channel{
+		{Name: "base", Key: "sk-base", Models: "gpt-4o-mini", Group: "default", Status: model.ChannelStatusEnabled},
+		{Name: "tuned", Key: "sk-tuned", Models: "gpt-4o-mini", Group: "default", Status: model.ChannelStatusEnabled},
+	}
+	for _, channel := range channels {
+		assert.NoError(t, channel.Insert())
+	}
+	fineTunedModel := "ft:gpt-4o-mini:org::abc123"
+	job := &model.FineTuningJob{Id: "ftjob-distribute", UserId: owner.Id, ChannelId: channels[1].Id, Model: "gpt-4o-mini",
+		FineTunedModel: fineTunedModel, Status: "succeeded"}
+	assert.NoError(t, job.Insert())
+	assert.NoError(t, job.AddAbilities())
+	// the ability survives the edits of the channel
+	assert.NoError(t, channels[1].UpdateAbilities())
+
+	distribute := func(userId int) *gin.Context {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		ctx.Set(ctxkey.Id, userId)
+		ctx.Set(ctxkey.RequestModel, fineTunedModel)
+		Distribute()(ctx)
+		return ctx
+	}
+	for i := 0; i < 10; i++ {
+		ctx := distribute(owner.Id)
+		assert.False(t, ctx.IsAborted())
+		assert.Equal(t, channels[1].Id, ctx.GetInt(ctxkey.ChannelId))
+	}
+	assert.Equal(t, http.StatusForbidden, distribute(other.Id).Writer.Status())
+
+	// the model is only listed to its owner
+	models, err := model.GetGroupModels(context.Background(), "default")
+	assert.NoError(t, err)
+	assert.NotContains(t, models, fineTunedModel)
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// JSONBody marks the request body as JSON for the APIs whose clients often leave out
+// the content type, e.g. the Ollama API, so that it isn't parsed as a form.
+func JSONBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != "GET" {
+			c.Request.Header.Set("Content-Type", "application/json")
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// TestMain runs the tests against a fresh SQLite database
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "one-api-middleware")
+	if err != nil {
+		panic(err)
+	}
+	common.RedisEnabled = false
+	common.SQLitePath = filepath.Join(dir, "one-api.db")
+	model.InitDB()
+	model.InitLogDB()
+	code := m.Run()
+	_ = model.CloseDB()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 )
 
 var timeFormat = "2006-01-02T15:04:05.000Z"
@@ -109,3 +111,25 @@ func DownloadRateLimit() func(c *gin.Context) {
 func UploadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(config.UploadRateLimitNum, config.UploadRateLimitDuration, "UP")
 }
+
+// BatchChannelRateLimit holds the requests of batches until the selected channel is under
+// BATCH_CHANNEL_RATE_LIMIT, batches only run on the master node so the limiter is kept in memory.
+func BatchChannelRateLimit() func(c *gin.Context) {
+	inMemoryRateLimiter.Init(config.RateLimitKeyExpirationDuration)
+	return func(c *gin.Context) {
+		if config.BatchChannelRateLimit <= 0 {
+			c.Next()
+			return
+		}
+		key := "BC" + strconv.Itoa(c.GetInt(ctxkey.ChannelId))
+		for !inMemoryRateLimiter.Request(key, config.BatchChannelRateLimit, 60) {
+			select {
+			case <-c.Request.Context().Done():
+				abortWithMessage(c, http.StatusTooManyRequests, "batch stopped while waiting for the channel rate limit")
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		c.Next()
+	}
+}
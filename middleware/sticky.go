@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type stickyMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+	Parts   json.RawMessage `json:"parts"`
+}
+
+// stickyPrefixRequest holds the leading part of a conversation in the OpenAI, Claude, Ollama and Gemini formats
+type stickyPrefixRequest struct {
+	System            json.RawMessage `json:"system"`
+	SystemInstruction json.RawMessage `json:"systemInstruction"`
+	Messages          []stickyMessage `json:"messages"`
+	Contents          []stickyMessage `json:"contents"`
+}
+
+// getStickySessionKey returns the key of the session of the request, which is empty when sticky sessions are disabled
+func getStickySessionKey(c *gin.Context, group string, modelName string) string {
+	var session string
+	switch config.StickySessionMode {
+	case model.StickySessionModeUser:
+		session = fmt.Sprintf("user:%d", c.GetInt(ctxkey.Id))
+	case model.StickySessionModeToken:
+		session = fmt.Sprintf("token:%d", c.GetInt(ctxkey.TokenId))
+	case model.StickySessionModePrefix:
+		prefixHash := getPrefixHash(c)
+		if prefixHash == "" {
+			return ""
+		}
+		session = fmt.Sprintf("prefix:%d:%s", c.GetInt(ctxkey.Id), prefixHash)
+	default:
+		return ""
+	}
+	return fmt.Sprintf("%s:%s:%s", group, modelName, session)
+}
+
+// getPrefixHash hashes the system prompt and the messages up to the first one of the user,
+// which stay the same for all the turns of a conversation
+func getPrefixHash(c *gin.Context) string {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return ""
+	}
+	var request stickyPrefixRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return ""
+	}
+	messages := request.Messages
+	if len(messages) == 0 {
+		messages = request.Contents
+	}
+	hash := sha256.New()
+	hash.Write(request.System)
+	hash.Write(request.SystemInstruction)
+	for _, message := range messages {
+		hash.Write([]byte(message.Role))
+		hash.Write(message.Content)
+		hash.Write(message.Parts)
+		if message.Role == "user" {
+			return hex.EncodeToString(hash.Sum(nil))
+		}
+	}
+	return ""
+}
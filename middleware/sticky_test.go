@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func newStickyTestContext(body string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Set(ctxkey.Id, 7)
+	ctx.Set(ctxkey.TokenId, 42)
+	return ctx
+}
+
+func TestGetStickySessionKey(t *testing.T) {
+	defer func() { config.StickySessionMode = "" }()
+	body := `{"model":"gpt-4o","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`
+	cases := []struct {
+		name     string
+		mode     string
+		body     string
+		expected string
+	}{
+		{"disabled", "", body, ""},
+		{"user", model.StickySessionModeUser, body, "default:gpt-4o:user:7"},
+		{"token", model.StickySessionModeToken, body, "default:gpt-4o:token:42"},
+		{"prefix", model.StickySessionModePrefix, body, "default:gpt-4o:prefix:7:"},
+		// a request without a message of the user has no conversation to follow
+		{"no conversation", model.StickySessionModePrefix, `{"model":"gpt-4o","input":"Hi"}`, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.StickySessionMode = c.mode
+			key := getStickySessionKey(newStickyTestContext(c.body), "default", "gpt-4o")
+			if c.mode == model.StickySessionModePrefix && c.expected != "" {
+				assert.True(t, strings.HasPrefix(key, c.expected))
+				assert.Len(t, key, len(c.expected)+64)
+				return
+			}
+			assert.Equal(t, c.expected, key)
+		})
+	}
+}
+
+func TestGetPrefixHash(t *testing.T) {
+	hash := func(body string) string {
+		return getPrefixHash(newStickyTestContext(body))
+	}
+	first := hash(`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`)
+	assert.NotEmpty(t, first)
+	// the following turns of the conversation keep its prefix
+	assert.Equal(t, first, hash(`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"},`+
+		`{"role":"assistant","content":"Hello!"},{"role":"user","content":"How are you?"}]}`))
+	// another conversation has another prefix
+	assert.NotEqual(t, first, hash(`{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hello"}]}`))
+	assert.NotEqual(t, first, hash(`{"messages":[{"role":"system","content":"Be verbose."},{"role":"user","content":"Hi"}]}`))
+
+	// the system prompt of Claude and the contents of Gemini
+	claude := hash(`{"system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}`)
+	assert.NotEmpty(t, claude)
+	assert.Equal(t, claude, hash(`{"system":"Be brief.","messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello!"}]}`))
+	gemini := hash(`{"systemInstruction":{"parts":[{"text":"Be brief."}]},"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`)
+	assert.NotEmpty(t, gemini)
+	assert.Equal(t, gemini, hash(`{"systemInstruction":{"parts":[{"text":"Be brief."}]},"contents":[{"role":"user","parts":[{"text":"Hi"}]},`+
+		`{"role":"model","parts":[{"text":"Hello!"}]},{"role":"user","parts":[{"text":"Bye"}]}]}`))
+
+	assert.Empty(t, hash(`{"messages":[{"role":"system","content":"Be brief."}]}`))
+	assert.Empty(t, hash(`not json`))
+	ctx := newStickyTestContext(`{"messages":[{"role":"user","content":"Hi"}]}`)
+	ctx.Request.Header.Set("Content-Type", "multipart/form-data")
+	assert.Empty(t, getPrefixHash(ctx))
+}
+
+func TestDistributeStickySession(t *testing.T) {
+	config.StickySessionMode = model.StickySessionModeUser
+	defer func() { config.StickySessionMode = "" }()
+	user := &model.User{Username: "sticky-user", Password: "password", Group: "default", AccessToken: "sticky-user", AffCode: "sticky-user"}
+	assert.NoError(t, model.DB.Create(user).Error)
+	channels := []*model.Channel{
+		{Name: "sticky-a", Key: "sk-a", Models: "sticky-model", Group: "default", Status: model.ChannelStatusEnabled},
+		{Name: "sticky-b", Key: "sk-b", Models: "sticky-model", Group: "default", Status: model.ChannelStatusEnabled},
+	}
+	for _, channel := range channels {
+		assert.NoError(t, channel.Insert())
+	}
+	distribute := func() *gin.Context {
+		ctx := newStickyTestContext(`{"model":"sticky-model","messages":[{"role":"user","content":"Hi"}]}`)
+		ctx.Set(ctxkey.Id, user.Id)
+		ctx.Set(ctxkey.RequestModel, "sticky-model")
+		Distribute()(ctx)
+		return ctx
+	}
+
+	// the session keeps the channel that served it
+	sessionKey := distribute().GetString(ctxkey.StickySessionKey)
+	assert.NotEmpty(t, sessionKey)
+	model.SetStickySession(sessionKey, model.StickySession{ChannelId: channels[1].Id})
+	for i := 0; i < 10; i++ {
+		ctx := distribute()
+		assert.False(t, ctx.IsAborted())
+		assert.Equal(t, channels[1].Id, ctx.GetInt(ctxkey.ChannelId))
+	}
+
+	// another channel is picked once the channel of the session is disabled
+	model.UpdateChannelStatusById(channels[1].Id, model.ChannelStatusAutoDisabled)
+	for i := 0; i < 10; i++ {
+		ctx := distribute()
+		assert.False(t, ctx.IsAborted())
+		assert.Equal(t, channels[0].Id, ctx.GetInt(ctxkey.ChannelId))
+	}
+}
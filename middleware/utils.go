@@ -6,6 +6,7 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 	"strings"
 )
 
@@ -36,7 +37,7 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e-2"
 		}
@@ -46,15 +47,17 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = "whisper-1"
 		}
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// the model is part of the path, e.g. /v1beta/models/gemini-pro:generateContent
+		modelRequest.Model = strings.Split(c.Param("model"), ":")[0]
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		// the websocket handshake has no body, the model is a query parameter
+		modelRequest.Model = c.Query("model")
+	}
 	return modelRequest.Model, nil
 }
 
 func isModelInList(modelName string, models string) bool {
-	modelList := strings.Split(models, ",")
-	for _, model := range modelList {
-		if modelName == model {
-			return true
-		}
-	}
-	return false
+	return modelpattern.InList(modelName, models)
 }
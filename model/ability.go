@@ -9,6 +9,8 @@ import (
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/utils"
+	"github.com/songquanpeng/one-api/relay/channelstat"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 )
 
 type Ability struct {
@@ -17,10 +19,21 @@ type Ability struct {
 	ChannelId int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false;index"`
 	Enabled   bool   `json:"enabled"`
 	Priority  *int64 `json:"priority" gorm:"bigint;default:0;index"`
+	// 模型自身的状态，被禁用的模型在渠道启用时也不可用
+	Status       int    `json:"status" gorm:"default:1"`
+	Reason       string `json:"reason" gorm:"default:''"` // 模型被禁用的原因
+	DisabledTime int64  `json:"disabled_time" gorm:"bigint;default:0"`
 }
 
-func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
-	ability := Ability{}
+func (ability *Ability) getPriority() int64 {
+	if ability.Priority == nil {
+		return 0
+	}
+	return *ability.Priority
+}
+
+// GetSatisfiedChannels is the database counterpart of CacheGetSatisfiedChannels
+func GetSatisfiedChannels(group string, model string, ignoreFirstPriority bool) ([]*Channel, error) {
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -28,31 +41,122 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 		trueVal = "true"
 	}
 
-	var err error = nil
-	var channelQuery *gorm.DB
-	if ignoreFirstPriority {
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-	} else {
-		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
+	// the abilities of the patterns are matched here, the others by the query
+	var abilities []Ability
+	err := DB.Where(groupCol+" = ? and enabled = "+trueVal+" and (model = ? or model like ? or model like ? or model like ?)",
+		group, model, "%*%", "%?%", "/%").Find(&abilities).Error
+	if err != nil {
+		return nil, err
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
+	matched := make([]Ability, 0, len(abilities))
+	var maxPriority int64
+	for _, ability := range abilities {
+		if !modelpattern.Match(ability.Model, model) {
+			continue
+		}
+		if len(matched) == 0 || ability.getPriority() > maxPriority {
+			maxPriority = ability.getPriority()
+		}
+		matched = append(matched, ability)
+	}
+	var channelIds []int
+	for _, ability := range matched {
+		if !ignoreFirstPriority && ability.getPriority() != maxPriority {
+			continue
+		}
+		channelIds = append(channelIds, ability.ChannelId)
 	}
+	if len(channelIds) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var channels []*Channel
+	if err := DB.Where("id IN ?", channelIds).Order("id").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return channels, nil
+}
+
+// ChannelTrafficShare is the part of the traffic of a group and model sent to a channel
+type ChannelTrafficShare struct {
+	ChannelId  int               `json:"channel_id"`
+	Name       string            `json:"name"`
+	Priority   int64             `json:"priority"`
+	Weight     int               `json:"weight"`
+	Share      float64           `json:"share"`       // share of the first attempts
+	RetryShare float64           `json:"retry_share"` // share of the retries, which skip the highest priority
+	Stat       *channelstat.Stat `json:"stat"`        // recent latency and error rate, nil until enough requests were relayed
+}
+
+// scoreRatios returns the share of the requests each channel gets from the strategy of the group
+func scoreRatios(group string, channels []*Channel) []float64 {
+	ratios := getSelectionStrategy(group).Scores(channels)
+	totalScore := 0.0
+	for _, score := range ratios {
+		totalScore += score
+	}
+	for i := range ratios {
+		ratios[i] /= totalScore
+	}
+	return ratios
+}
+
+// GetChannelTrafficShares reports how the requests for a model are spread over the channels of a group
+func GetChannelTrafficShares(group string, model string) ([]*ChannelTrafficShare, error) {
+	firstChannels, err := CacheGetSatisfiedChannels(group, model, false)
 	if err != nil {
 		return nil, err
 	}
-	channel := Channel{}
-	channel.Id = ability.ChannelId
-	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	retryChannels, err := CacheGetSatisfiedChannels(group, model, true)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]*ChannelTrafficShare, 0, len(firstChannels)+len(retryChannels))
+	channelId2share := make(map[int]*ChannelTrafficShare)
+	getShare := func(channel *Channel) *ChannelTrafficShare {
+		share, ok := channelId2share[channel.Id]
+		if !ok {
+			share = &ChannelTrafficShare{
+				ChannelId: channel.Id,
+				Name:      channel.Name,
+				Priority:  channel.GetPriority(),
+				Weight:    channel.GetWeight(),
+			}
+			if stat, ok := channelstat.Get(channel.Id); ok {
+				share.Stat = &stat
+			}
+			channelId2share[channel.Id] = share
+			shares = append(shares, share)
+		}
+		return share
+	}
+	for i, ratio := range scoreRatios(group, firstChannels) {
+		getShare(firstChannels[i]).Share = ratio
+	}
+	for i, ratio := range scoreRatios(group, retryChannels) {
+		getShare(retryChannels[i]).RetryShare = ratio
+	}
+	sort.SliceStable(shares, func(i, j int) bool {
+		return shares[i].Priority > shares[j].Priority
+	})
+	return shares, nil
 }
 
 func (channel *Channel) AddAbilities() error {
+	return channel.addAbilities(nil)
+}
+
+// addAbilities creates the abilities of the channel, the models found in disabled keep their status
+func (channel *Channel) addAbilities(disabled map[string]Ability) error {
 	models_ := strings.Split(channel.Models, ",")
-	models_ = utils.DeDuplication(models_)
+	// the models fine-tuned on the channel are served by it alone, see FineTuningJob.AddAbilities
+	fineTunedModels, err := GetChannelFineTunedModels(channel.Id)
+	if err != nil {
+		return err
+	}
+	models_ = utils.DeDuplication(append(models_, fineTunedModels...))
 	groups_ := strings.Split(channel.Group, ",")
 	abilities := make([]Ability, 0, len(models_))
 	for _, model := range models_ {
@@ -64,6 +168,12 @@ func (channel *Channel) AddAbilities() error {
 				Enabled:   channel.Status == ChannelStatusEnabled,
 				Priority:  channel.Priority,
 			}
+			if disabledAbility, ok := disabled[model]; ok {
+				ability.Enabled = false
+				ability.Status = disabledAbility.Status
+				ability.Reason = disabledAbility.Reason
+				ability.DisabledTime = disabledAbility.DisabledTime
+			}
 			abilities = append(abilities, ability)
 		}
 	}
@@ -78,21 +188,30 @@ func (channel *Channel) DeleteAbilities() error {
 // Make sure the channel is completed before calling this function.
 func (channel *Channel) UpdateAbilities() error {
 	// A quick and dirty way to update abilities
-	// First delete all abilities of this channel
-	err := channel.DeleteAbilities()
+	// First delete all abilities of this channel, remembering the models that were disabled
+	disabled, err := getDisabledAbilities(channel.Id)
+	if err != nil {
+		return err
+	}
+	err = channel.DeleteAbilities()
 	if err != nil {
 		return err
 	}
 	// Then add new abilities
-	err = channel.AddAbilities()
+	err = channel.addAbilities(disabled)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// UpdateAbilityStatus follows the status of the channel, the models disabled on their own stay disabled
 func UpdateAbilityStatus(channelId int, status bool) error {
-	return DB.Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
+	query := DB.Model(&Ability{}).Where("channel_id = ?", channelId)
+	if status {
+		query = query.Where("status = ?", ChannelStatusEnabled)
+	}
+	return query.Select("enabled").Update("enabled", status).Error
 }
 
 func GetGroupModels(ctx context.Context, group string) ([]string, error) {
@@ -103,7 +222,10 @@ func GetGroupModels(ctx context.Context, group string) ([]string, error) {
 		trueVal = "true"
 	}
 	var models []string
-	err := DB.Model(&Ability{}).Distinct("model").Where(groupCol+" = ? and enabled = "+trueVal, group).Pluck("model", &models).Error
+	// the fine-tuned models are only listed to their owner
+	err := DB.Model(&Ability{}).Distinct("model").Where(groupCol+" = ? and enabled = "+trueVal, group).
+		Where("model not in (?)", DB.Model(&FineTuningJob{}).Select("fine_tuned_model").Where("fine_tuned_model <> ''")).
+		Pluck("model", &models).Error
 	if err != nil {
 		return nil, err
 	}
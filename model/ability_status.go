@@ -0,0 +1,151 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// An ability is enabled with its channel unless its own status disables it, so that a model the upstream
+// deprecated or doesn't serve any more is taken down alone while the other models of the channel keep working.
+
+// AbilityInfo is the status of a model of a channel reported by the admin api
+type AbilityInfo struct {
+	Model        string `json:"model"`
+	Status       int    `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	DisabledTime int64  `json:"disabled_time,omitempty"`
+}
+
+// abilityDisabledUntil holds the models disabled on this node, the cached channels only see them once synced
+var abilityDisabledLock sync.RWMutex
+var abilityDisabledUntil = make(map[string]time.Time)
+
+func channelModelId(channelId int, modelName string) string {
+	return fmt.Sprintf("%d:%s", channelId, modelName)
+}
+
+func isAbilityDisabledLocally(channelId int, modelName string) bool {
+	abilityDisabledLock.RLock()
+	defer abilityDisabledLock.RUnlock()
+	until, ok := abilityDisabledUntil[channelModelId(channelId, modelName)]
+	return ok && time.Now().Before(until)
+}
+
+// withoutLocallyDisabledAbilities drops the channels whose model was just disabled on this node
+func withoutLocallyDisabledAbilities(channels []*Channel, modelName string) []*Channel {
+	abilityDisabledLock.RLock()
+	empty := len(abilityDisabledUntil) == 0
+	abilityDisabledLock.RUnlock()
+	if empty {
+		return channels
+	}
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !isAbilityDisabledLocally(channel.Id, modelName) {
+			available = append(available, channel)
+		}
+	}
+	return available
+}
+
+// getDisabledAbilities returns the abilities of the channel disabled on their own, by model
+func getDisabledAbilities(channelId int) (map[string]Ability, error) {
+	var abilities []Ability
+	err := DB.Where("channel_id = ? and status <> ?", channelId, ChannelStatusEnabled).Find(&abilities).Error
+	if err != nil {
+		return nil, err
+	}
+	disabled := make(map[string]Ability)
+	for _, ability := range abilities {
+		disabled[ability.Model] = ability
+	}
+	return disabled, nil
+}
+
+// ErrModelNotListed is returned for a model the channel only serves through a pattern, or doesn't serve at all
+var ErrModelNotListed = errors.New("model not found in the channel")
+
+// SetAbilityStatus enables or disables a model of a channel in all its groups. The model must be one of the
+// models of the channel as written, a model served through a pattern can't be disabled alone.
+func SetAbilityStatus(channelId int, modelName string, status int, reason string) error {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, channelModel := range strings.Split(channel.Models, ",") {
+		if channelModel == modelName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrModelNotListed
+	}
+	updates := map[string]any{
+		"status":        status,
+		"enabled":       status == ChannelStatusEnabled && channel.Status == ChannelStatusEnabled,
+		"reason":        "",
+		"disabled_time": 0,
+	}
+	if status != ChannelStatusEnabled {
+		updates["reason"] = reason
+		updates["disabled_time"] = helper.GetTimestamp()
+	}
+	err = DB.Model(&Ability{}).Where("channel_id = ? and model = ?", channelId, modelName).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	abilityDisabledLock.Lock()
+	if status == ChannelStatusEnabled {
+		delete(abilityDisabledUntil, channelModelId(channelId, modelName))
+	} else {
+		abilityDisabledUntil[channelModelId(channelId, modelName)] = time.Now().Add(time.Duration(config.SyncFrequency) * time.Second)
+	}
+	abilityDisabledLock.Unlock()
+	return nil
+}
+
+// GetAbilityInfos reports the status of each model of the channel
+func GetAbilityInfos(channelId int) ([]AbilityInfo, error) {
+	var abilities []Ability
+	if err := DB.Where("channel_id = ?", channelId).Find(&abilities).Error; err != nil {
+		return nil, err
+	}
+	infos := make([]AbilityInfo, 0, len(abilities))
+	seen := make(map[string]bool)
+	for _, ability := range abilities {
+		if seen[ability.Model] {
+			continue
+		}
+		seen[ability.Model] = true
+		infos = append(infos, AbilityInfo{
+			Model:        ability.Model,
+			Status:       ability.Status,
+			Reason:       ability.Reason,
+			DisabledTime: ability.DisabledTime,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Model < infos[j].Model
+	})
+	return infos, nil
+}
+
+// GetAutoDisabledAbilities returns the models of the enabled channels that were disabled automatically,
+// one ability per channel and model
+func GetAutoDisabledAbilities() ([]Ability, error) {
+	var abilities []Ability
+	err := DB.Distinct("channel_id", "model").
+		Where("status = ? and channel_id in (?)", ChannelStatusAutoDisabled,
+			DB.Model(&Channel{}).Select("id").Where("status = ?", ChannelStatusEnabled)).
+		Order("channel_id").Find(&abilities).Error
+	return abilities, err
+}
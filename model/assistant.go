@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+// Assistant 用户通过 /v1/assistants 创建的助手，运行时的指令、模型和工具的默认值
+type Assistant struct {
+	Id             string   `json:"id" gorm:"type:varchar(64);primaryKey"`   // 助手ID
+	UserId         int      `json:"user_id" gorm:"not null;index"`           // 用户ID
+	TokenId        int      `json:"token_id" gorm:"not null"`                // 创建使用的Token ID
+	Name           string   `json:"name" gorm:"type:varchar(256)"`           // 名称
+	Description    string   `json:"description" gorm:"type:text"`            // 描述
+	Model          string   `json:"model" gorm:"type:varchar(100)"`          // 模型名称
+	Instructions   string   `json:"instructions" gorm:"type:text"`           // 系统指令
+	Tools          string   `json:"tools" gorm:"type:text"`                  // 工具列表，JSON
+	ResponseFormat string   `json:"response_format" gorm:"type:text"`        // 响应格式，JSON
+	Temperature    *float64 `json:"temperature"`                             // 温度
+	TopP           *float64 `json:"top_p"`                                   // top_p
+	Metadata       string   `json:"metadata" gorm:"type:text"`               // 用户自定义元数据，JSON
+	CreatedAt      int64    `json:"created_at" gorm:"bigint;not null;index"` // 创建时间
+}
+
+// Insert 插入助手记录
+func (a *Assistant) Insert() error {
+	a.CreatedAt = time.Now().Unix()
+	return DB.Create(a).Error
+}
+
+// Update 更新助手的可修改字段
+func (a *Assistant) Update() error {
+	return DB.Model(a).Select("name", "description", "model", "instructions", "tools",
+		"response_format", "temperature", "top_p", "metadata").Updates(a).Error
+}
+
+// Delete 删除助手记录
+func (a *Assistant) Delete() error {
+	return DB.Delete(a).Error
+}
+
+// GetAssistantById 根据ID获取用户的助手
+func GetAssistantById(id string, userId int) (*Assistant, error) {
+	var assistant Assistant
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&assistant).Error
+	return &assistant, err
+}
+
+// GetAssistants 分页获取用户的助手，after 为上一页最后一个助手的ID
+func GetAssistants(userId int, after string, limit int, asc bool) ([]*Assistant, error) {
+	var assistants []*Assistant
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		cursor, err := GetAssistantById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = afterCursor(query, cursor.CreatedAt, cursor.Id, asc)
+	}
+	err := query.Order(listOrder(asc)).Limit(limit).Find(&assistants).Error
+	return assistants, err
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"time"
+)
+
+// 批处理状态，与 OpenAI Batch API 保持一致
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch 用户通过 /v1/batches 创建的批处理任务，由 one-api 自己逐行执行输入文件中的请求
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`     // 批处理ID
+	UserId           int    `json:"user_id" gorm:"not null;index"`             // 用户ID
+	TokenId          int    `json:"token_id" gorm:"not null;index"`            // 创建使用的Token ID
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`          // 请求的接口，如 /v1/chat/completions
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`     // 输入文件ID
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`    // 成功结果文件ID
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`     // 失败结果文件ID
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"` // 完成时限
+	Status           string `json:"status" gorm:"type:varchar(16);index"`      // 状态
+	Errors           string `json:"errors" gorm:"type:text"`                   // 校验失败的错误列表，JSON
+	Metadata         string `json:"metadata" gorm:"type:text"`                 // 用户自定义元数据，JSON
+	RequestTotal     int    `json:"request_total" gorm:"default:0"`            // 请求总数
+	RequestCompleted int    `json:"request_completed" gorm:"default:0"`        // 成功请求数
+	RequestFailed    int    `json:"request_failed" gorm:"default:0"`           // 失败请求数
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;not null;index"`   // 创建时间
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint;default:0"`    // 开始执行时间
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint;default:0"`        // 截止时间
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint;default:0"`     // 开始生成结果文件时间
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint;default:0"`      // 完成时间
+	FailedAt         int64  `json:"failed_at" gorm:"bigint;default:0"`         // 失败时间
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint;default:0"`        // 过期时间
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint;default:0"`     // 开始取消时间
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint;default:0"`      // 取消完成时间
+}
+
+// Insert 插入批处理记录
+func (b *Batch) Insert() error {
+	b.CreatedAt = time.Now().Unix()
+	return DB.Create(b).Error
+}
+
+// Update 更新批处理的状态、结果文件和计数
+func (b *Batch) Update() error {
+	return DB.Model(b).Select("output_file_id", "error_file_id", "status", "errors",
+		"request_total", "request_completed", "request_failed",
+		"in_progress_at", "finalizing_at", "completed_at", "failed_at", "expired_at", "cancelling_at", "cancelled_at").Updates(b).Error
+}
+
+// UpdateRequestCounts 只更新请求计数，执行过程中定期调用
+func (b *Batch) UpdateRequestCounts() error {
+	return DB.Model(b).Select("request_total", "request_completed", "request_failed").Updates(b).Error
+}
+
+// CancelBatch 将批处理标记为取消中，只有尚未结束的批处理可以取消
+func CancelBatch(id string, userId int, tokenId int) (bool, error) {
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND user_id = ? AND token_id = ?", id, userId, tokenId).
+		Where("status IN ?", []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]any{"status": BatchStatusCancelling, "cancelling_at": time.Now().Unix()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetBatchStatus 获取批处理当前状态，执行过程中用于检查是否被取消
+func GetBatchStatus(id string) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Select("status").Scan(&status).Error
+	return status, err
+}
+
+// GetBatchById 根据ID获取属于该用户和令牌的批处理
+func GetBatchById(id string, userId int, tokenId int) (*Batch, error) {
+	var batch Batch
+	err := DB.Where("id = ? AND user_id = ? AND token_id = ?", id, userId, tokenId).First(&batch).Error
+	return &batch, err
+}
+
+// GetBatches 分页获取属于该用户和令牌的批处理，按创建时间倒序，after 为上一页最后一个批处理的ID
+func GetBatches(userId int, tokenId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if after != "" {
+		cursor, err := GetBatchById(after, userId, tokenId)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetBatchesByStatus 获取处于指定状态的所有批处理，按创建时间排序
+func GetBatchesByStatus(statuses ...string) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", statuses).Order("created_at asc").Find(&batches).Error
+	return batches, err
+}
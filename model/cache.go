@@ -8,8 +8,10 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/random"
-	"math/rand"
+	"github.com/songquanpeng/one-api/relay/circuitbreaker"
+	"github.com/songquanpeng/one-api/relay/concurrency"
+	"github.com/songquanpeng/one-api/relay/cooldown"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 	"sort"
 	"strconv"
 	"strings"
@@ -168,6 +170,7 @@ func CacheGetGroupModels(ctx context.Context, group string) ([]string, error) {
 }
 
 var group2model2channels map[string]map[string][]*Channel
+var group2patterns map[string][]string // the models of the channels that are patterns, by group
 var channelSyncLock sync.RWMutex
 
 func InitChannelCache() {
@@ -176,12 +179,19 @@ func InitChannelCache() {
 	DB.Where("status = ?", ChannelStatusEnabled).Find(&channels)
 	for _, channel := range channels {
 		newChannelId2channel[channel.Id] = channel
+		if err := channel.parseConfig(); err != nil {
+			logger.SysError(fmt.Sprintf("the schedule of channel #%d is ignored: %s", channel.Id, err.Error()))
+		}
 	}
 	var abilities []*Ability
 	DB.Find(&abilities)
 	groups := make(map[string]bool)
+	disabledAbilities := make(map[string]bool)
 	for _, ability := range abilities {
 		groups[ability.Group] = true
+		if ability.Status != ChannelStatusEnabled {
+			disabledAbilities[channelModelId(ability.ChannelId, ability.Model)] = true
+		}
 	}
 	newGroup2model2channels := make(map[string]map[string][]*Channel)
 	for group := range groups {
@@ -192,6 +202,9 @@ func InitChannelCache() {
 		for _, group := range groups {
 			models := strings.Split(channel.Models, ",")
 			for _, model := range models {
+				if disabledAbilities[channelModelId(channel.Id, model)] {
+					continue
+				}
 				if _, ok := newGroup2model2channels[group][model]; !ok {
 					newGroup2model2channels[group][model] = make([]*Channel, 0)
 				}
@@ -210,8 +223,18 @@ func InitChannelCache() {
 		}
 	}
 
+	newGroup2patterns := make(map[string][]string)
+	for group, model2channels := range newGroup2model2channels {
+		for model := range model2channels {
+			if modelpattern.IsPattern(model) {
+				newGroup2patterns[group] = append(newGroup2patterns[group], model)
+			}
+		}
+	}
+
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
+	group2patterns = newGroup2patterns
 	channelSyncLock.Unlock()
 	logger.SysLog("channels synced from database")
 }
@@ -224,13 +247,15 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
+// CacheGetSatisfiedChannels returns the channels a request may be sent to, those of the highest
+// priority, or those of the lower priorities when ignoreFirstPriority is set for the retries.
+func CacheGetSatisfiedChannels(group string, model string, ignoreFirstPriority bool) ([]*Channel, error) {
 	if !config.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model, ignoreFirstPriority)
+		return GetSatisfiedChannels(group, model, ignoreFirstPriority)
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
+	channels := getGroupModelChannels(group, model)
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
@@ -245,11 +270,139 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 			}
 		}
 	}
-	idx := rand.Intn(endIdx)
 	if ignoreFirstPriority {
 		if endIdx < len(channels) { // which means there are more than one priority
-			idx = random.RandRange(endIdx, len(channels))
+			return channels[endIdx:], nil
+		}
+	}
+	return channels[:endIdx], nil
+}
+
+// getGroupModelChannels returns the channels of the model and those of the patterns matching it, sorted by priority
+func getGroupModelChannels(group string, model string) []*Channel {
+	channels := withoutLocallyDisabledAbilities(group2model2channels[group][model], model)
+	var merged []*Channel
+	for _, pattern := range group2patterns[group] {
+		if !modelpattern.Match(pattern, model) {
+			continue
+		}
+		for _, channel := range withoutLocallyDisabledAbilities(group2model2channels[group][pattern], pattern) {
+			if !containsChannel(channels, channel.Id) && !containsChannel(merged, channel.Id) {
+				merged = append(merged, channel)
+			}
+		}
+	}
+	if len(merged) == 0 {
+		return channels
+	}
+	merged = append(merged, channels...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].GetPriority() > merged[j].GetPriority()
+	})
+	return merged
+}
+
+func containsChannel(channels []*Channel, channelId int) bool {
+	for _, channel := range channels {
+		if channel.Id == channelId {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheGetRandomSatisfiedChannel picks a channel for the model, the channel of the sticky session is kept
+// as long as it is one of the candidates and its circuit is closed.
+func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool, session *StickySession) (*Channel, error) {
+	channels, err := CacheGetSatisfiedChannels(group, model, ignoreFirstPriority)
+	if err != nil {
+		return nil, err
+	}
+	channels = filterAvailable(channels, model)
+	available := filterSaturated(channels)
+	if len(available) == 0 && !ignoreFirstPriority {
+		// the channels of the highest priority are all unavailable or saturated, fall back to the lower priorities
+		lowerChannels, err := CacheGetSatisfiedChannels(group, model, true)
+		if err == nil {
+			lowerChannels = filterAvailable(lowerChannels, model)
+			if lowerAvailable := filterSaturated(lowerChannels); len(lowerAvailable) > 0 {
+				available = lowerAvailable
+			} else if len(channels) == 0 {
+				channels = lowerChannels
+			}
+		} else if len(channels) == 0 {
+			return nil, err
+		}
+	}
+	if len(available) > 0 {
+		channels = available
+	}
+	// when all the channels are saturated the request waits in the queue of one of them
+	if session != nil {
+		for _, channel := range channels {
+			if channel.Id == session.ChannelId && circuitbreaker.Acquire(channel.Id, model) {
+				return channel, nil
+			}
+		}
+	}
+	for len(channels) > 0 {
+		channel := pickChannel(group, channels)
+		if circuitbreaker.Acquire(channel.Id, model) {
+			return channel, nil
+		}
+		// another request took the trial of the half-open circuit
+		others := make([]*Channel, 0, len(channels)-1)
+		for _, other := range channels {
+			if other != channel {
+				others = append(others, other)
+			}
+		}
+		channels = others
+	}
+	return nil, errors.New("the circuits of all the channels are open, or they are rate limited or paused")
+}
+
+// CacheGetRandomSatisfiedChannelOf picks a channel for the model among those accepted, for the requests that only
+// some types of channel can serve. The lower priorities are used when no channel of the highest one is accepted.
+func CacheGetRandomSatisfiedChannelOf(group string, model string, accept func(channel *Channel) bool) (*Channel, error) {
+	for _, ignoreFirstPriority := range []bool{false, true} {
+		channels, err := CacheGetSatisfiedChannels(group, model, ignoreFirstPriority)
+		if err != nil {
+			return nil, err
+		}
+		accepted := make([]*Channel, 0, len(channels))
+		for _, channel := range channels {
+			if accept(channel) {
+				accepted = append(accepted, channel)
+			}
+		}
+		if available := filterAvailable(accepted, model); len(available) > 0 {
+			return pickChannel(group, available), nil
+		}
+	}
+	return nil, errors.New("channel not found")
+}
+
+// filterSaturated leaves out the channels whose slots are all taken
+func filterSaturated(channels []*Channel) []*Channel {
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		cfg, _ := channel.LoadConfig()
+		if !concurrency.IsSaturated(channel.Id, cfg.MaxConcurrency) {
+			available = append(available, channel)
+		}
+	}
+	return available
+}
+
+// filterAvailable leaves out the channels whose circuit for the model is open, those cooling down
+// until the reset of the rate limit of their upstream, and those out of their schedule or budget
+func filterAvailable(channels []*Channel, model string) []*Channel {
+	allowed := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if circuitbreaker.Allow(channel.Id, model) && !cooldown.IsCoolingDown(channel.Id) && isChannelInService(channel) {
+			allowed = append(allowed, channel)
 		}
 	}
-	return channels[idx], nil
+	return allowed
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/schedule"
 	"gorm.io/gorm"
 )
 
@@ -38,18 +40,42 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	KeyStatus          *string `json:"key_status" gorm:"type:text"` // the disabled keys of a multi-key channel, see channel_key.go
+	// the config and the schedule of the cached channels, parsed once by InitChannelCache
+	parsedConfig   *ChannelConfig
+	parsedSchedule schedule.Schedule
 }
 
 type ChannelConfig struct {
-	Region            string `json:"region,omitempty"`
-	SK                string `json:"sk,omitempty"`
-	AK                string `json:"ak,omitempty"`
-	UserID            string `json:"user_id,omitempty"`
-	APIVersion        string `json:"api_version,omitempty"`
-	LibraryID         string `json:"library_id,omitempty"`
-	Plugin            string `json:"plugin,omitempty"`
-	VertexAIProjectID string `json:"vertex_ai_project_id,omitempty"`
-	VertexAIADC       string `json:"vertex_ai_adc,omitempty"`
+	Region            string  `json:"region,omitempty"`
+	SK                string  `json:"sk,omitempty"`
+	AK                string  `json:"ak,omitempty"`
+	UserID            string  `json:"user_id,omitempty"`
+	APIVersion        string  `json:"api_version,omitempty"`
+	LibraryID         string  `json:"library_id,omitempty"`
+	Plugin            string  `json:"plugin,omitempty"`
+	VertexAIProjectID string  `json:"vertex_ai_project_id,omitempty"`
+	VertexAIADC       string  `json:"vertex_ai_adc,omitempty"`
+	KeyRotation       string  `json:"key_rotation,omitempty"`        // 多密钥轮换方式：round_robin 或 random，设置后每行一个密钥
+	MaxConcurrency    int     `json:"max_concurrency,omitempty"`     // 同时进行的请求数上限，0 表示不限制
+	QueueSize         int     `json:"queue_size,omitempty"`          // 达到上限后排队等待的请求数上限
+	QueueTimeout      int     `json:"queue_timeout,omitempty"`       // 排队等待的超时时间，单位为秒
+	CostMultiplier    float64 `json:"cost_multiplier,omitempty"`     // 渠道成本倍率，即上游价格相对模型倍率的比例，默认为 1
+	Schedule          string  `json:"schedule,omitempty"`            // 可用时段，如 "mon-fri 22:00-08:00; sat,sun 00:00-24:00"，为空表示始终可用
+	TimeZone          string  `json:"time_zone,omitempty"`           // 可用时段与每日额度所用的时区，如 Asia/Shanghai，默认为服务器时区
+	DailyRequestLimit int64   `json:"daily_request_limit,omitempty"` // 每日请求数上限，0 表示不限制
+	DailyTokenLimit   int64   `json:"daily_token_limit,omitempty"`   // 每日 token 数上限，0 表示不限制
+	DailyResetTime    string  `json:"daily_reset_time,omitempty"`    // 每日额度的重置时间，如 08:00，默认为 00:00
+	TestModel         string  `json:"test_model,omitempty"`          // 测试与恢复探测所用的模型，默认为渠道的第一个非通配符模型，只有通配符的渠道必须设置
+	TestPrompt        string  `json:"test_prompt,omitempty"`         // 测试与恢复探测所用的提示词，默认为全局的测试提示词
+}
+
+// GetCostMultiplier returns the price of the upstream of the channel compared to the model ratios
+func (cfg ChannelConfig) GetCostMultiplier() float64 {
+	if cfg.CostMultiplier <= 0 {
+		return 1
+	}
+	return cfg.CostMultiplier
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -104,6 +130,15 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+// GetWeight returns the weight used to share the traffic with the channels of the same priority,
+// the default weight 0 counts as 1 so that the channels without a weight share the traffic evenly.
+func (channel *Channel) GetWeight() int {
+	if channel.Weight == nil || *channel.Weight == 0 {
+		return 1
+	}
+	return int(*channel.Weight)
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -172,10 +207,16 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteChannelProbes(channel.Id)
 }
 
 func (channel *Channel) LoadConfig() (ChannelConfig, error) {
+	if channel.parsedConfig != nil {
+		return *channel.parsedConfig, nil
+	}
 	var cfg ChannelConfig
 	if channel.Config == "" {
 		return cfg, nil
@@ -187,6 +228,37 @@ func (channel *Channel) LoadConfig() (ChannelConfig, error) {
 	return cfg, nil
 }
 
+// GetConfig returns the config of the channel, completed with the settings older versions kept in Other
+func (channel *Channel) GetConfig() ChannelConfig {
+	cfg, _ := channel.LoadConfig()
+	// this is for backward compatibility
+	if channel.Other != nil {
+		switch channel.Type {
+		case channeltype.Azure:
+			if cfg.APIVersion == "" {
+				cfg.APIVersion = *channel.Other
+			}
+		case channeltype.Xunfei:
+			if cfg.APIVersion == "" {
+				cfg.APIVersion = *channel.Other
+			}
+		case channeltype.Gemini:
+			if cfg.APIVersion == "" {
+				cfg.APIVersion = *channel.Other
+			}
+		case channeltype.AIProxyLibrary:
+			if cfg.LibraryID == "" {
+				cfg.LibraryID = *channel.Other
+			}
+		case channeltype.Ali:
+			if cfg.Plugin == "" {
+				cfg.Plugin = *channel.Other
+			}
+		}
+	}
+	return cfg
+}
+
 func UpdateChannelStatusById(id int, status int) {
 	err := UpdateAbilityStatus(id, status == ChannelStatusEnabled)
 	if err != nil {
@@ -0,0 +1,339 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// A channel whose config sets a key rotation holds several keys in Key, one per line.
+// The keys are told apart by their fingerprint, so that their status survives the edits of the key list.
+
+const (
+	KeyRotationRoundRobin = "round_robin"
+	KeyRotationRandom     = "random"
+)
+
+// ChannelKeyStatus is saved in Channel.KeyStatus for the disabled keys only
+type ChannelKeyStatus struct {
+	Status       int    `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	DisabledTime int64  `json:"disabled_time,omitempty"`
+}
+
+// ChannelKeyHealth is the health of a key seen by this node since it started
+type ChannelKeyHealth struct {
+	Requests       int64  `json:"requests"`
+	Failures       int64  `json:"failures"` // consecutive failures
+	LastError      string `json:"last_error"`
+	LastFailedTime int64  `json:"last_failed_time"`
+}
+
+// ChannelKeyInfo is the status of a key reported by the admin api, the key itself is masked
+type ChannelKeyInfo struct {
+	Index       int    `json:"index"`
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`
+	ChannelKeyStatus
+	ChannelKeyHealth
+}
+
+var channelKeyCounters sync.Map // channel id -> *uint64, for the round robin
+
+var channelKeyHealthLock sync.Mutex
+var channelKeyHealth = make(map[string]*ChannelKeyHealth)
+
+// keyStatusOverride is a status change made on this node, the cached channels only see it once synced
+type keyStatusOverride struct {
+	status    ChannelKeyStatus
+	expiresAt time.Time
+}
+
+var keyStatusOverridesLock sync.RWMutex
+var keyStatusOverrides = make(map[string]keyStatusOverride)
+
+func KeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func channelKeyId(channelId int, fingerprint string) string {
+	return fmt.Sprintf("%d:%s", channelId, fingerprint)
+}
+
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
+
+func (channel *Channel) IsMultiKey() bool {
+	cfg, _ := channel.LoadConfig()
+	return cfg.KeyRotation != ""
+}
+
+// GetKeys returns the keys of a multi-key channel, or the key of the others
+func (channel *Channel) GetKeys() []string {
+	if !channel.IsMultiKey() {
+		return []string{channel.Key}
+	}
+	var keys []string
+	for _, key := range strings.Split(channel.Key, "\n") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (channel *Channel) getKeyStatuses() map[string]ChannelKeyStatus {
+	statuses := make(map[string]ChannelKeyStatus)
+	if channel.KeyStatus != nil && *channel.KeyStatus != "" {
+		if err := json.Unmarshal([]byte(*channel.KeyStatus), &statuses); err != nil {
+			logger.SysError(fmt.Sprintf("failed to unmarshal key status of channel %d: %s", channel.Id, err.Error()))
+		}
+	}
+	keyStatusOverridesLock.RLock()
+	defer keyStatusOverridesLock.RUnlock()
+	now := time.Now()
+	for _, key := range channel.GetKeys() {
+		fingerprint := KeyFingerprint(key)
+		if override, ok := keyStatusOverrides[channelKeyId(channel.Id, fingerprint)]; ok && now.Before(override.expiresAt) {
+			statuses[fingerprint] = override.status
+		}
+	}
+	return statuses
+}
+
+func isKeyEnabled(statuses map[string]ChannelKeyStatus, fingerprint string) bool {
+	status, ok := statuses[fingerprint]
+	return !ok || status.Status == ChannelStatusEnabled
+}
+
+// GetEnabledKeys returns the keys of a multi-key channel that are not disabled, or the key of the others
+func (channel *Channel) GetEnabledKeys() []string {
+	keys := channel.GetKeys()
+	if !channel.IsMultiKey() {
+		return keys
+	}
+	statuses := channel.getKeyStatuses()
+	enabledKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if isKeyEnabled(statuses, KeyFingerprint(key)) {
+			enabledKeys = append(enabledKeys, key)
+		}
+	}
+	return enabledKeys
+}
+
+// NextKey returns the key for the next request and its fingerprint, which is empty for the single key channels.
+// When every key is disabled they are all used again, the channel is only enabled by then if it was done on purpose.
+func (channel *Channel) NextKey() (key string, fingerprint string) {
+	cfg, _ := channel.LoadConfig()
+	if cfg.KeyRotation == "" {
+		return channel.Key, ""
+	}
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return "", ""
+	}
+	enabledKeys := channel.GetEnabledKeys()
+	if len(enabledKeys) == 0 {
+		enabledKeys = keys
+	}
+	if cfg.KeyRotation == KeyRotationRandom {
+		key = enabledKeys[rand.Intn(len(enabledKeys))]
+	} else {
+		counter, _ := channelKeyCounters.LoadOrStore(channel.Id, new(uint64))
+		key = enabledKeys[atomic.AddUint64(counter.(*uint64), 1)%uint64(len(enabledKeys))]
+	}
+	return key, KeyFingerprint(key)
+}
+
+// GetEnabledKey returns the key with the fingerprint if the channel still has it enabled
+func (channel *Channel) GetEnabledKey(fingerprint string) (string, bool) {
+	if fingerprint == "" || !channel.IsMultiKey() {
+		return "", false
+	}
+	statuses := channel.getKeyStatuses()
+	for _, key := range channel.GetKeys() {
+		if KeyFingerprint(key) == fingerprint {
+			return key, isKeyEnabled(statuses, fingerprint)
+		}
+	}
+	return "", false
+}
+
+// RecordChannelKeyResult counts the requests and the failures of a key
+func RecordChannelKeyResult(channelId int, fingerprint string, success bool, errMessage string) {
+	if fingerprint == "" {
+		return
+	}
+	channelKeyHealthLock.Lock()
+	defer channelKeyHealthLock.Unlock()
+	id := channelKeyId(channelId, fingerprint)
+	health, ok := channelKeyHealth[id]
+	if !ok {
+		health = &ChannelKeyHealth{}
+		channelKeyHealth[id] = health
+	}
+	health.Requests++
+	if success {
+		health.Failures = 0
+		return
+	}
+	health.Failures++
+	health.LastError = errMessage
+	health.LastFailedTime = helper.GetTimestamp()
+}
+
+// lockChannel reads the channel and locks its row until the end of the transaction, so that the concurrent
+// changes of its key statuses don't overwrite each other
+func lockChannel(tx *gorm.DB, channelId int) (*Channel, error) {
+	channel := &Channel{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(channel, "id = ?", channelId).Error
+	return channel, err
+}
+
+// SetChannelKeyStatus changes the status of a key, and tells whether all the keys of the channel are disabled now
+func SetChannelKeyStatus(channelId int, fingerprint string, status int, reason string) (allDisabled bool, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		channel, err := lockChannel(tx, channelId)
+		if err != nil {
+			return err
+		}
+		if !channel.IsMultiKey() {
+			return errors.New("the channel has a single key")
+		}
+		statuses := make(map[string]ChannelKeyStatus)
+		if channel.KeyStatus != nil && *channel.KeyStatus != "" {
+			_ = json.Unmarshal([]byte(*channel.KeyStatus), &statuses)
+		}
+		keys := channel.GetKeys()
+		found := false
+		newStatuses := make(map[string]ChannelKeyStatus)
+		allDisabled = true
+		for _, key := range keys {
+			keyFingerprint := KeyFingerprint(key)
+			keyStatus, disabled := statuses[keyFingerprint]
+			if keyFingerprint == fingerprint {
+				found = true
+				keyStatus, disabled = ChannelKeyStatus{Status: status}, status != ChannelStatusEnabled
+				if disabled {
+					keyStatus.Reason = reason
+					keyStatus.DisabledTime = helper.GetTimestamp()
+				}
+			}
+			// the statuses of the removed keys are dropped
+			if disabled {
+				newStatuses[keyFingerprint] = keyStatus
+			} else {
+				allDisabled = false
+			}
+		}
+		if !found {
+			return errors.New("key not found")
+		}
+		jsonBytes, err := json.Marshal(newStatuses)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Channel{}).Where("id = ?", channelId).Update("key_status", string(jsonBytes)).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	keyStatusOverridesLock.Lock()
+	keyStatusOverrides[channelKeyId(channelId, fingerprint)] = keyStatusOverride{
+		status:    ChannelKeyStatus{Status: status, Reason: reason},
+		expiresAt: time.Now().Add(time.Duration(config.SyncFrequency) * time.Second),
+	}
+	keyStatusOverridesLock.Unlock()
+	return allDisabled, nil
+}
+
+// EnableAutoDisabledChannelKeys enables again the keys of the channel that were disabled automatically, for a
+// channel enabled again once it works, the keys disabled by hand stay disabled
+func EnableAutoDisabledChannelKeys(channelId int) error {
+	var enabled []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		channel, err := lockChannel(tx, channelId)
+		if err != nil {
+			return err
+		}
+		if !channel.IsMultiKey() || channel.KeyStatus == nil || *channel.KeyStatus == "" {
+			return nil
+		}
+		statuses := make(map[string]ChannelKeyStatus)
+		if err = json.Unmarshal([]byte(*channel.KeyStatus), &statuses); err != nil {
+			return err
+		}
+		for fingerprint, keyStatus := range statuses {
+			if keyStatus.Status == ChannelStatusAutoDisabled {
+				delete(statuses, fingerprint)
+				enabled = append(enabled, fingerprint)
+			}
+		}
+		if len(enabled) == 0 {
+			return nil
+		}
+		jsonBytes, err := json.Marshal(statuses)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Channel{}).Where("id = ?", channelId).Update("key_status", string(jsonBytes)).Error
+	})
+	if err != nil {
+		return err
+	}
+	keyStatusOverridesLock.Lock()
+	for _, fingerprint := range enabled {
+		keyStatusOverrides[channelKeyId(channelId, fingerprint)] = keyStatusOverride{
+			status:    ChannelKeyStatus{Status: ChannelStatusEnabled},
+			expiresAt: time.Now().Add(time.Duration(config.SyncFrequency) * time.Second),
+		}
+	}
+	keyStatusOverridesLock.Unlock()
+	return nil
+}
+
+// GetChannelKeyInfos reports the status and the health of each key of the channel
+func GetChannelKeyInfos(channel *Channel) []ChannelKeyInfo {
+	statuses := channel.getKeyStatuses()
+	channelKeyHealthLock.Lock()
+	defer channelKeyHealthLock.Unlock()
+	keys := channel.GetKeys()
+	infos := make([]ChannelKeyInfo, 0, len(keys))
+	for i, key := range keys {
+		fingerprint := KeyFingerprint(key)
+		info := ChannelKeyInfo{
+			Index:       i,
+			Key:         maskKey(key),
+			Fingerprint: fingerprint,
+		}
+		info.ChannelKeyStatus = ChannelKeyStatus{Status: ChannelStatusEnabled}
+		if status, ok := statuses[fingerprint]; ok {
+			info.ChannelKeyStatus = status
+		}
+		if health, ok := channelKeyHealth[channelKeyId(channel.Id, fingerprint)]; ok {
+			info.ChannelKeyHealth = *health
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMultiKeyChannel(id int, rotation string, disabledKeys ...string) *Channel {
+	statuses := "{"
+	for i, key := range disabledKeys {
+		if i > 0 {
+			statuses += ","
+		}
+		statuses += fmt.Sprintf(`"%s":{"status":%d}`, KeyFingerprint(key), ChannelStatusAutoDisabled)
+	}
+	statuses += "}"
+	// the rotation of the channel starts over
+	channelKeyCounters.Delete(id)
+	return &Channel{
+		Id:        id,
+		Key:       "sk-a\nsk-b\n\nsk-c\n",
+		Config:    fmt.Sprintf(`{"key_rotation":"%s"}`, rotation),
+		KeyStatus: &statuses,
+	}
+}
+
+func TestNextKey(t *testing.T) {
+	cases := []struct {
+		name     string
+		channel  *Channel
+		expected []string // the keys in the order they are handed out, the rotation starts after the first one
+	}{
+		{"round robin", newTestMultiKeyChannel(1501, KeyRotationRoundRobin), []string{"sk-b", "sk-c", "sk-a", "sk-b", "sk-c", "sk-a"}},
+		{"disabled key", newTestMultiKeyChannel(1502, KeyRotationRoundRobin, "sk-b"), []string{"sk-c", "sk-a", "sk-c", "sk-a"}},
+		// the keys are all used again once they are all disabled
+		{"all disabled", newTestMultiKeyChannel(1503, KeyRotationRoundRobin, "sk-a", "sk-b", "sk-c"), []string{"sk-b", "sk-c", "sk-a"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, expected := range c.expected {
+				key, fingerprint := c.channel.NextKey()
+				assert.Equal(t, expected, key)
+				assert.Equal(t, KeyFingerprint(expected), fingerprint)
+			}
+		})
+	}
+
+	t.Run("random", func(t *testing.T) {
+		channel := newTestMultiKeyChannel(1504, KeyRotationRandom, "sk-a")
+		for i := 0; i < 50; i++ {
+			key, _ := channel.NextKey()
+			assert.Contains(t, []string{"sk-b", "sk-c"}, key)
+		}
+	})
+
+	t.Run("single key", func(t *testing.T) {
+		channel := &Channel{Id: 1505, Key: "sk-single"}
+		key, fingerprint := channel.NextKey()
+		assert.Equal(t, "sk-single", key)
+		assert.Empty(t, fingerprint)
+	})
+}
+
+func TestGetEnabledKeys(t *testing.T) {
+	channel := newTestMultiKeyChannel(1506, KeyRotationRoundRobin, "sk-c")
+	assert.Equal(t, []string{"sk-a", "sk-b"}, channel.GetEnabledKeys())
+	// listing the keys leaves the rotation where it was
+	key, _ := channel.NextKey()
+	assert.Equal(t, "sk-b", key)
+	assert.Equal(t, []string{"sk-single"}, (&Channel{Key: "sk-single"}).GetEnabledKeys())
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// ChannelProbe 自动禁用的渠道的一次恢复探测
+type ChannelProbe struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"not null;index"`  // 渠道ID
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;not null"` // 探测时间
+	Model        string `json:"model" gorm:"type:varchar(255)"`    // 探测所用的模型
+	Success      bool   `json:"success"`                           // 探测是否成功
+	ResponseTime int64  `json:"response_time"`                     // 响应时间，单位为毫秒
+	Message      string `json:"message" gorm:"type:text"`          // 失败原因
+}
+
+// RecordChannelProbe saves the probe and prunes the history of the channel down to its last probes
+func RecordChannelProbe(probe *ChannelProbe) error {
+	probe.CreatedAt = helper.GetTimestamp()
+	if err := DB.Create(probe).Error; err != nil {
+		return err
+	}
+	var ids []int
+	err := DB.Model(&ChannelProbe{}).Where("channel_id = ?", probe.ChannelId).Order("id desc").
+		Offset(config.ChannelProbeHistorySize).Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return DB.Where("channel_id = ? and id <= ?", probe.ChannelId, ids[0]).Delete(&ChannelProbe{}).Error
+}
+
+// GetChannelProbes returns the probe history of the channel, the latest first
+func GetChannelProbes(channelId int) ([]*ChannelProbe, error) {
+	var probes []*ChannelProbe
+	err := DB.Where("channel_id = ?", channelId).Order("id desc").Find(&probes).Error
+	return probes, err
+}
+
+func DeleteChannelProbes(channelId int) error {
+	return DB.Where("channel_id = ?", channelId).Delete(&ChannelProbe{}).Error
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/budget"
+	"github.com/songquanpeng/one-api/relay/schedule"
+)
+
+// A channel may only be usable at some hours of the week, as set by the schedule of its config, and up to
+// a daily budget of requests and tokens. Out of its schedule or over its budget the channel is paused: it
+// stays enabled but gets no request until it is back in service.
+
+const scheduleTimeFormat = "2006-01-02 15:04 MST"
+
+// HasDailyBudget tells whether the channel limits its daily requests or tokens
+func (cfg ChannelConfig) HasDailyBudget() bool {
+	return cfg.DailyRequestLimit > 0 || cfg.DailyTokenLimit > 0
+}
+
+func (cfg ChannelConfig) location() *time.Location {
+	location, err := schedule.Location(cfg.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+// BudgetPeriod returns the start of the current period of the daily budget
+func (cfg ChannelConfig) BudgetPeriod(now time.Time) time.Time {
+	now = now.In(cfg.location())
+	start, err := schedule.PeriodStart(now, cfg.DailyResetTime)
+	if err != nil {
+		start, _ = schedule.PeriodStart(now, "")
+	}
+	return start
+}
+
+// ValidateSchedule checks the schedule, the time zone and the reset time of the daily budget
+func (cfg ChannelConfig) ValidateSchedule() error {
+	if _, err := schedule.Parse(cfg.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	if _, err := schedule.Location(cfg.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone: %w", err)
+	}
+	if _, err := schedule.PeriodStart(time.Now(), cfg.DailyResetTime); err != nil {
+		return fmt.Errorf("invalid daily reset time: %w", err)
+	}
+	return nil
+}
+
+type channelServiceState struct {
+	inSchedule bool
+	exhausted  bool
+}
+
+func (state channelServiceState) inService() bool {
+	return state.inSchedule && !state.exhausted
+}
+
+// parseConfig parses the config and the schedule of a cached channel once, rather than on each selection
+func (channel *Channel) parseConfig() error {
+	cfg, _ := channel.LoadConfig()
+	channel.parsedConfig = &cfg
+	if err := cfg.ValidateSchedule(); err != nil {
+		return err
+	}
+	channel.parsedSchedule, _ = schedule.Parse(cfg.Schedule)
+	return nil
+}
+
+func (channel *Channel) getSchedule(cfg ChannelConfig) (schedule.Schedule, error) {
+	if channel.parsedSchedule != nil {
+		return channel.parsedSchedule, nil
+	}
+	return schedule.Parse(cfg.Schedule)
+}
+
+// getChannelServiceState checks the channel against its schedule and its daily budget, an invalid schedule
+// is ignored
+func getChannelServiceState(channel *Channel, cfg ChannelConfig, now time.Time) channelServiceState {
+	state := channelServiceState{inSchedule: true}
+	if cfg.Schedule != "" {
+		if channelSchedule, err := channel.getSchedule(cfg); err == nil {
+			state.inSchedule = channelSchedule.Contains(now.In(cfg.location()))
+		}
+	}
+	if cfg.HasDailyBudget() {
+		state.exhausted = budget.Get(channel.Id, cfg.BudgetPeriod(now)).IsExhausted(cfg.DailyRequestLimit, cfg.DailyTokenLimit)
+	}
+	return state
+}
+
+func isChannelInService(channel *Channel) bool {
+	cfg, _ := channel.LoadConfig()
+	if cfg.Schedule == "" && !cfg.HasDailyBudget() {
+		return true
+	}
+	return getChannelServiceState(channel, cfg, time.Now()).inService()
+}
+
+// channelServiceStates is only used by the goroutine of WatchChannelSchedules
+var channelServiceStates = make(map[int]channelServiceState)
+
+// WatchChannelSchedules records in the system log the channels pausing and resuming with their schedule and budget
+func WatchChannelSchedules(frequency time.Duration) {
+	for {
+		checkChannelSchedules(time.Now())
+		time.Sleep(frequency)
+	}
+}
+
+func checkChannelSchedules(now time.Time) {
+	var channels []*Channel
+	err := DB.Omit("key").Where("status = ? and config <> ''", ChannelStatusEnabled).Find(&channels).Error
+	if err != nil {
+		logger.SysError("failed to get the channels to check their schedule: " + err.Error())
+		return
+	}
+	watched := make(map[int]bool)
+	for _, channel := range channels {
+		cfg, _ := channel.LoadConfig()
+		if cfg.Schedule == "" && !cfg.HasDailyBudget() {
+			continue
+		}
+		watched[channel.Id] = true
+		state := getChannelServiceState(channel, cfg, now)
+		previous, ok := channelServiceStates[channel.Id]
+		channelServiceStates[channel.Id] = state
+		if !ok {
+			continue
+		}
+		if previous.inSchedule && !state.inSchedule {
+			channelSchedule, _ := schedule.Parse(cfg.Schedule)
+			recordScheduleLog(fmt.Sprintf("渠道「%s」（#%d）已离开可用时段，暂停使用至 %s", channel.Name, channel.Id,
+				channelSchedule.NextChange(now.In(cfg.location())).Format(scheduleTimeFormat)))
+		}
+		if !previous.inSchedule && state.inSchedule {
+			recordScheduleLog(fmt.Sprintf("渠道「%s」（#%d）已进入可用时段，恢复使用", channel.Name, channel.Id))
+		}
+		if !previous.exhausted && state.exhausted {
+			period := cfg.BudgetPeriod(now)
+			usage := budget.Get(channel.Id, period)
+			recordScheduleLog(fmt.Sprintf("渠道「%s」（#%d）的每日额度已用尽（请求数 %d，token 数 %d），暂停使用至 %s", channel.Name, channel.Id,
+				usage.Requests, usage.Tokens, period.AddDate(0, 0, 1).Format(scheduleTimeFormat)))
+		}
+		if previous.exhausted && !state.exhausted {
+			recordScheduleLog(fmt.Sprintf("渠道「%s」（#%d）的每日额度已重置，恢复使用", channel.Name, channel.Id))
+		}
+	}
+	for channelId := range channelServiceStates {
+		if !watched[channelId] {
+			delete(channelServiceStates, channelId)
+		}
+	}
+}
+
+func recordScheduleLog(content string) {
+	RecordLog(context.Background(), 0, LogTypeSystem, content)
+}
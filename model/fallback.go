@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelFallbacks maps a model to the models tried in order once no channel of it could serve a request,
+// e.g. {"gpt-4o": ["gpt-4o-mini", "claude-3-5-sonnet-20240620"]}
+var ModelFallbacks = map[string][]string{}
+var modelFallbacksLock sync.RWMutex
+
+func ModelFallbacks2JSONString() string {
+	modelFallbacksLock.RLock()
+	defer modelFallbacksLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelFallbacks)
+	if err != nil {
+		logger.SysError("error marshalling model fallbacks: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFallbacksByJSONString(jsonStr string) error {
+	fallbacks := make(map[string][]string)
+	if err := json.Unmarshal([]byte(jsonStr), &fallbacks); err != nil {
+		return err
+	}
+	for modelName, chain := range fallbacks {
+		for _, fallback := range chain {
+			if fallback == "" || fallback == modelName {
+				return fmt.Errorf("invalid fallback %q of model %s", fallback, modelName)
+			}
+		}
+	}
+	modelFallbacksLock.Lock()
+	defer modelFallbacksLock.Unlock()
+	ModelFallbacks = fallbacks
+	return nil
+}
+
+// GetModelFallbacks returns the fallback chain of the model, the chains are not followed transitively
+func GetModelFallbacks(modelName string) []string {
+	modelFallbacksLock.RLock()
+	defer modelFallbacksLock.RUnlock()
+	return ModelFallbacks[modelName]
+}
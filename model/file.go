@@ -0,0 +1,93 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// File 用户通过 /v1/files 上传的文件，内容保存在文件存储中，以 Id 为键
+type File struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`   // 文件ID
+	UserId    int    `json:"user_id" gorm:"not null;index"`           // 用户ID
+	TokenId   int    `json:"token_id" gorm:"not null;index"`          // 上传使用的Token ID
+	Filename  string `json:"filename" gorm:"type:varchar(255)"`       // 原始文件名
+	Purpose   string `json:"purpose" gorm:"type:varchar(32);index"`   // 用途：assistants, batch, fine-tune, vision 等
+	MimeType  string `json:"mime_type" gorm:"type:varchar(128)"`      // 文件类型
+	Bytes     int64  `json:"bytes"`                                   // 文件大小
+	CreatedAt int64  `json:"created_at" gorm:"bigint;not null;index"` // 创建时间
+}
+
+// Insert 插入文件记录
+func (f *File) Insert() error {
+	f.CreatedAt = time.Now().Unix()
+	return DB.Create(f).Error
+}
+
+// InsertWithinQuota 在用户的文件存储配额内插入文件记录，配额为 0 表示不限制，返回插入前已用的大小；
+// 统计前锁定用户行，使并发的上传依次占用配额
+func (f *File) InsertWithinQuota(quota int64) (used int64, ok bool, err error) {
+	if quota <= 0 {
+		return 0, true, f.Insert()
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&User{}, "id = ?", f.UserId).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&File{}).Where("user_id = ?", f.UserId).Select("COALESCE(SUM(bytes), 0)").Scan(&used).Error; err != nil {
+			return err
+		}
+		if used+f.Bytes > quota {
+			return nil
+		}
+		ok = true
+		f.CreatedAt = time.Now().Unix()
+		return tx.Create(f).Error
+	})
+	return used, ok, err
+}
+
+// UpdateBytes 更新文件大小
+func (f *File) UpdateBytes(bytes int64) error {
+	f.Bytes = bytes
+	return DB.Model(f).Update("bytes", bytes).Error
+}
+
+// Delete 删除文件记录
+func (f *File) Delete() error {
+	return DB.Delete(f).Error
+}
+
+// GetFileById 根据ID获取属于该用户和令牌的文件
+func GetFileById(id string, userId int, tokenId int) (*File, error) {
+	var file File
+	err := DB.Where("id = ? AND user_id = ? AND token_id = ?", id, userId, tokenId).First(&file).Error
+	return &file, err
+}
+
+// GetFiles 分页获取属于该用户和令牌的文件，after 为上一页最后一个文件的ID
+func GetFiles(userId int, tokenId int, purpose string, after string, limit int, asc bool) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	order := "created_at desc, id desc"
+	if asc {
+		order = "created_at asc, id asc"
+	}
+	if after != "" {
+		cursor, err := GetFileById(after, userId, tokenId)
+		if err != nil {
+			return nil, err
+		}
+		if asc {
+			query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+		} else {
+			query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+		}
+	}
+	err := query.Order(order).Limit(limit).Find(&files).Error
+	return files, err
+}
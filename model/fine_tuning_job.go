@@ -0,0 +1,104 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// FineTuningJobActiveStatuses 尚未结束的微调任务状态，需要定期向上游同步
+var FineTuningJobActiveStatuses = []string{"validating_files", "queued", "running"}
+
+// FineTuningJob 用户通过 /v1/fine_tuning/jobs 在上游创建的微调任务，之后的请求固定发往创建它的渠道
+type FineTuningJob struct {
+	Id             string `json:"id" gorm:"type:varchar(64);primaryKey"`           // 上游返回的任务ID
+	UserId         int    `json:"user_id" gorm:"not null;index"`                   // 用户ID
+	TokenId        int    `json:"token_id" gorm:"not null"`                        // 创建使用的Token ID
+	ChannelId      int    `json:"channel_id" gorm:"not null;index"`                // 创建任务的渠道ID
+	Model          string `json:"model" gorm:"type:varchar(100)"`                  // 基础模型名称
+	FineTunedModel string `json:"fine_tuned_model" gorm:"type:varchar(255);index"` // 微调得到的 ft: 模型名称
+	Status         string `json:"status" gorm:"type:varchar(32);index"`            // 状态
+	Job            string `json:"job" gorm:"type:text"`                            // 上游最近一次返回的任务对象，JSON
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;not null;index"`         // 创建时间
+}
+
+// Insert 插入微调任务记录
+func (job *FineTuningJob) Insert() error {
+	job.CreatedAt = time.Now().Unix()
+	return DB.Create(job).Error
+}
+
+// Update 更新上游同步回来的状态
+func (job *FineTuningJob) Update() error {
+	return DB.Model(job).Select("fine_tuned_model", "status", "job").Updates(job).Error
+}
+
+// GetFineTuningJobById 根据ID获取用户的微调任务
+func GetFineTuningJobById(id string, userId int) (*FineTuningJob, error) {
+	var job FineTuningJob
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&job).Error
+	return &job, err
+}
+
+// GetFineTuningJobByModel 根据微调得到的模型名称获取微调任务
+func GetFineTuningJobByModel(fineTunedModel string) (*FineTuningJob, error) {
+	var job FineTuningJob
+	err := DB.Where("fine_tuned_model = ?", fineTunedModel).First(&job).Error
+	return &job, err
+}
+
+// GetFineTunedModels 获取用户微调得到的模型名称
+func GetFineTunedModels(userId int) ([]string, error) {
+	var fineTunedModels []string
+	err := DB.Model(&FineTuningJob{}).Where("user_id = ? AND fine_tuned_model <> ''", userId).Pluck("fine_tuned_model", &fineTunedModels).Error
+	return fineTunedModels, err
+}
+
+// GetChannelFineTunedModels 获取在渠道上微调得到的模型名称
+func GetChannelFineTunedModels(channelId int) ([]string, error) {
+	var fineTunedModels []string
+	err := DB.Model(&FineTuningJob{}).Where("channel_id = ? AND fine_tuned_model <> ''", channelId).Pluck("fine_tuned_model", &fineTunedModels).Error
+	return fineTunedModels, err
+}
+
+// AddAbilities 将微调得到的模型注册为创建它的渠道在各分组的 abilities，已存在时不做修改
+func (job *FineTuningJob) AddAbilities() error {
+	channel, err := GetChannelById(job.ChannelId, true)
+	if err != nil {
+		return err
+	}
+	abilities := make([]Ability, 0)
+	for _, group := range strings.Split(channel.Group, ",") {
+		abilities = append(abilities, Ability{
+			Group:     group,
+			Model:     job.FineTunedModel,
+			ChannelId: channel.Id,
+			Enabled:   channel.Status == ChannelStatusEnabled,
+			Priority:  channel.Priority,
+		})
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&abilities).Error
+}
+
+// GetFineTuningJobs 分页获取用户的微调任务，按创建时间倒序，after 为上一页最后一个任务的ID
+func GetFineTuningJobs(userId int, after string, limit int) ([]*FineTuningJob, error) {
+	var jobs []*FineTuningJob
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		cursor, err := GetFineTuningJobById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = afterCursor(query, cursor.CreatedAt, cursor.Id, false)
+	}
+	err := query.Order(listOrder(false)).Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// GetActiveFineTuningJobs 获取所有尚未结束的微调任务
+func GetActiveFineTuningJobs() ([]*FineTuningJob, error) {
+	var jobs []*FineTuningJob
+	err := DB.Where("status IN ?", FineTuningJobActiveStatuses).Find(&jobs).Error
+	return jobs, err
+}
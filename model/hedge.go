@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/circuitbreaker"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
+)
+
+// HedgeDelay sets after how many milliseconds without answer a request is raced on a second channel.
+// The delay of the model takes precedence over the one of the group, e.g.
+// {"groups": {"vip": 1500}, "models": {"gpt-4o-mini": 800}}
+type HedgeDelayConfig struct {
+	Groups map[string]int `json:"groups,omitempty"`
+	Models map[string]int `json:"models,omitempty"`
+}
+
+var HedgeDelay = HedgeDelayConfig{}
+var hedgeDelayLock sync.RWMutex
+
+func HedgeDelay2JSONString() string {
+	hedgeDelayLock.RLock()
+	defer hedgeDelayLock.RUnlock()
+	jsonBytes, err := json.Marshal(HedgeDelay)
+	if err != nil {
+		logger.SysError("error marshalling hedge delay: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateHedgeDelayByJSONString(jsonStr string) error {
+	var hedgeDelay HedgeDelayConfig
+	if err := json.Unmarshal([]byte(jsonStr), &hedgeDelay); err != nil {
+		return err
+	}
+	hedgeDelayLock.Lock()
+	defer hedgeDelayLock.Unlock()
+	HedgeDelay = hedgeDelay
+	return nil
+}
+
+// GetHedgeDelay returns the delay before hedging a request of the group for the model, 0 when it is not hedged
+func GetHedgeDelay(group string, model string) time.Duration {
+	hedgeDelayLock.RLock()
+	defer hedgeDelayLock.RUnlock()
+	delay, ok := HedgeDelay.Models[model]
+	if !ok {
+		delay = HedgeDelay.Groups[group]
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// GetHedgeChannel picks the channel racing the selected one. It must be of the same type and map the model
+// to the same upstream model, so that the request converted for the selected channel can be sent to it as is.
+func GetHedgeChannel(group string, model string, selectedId int, channelType int, actualModel string) *Channel {
+	channels, err := CacheGetSatisfiedChannels(group, model, false)
+	if err != nil {
+		return nil
+	}
+	candidates := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Id == selectedId || channel.Type != channelType || getChannelActualModel(channel, model) != actualModel {
+			continue
+		}
+		candidates = append(candidates, channel)
+	}
+	// a saturated channel would only queue the request
+	candidates = filterSaturated(filterAvailable(candidates, model))
+	for len(candidates) > 0 {
+		channel := pickChannel(group, candidates)
+		if circuitbreaker.Acquire(channel.Id, model) {
+			return channel
+		}
+		others := make([]*Channel, 0, len(candidates)-1)
+		for _, other := range candidates {
+			if other != channel {
+				others = append(others, other)
+			}
+		}
+		candidates = others
+	}
+	return nil
+}
+
+func getChannelActualModel(channel *Channel, model string) string {
+	actualModel, _ := modelpattern.Map(model, channel.GetModelMapping())
+	return actualModel
+}
@@ -29,6 +29,8 @@ type Log struct {
 	ElapsedTime       int64  `json:"elapsed_time" gorm:"default:0"` // unit is ms
 	IsStream          bool   `json:"is_stream" gorm:"default:false"`
 	SystemPromptReset bool   `json:"system_prompt_reset" gorm:"default:false"`
+	FallbackFrom      string `json:"fallback_from" gorm:"default:''"` // 回退前请求的模型
+	UpstreamCost      int    `json:"upstream_cost" gorm:"default:0"`  // 上游成本，按渠道成本倍率折算的额度
 }
 
 const (
@@ -84,6 +86,10 @@ func RecordConsumeLog(ctx context.Context, log *Log) {
 	log.Username = GetUsernameById(log.UserId)
 	log.CreatedAt = helper.GetTimestamp()
 	log.Type = LogTypeConsume
+	if fallbackFrom := helper.GetFallbackFrom(ctx); fallbackFrom != "" {
+		log.FallbackFrom = fallbackFrom
+		log.Content += fmt.Sprintf("，模型回退：%s → %s", fallbackFrom, log.ModelName)
+	}
 	recordLogHelper(ctx, log)
 }
 
@@ -208,6 +214,33 @@ func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return token
 }
 
+// ChannelModelMargin is what the users were charged for a model of a channel and what the channel cost
+type ChannelModelMargin struct {
+	ChannelId    int    `json:"channel_id" gorm:"column:channel_id"`
+	ModelName    string `json:"model_name" gorm:"column:model_name"`
+	RequestCount int    `json:"request_count" gorm:"column:request_count"`
+	Quota        int64  `json:"quota" gorm:"column:quota"`
+	UpstreamCost int64  `json:"upstream_cost" gorm:"column:upstream_cost"`
+	Margin       int64  `json:"margin" gorm:"column:margin"`
+}
+
+func GetChannelModelMargins(startTimestamp int64, endTimestamp int64, channel int) (margins []*ChannelModelMargin, err error) {
+	tx := LOG_DB.Table("logs").
+		Select("channel_id, model_name, count(1) as request_count, sum(quota) as quota, sum(upstream_cost) as upstream_cost, sum(quota) - sum(upstream_cost) as margin").
+		Where("type = ?", LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	err = tx.Group("channel_id, model_name").Order("channel_id, model_name").Scan(&margins).Error
+	return margins, err
+}
+
 func DeleteOldLog(targetTimestamp int64) (int64, error) {
 	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&Log{})
 	return result.RowsAffected, result.Error
@@ -163,6 +163,36 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&ChatRecord{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&ResponseRecord{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&File{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Batch{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Assistant{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Thread{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ThreadMessage{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Run{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&RunStep{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&FineTuningJob{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ChannelProbe{}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -3,6 +3,7 @@ package model
 import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"strconv"
 	"strings"
@@ -70,10 +71,18 @@ func InitOptionMap() {
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["RerankRatio"] = billingratio.RerankRatio2JSONString()
+	config.OptionMap["GroupFileQuota"] = storage.GroupQuota2JSONString()
+	config.OptionMap["GroupSelectionStrategy"] = GroupSelectionStrategy2JSONString()
+	config.OptionMap["ModelFallbacks"] = ModelFallbacks2JSONString()
+	config.OptionMap["HedgeDelay"] = HedgeDelay2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
+	config.OptionMap["BatchRatio"] = strconv.FormatFloat(config.BatchRatio, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["StickySessionMode"] = config.StickySessionMode
+	config.OptionMap["StickySessionTTL"] = strconv.Itoa(config.StickySessionTTL)
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -223,12 +232,26 @@ func updateOptionMap(key string, value string) (err error) {
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "StickySessionMode":
+		config.StickySessionMode = value
+	case "StickySessionTTL":
+		config.StickySessionTTL, _ = strconv.Atoi(value)
 	case "ModelRatio":
 		err = billingratio.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "RerankRatio":
+		err = billingratio.UpdateRerankRatioByJSONString(value)
+	case "GroupFileQuota":
+		err = storage.UpdateGroupQuotaByJSONString(value)
+	case "GroupSelectionStrategy":
+		err = UpdateGroupSelectionStrategyByJSONString(value)
+	case "ModelFallbacks":
+		err = UpdateModelFallbacksByJSONString(value)
+	case "HedgeDelay":
+		err = UpdateHedgeDelayByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
@@ -237,6 +260,8 @@ func updateOptionMap(key string, value string) (err error) {
 		config.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
+	case "BatchRatio":
+		config.BatchRatio, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
 		config.Theme = value
 	}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+// maxResponseChainLength 限制 previous_response_id 回溯的轮数
+const maxResponseChainLength = 100
+
+// ResponseRecord Responses API 响应记录表，用于 previous_response_id 串联上下文
+type ResponseRecord struct {
+	Id                 string `json:"id" gorm:"type:varchar(64);primaryKey"`        // 返回给客户端的响应ID
+	UserId             int    `json:"user_id" gorm:"not null;index"`                // 用户ID
+	TokenId            int    `json:"token_id" gorm:"not null;index"`               // 使用的Token ID
+	ChannelId          int    `json:"channel_id" gorm:"index"`                      // 渠道ID
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64)"` // 上一轮响应ID
+	Model              string `json:"model" gorm:"type:varchar(100)"`               // 使用的模型名称
+	Passthrough        bool   `json:"passthrough"`                                  // 是否由上游 Responses API 直接生成
+	Input              string `json:"input" gorm:"type:text"`                       // 本轮输入消息，chat completions 格式的 JSON
+	Output             string `json:"output" gorm:"type:text"`                      // 本轮输出消息，chat completions 格式的 JSON
+	Response           string `json:"response" gorm:"type:text"`                    // 返回给客户端的完整响应
+	PromptTokens       int    `json:"prompt_tokens" gorm:"default:0"`               // 输入token数
+	CompletionTokens   int    `json:"completion_tokens" gorm:"default:0"`           // 输出token数
+	CreatedTime        int64  `json:"created_time" gorm:"bigint;not null;index"`    // 创建时间
+}
+
+// Insert 插入响应记录
+func (rr *ResponseRecord) Insert() error {
+	rr.CreatedTime = time.Now().Unix()
+	return DB.Create(rr).Error
+}
+
+// GetResponseRecordById 根据ID获取用户的响应记录
+func GetResponseRecordById(id string, userId int) (*ResponseRecord, error) {
+	var record ResponseRecord
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&record).Error
+	return &record, err
+}
+
+// GetResponseRecordChain 沿 previous_response_id 回溯，按时间顺序返回整条响应链
+func GetResponseRecordChain(id string, userId int) ([]*ResponseRecord, error) {
+	var chain []*ResponseRecord
+	for id != "" && len(chain) < maxResponseChainLength {
+		record, err := GetResponseRecordById(id, userId)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, record)
+		id = record.PreviousResponseId
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// DeleteResponseRecordById 根据ID删除用户的响应记录
+func DeleteResponseRecordById(id string, userId int) (int64, error) {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&ResponseRecord{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 运行状态，与 OpenAI Assistants API 保持一致
+const (
+	RunStatusQueued         = "queued"
+	RunStatusInProgress     = "in_progress"
+	RunStatusRequiresAction = "requires_action"
+	RunStatusCancelling     = "cancelling"
+	RunStatusCancelled      = "cancelled"
+	RunStatusFailed         = "failed"
+	RunStatusCompleted      = "completed"
+	RunStatusExpired        = "expired"
+)
+
+// 运行步骤类型
+const (
+	RunStepTypeMessageCreation = "message_creation"
+	RunStepTypeToolCalls       = "tool_calls"
+)
+
+// RunActiveStatuses 尚未结束的运行状态，会话中存在此类运行时不能添加消息或创建新的运行
+var RunActiveStatuses = []string{RunStatusQueued, RunStatusInProgress, RunStatusRequiresAction, RunStatusCancelling}
+
+// Run 助手在会话上的一次运行，由 one-api 通过 chat completions 接口在任意渠道上执行
+type Run struct {
+	Id                  string   `json:"id" gorm:"type:varchar(64);primaryKey"`   // 运行ID
+	UserId              int      `json:"user_id" gorm:"not null;index"`           // 用户ID
+	TokenId             int      `json:"token_id" gorm:"not null"`                // 创建使用的Token ID，执行时以该令牌计费
+	ThreadId            string   `json:"thread_id" gorm:"type:varchar(64);index"` // 所属会话ID
+	AssistantId         string   `json:"assistant_id" gorm:"type:varchar(64)"`    // 助手ID
+	Model               string   `json:"model" gorm:"type:varchar(100)"`          // 模型名称
+	Instructions        string   `json:"instructions" gorm:"type:text"`           // 系统指令
+	Tools               string   `json:"tools" gorm:"type:text"`                  // 工具列表，JSON
+	ToolChoice          string   `json:"tool_choice" gorm:"type:text"`            // 工具选择，JSON
+	ParallelToolCalls   bool     `json:"parallel_tool_calls"`                     // 是否允许并行调用工具
+	ResponseFormat      string   `json:"response_format" gorm:"type:text"`        // 响应格式，JSON
+	Temperature         *float64 `json:"temperature"`                             // 温度
+	TopP                *float64 `json:"top_p"`                                   // top_p
+	MaxCompletionTokens int      `json:"max_completion_tokens" gorm:"default:0"`  // 每次请求的最大输出token数
+	Status              string   `json:"status" gorm:"type:varchar(16);index"`    // 状态
+	RequiredAction      string   `json:"required_action" gorm:"type:text"`        // 等待提交的工具调用，JSON
+	LastError           string   `json:"last_error" gorm:"type:text"`             // 失败原因，JSON
+	PromptTokens        int      `json:"prompt_tokens" gorm:"default:0"`          // 累计输入token数
+	CompletionTokens    int      `json:"completion_tokens" gorm:"default:0"`      // 累计输出token数
+	Metadata            string   `json:"metadata" gorm:"type:text"`               // 用户自定义元数据，JSON
+	CreatedAt           int64    `json:"created_at" gorm:"bigint;not null;index"` // 创建时间
+	StartedAt           int64    `json:"started_at" gorm:"bigint;default:0"`      // 开始执行时间
+	ExpiresAt           int64    `json:"expires_at" gorm:"bigint;default:0"`      // 截止时间
+	CancelledAt         int64    `json:"cancelled_at" gorm:"bigint;default:0"`    // 取消时间
+	FailedAt            int64    `json:"failed_at" gorm:"bigint;default:0"`       // 失败时间
+	CompletedAt         int64    `json:"completed_at" gorm:"bigint;default:0"`    // 完成时间
+}
+
+// RunStep 运行中的一个步骤：生成一条消息或一组工具调用
+type RunStep struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`   // 步骤ID
+	UserId           int    `json:"user_id" gorm:"not null;index"`           // 用户ID
+	RunId            string `json:"run_id" gorm:"type:varchar(64);index"`    // 所属运行ID
+	ThreadId         string `json:"thread_id" gorm:"type:varchar(64);index"` // 所属会话ID
+	AssistantId      string `json:"assistant_id" gorm:"type:varchar(64)"`    // 助手ID
+	Type             string `json:"type" gorm:"type:varchar(32)"`            // 类型：message_creation 或 tool_calls
+	Status           string `json:"status" gorm:"type:varchar(16)"`          // 状态
+	StepDetails      string `json:"step_details" gorm:"type:text"`           // 步骤详情，JSON
+	LastError        string `json:"last_error" gorm:"type:text"`             // 失败原因，JSON
+	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`          // 输入token数
+	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`      // 输出token数
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;not null;index"` // 创建时间
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint;default:0"`    // 取消时间
+	FailedAt         int64  `json:"failed_at" gorm:"bigint;default:0"`       // 失败时间
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint;default:0"`    // 完成时间
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint;default:0"`      // 过期时间
+}
+
+// Insert 插入运行记录
+func (r *Run) Insert() error {
+	r.CreatedAt = time.Now().Unix()
+	return DB.Create(r).Error
+}
+
+// UpdateMetadata 更新运行的元数据
+func (r *Run) UpdateMetadata() error {
+	return DB.Model(r).Select("metadata").Updates(r).Error
+}
+
+// UpdateRunStatus 仅当运行处于 from 中的某个状态时更新，返回是否更新成功，用于避免并发的状态切换互相覆盖
+func UpdateRunStatus(id string, from []string, updates map[string]any) (bool, error) {
+	result := DB.Model(&Run{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// AddRunUsage 累加运行消耗的token数
+func AddRunUsage(id string, promptTokens int, completionTokens int) error {
+	return DB.Model(&Run{}).Where("id = ?", id).Updates(map[string]any{
+		"prompt_tokens":     gorm.Expr("prompt_tokens + ?", promptTokens),
+		"completion_tokens": gorm.Expr("completion_tokens + ?", completionTokens),
+	}).Error
+}
+
+// GetRunById 根据ID获取会话中的运行
+func GetRunById(id string, threadId string, userId int) (*Run, error) {
+	var run Run
+	err := DB.Where("id = ? AND thread_id = ? AND user_id = ?", id, threadId, userId).First(&run).Error
+	return &run, err
+}
+
+// GetRunByIdOnly 根据ID获取运行，执行运行时使用
+func GetRunByIdOnly(id string) (*Run, error) {
+	var run Run
+	err := DB.Where("id = ?", id).First(&run).Error
+	return &run, err
+}
+
+// GetRuns 分页获取会话中的运行，after 为上一页最后一个运行的ID
+func GetRuns(threadId string, userId int, after string, limit int, asc bool) ([]*Run, error) {
+	var runs []*Run
+	query := DB.Where("thread_id = ? AND user_id = ?", threadId, userId)
+	if after != "" {
+		cursor, err := GetRunById(after, threadId, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = afterCursor(query, cursor.CreatedAt, cursor.Id, asc)
+	}
+	err := query.Order(listOrder(asc)).Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// GetRunsByStatus 获取处于指定状态的所有运行，按创建时间排序
+func GetRunsByStatus(statuses ...string) ([]*Run, error) {
+	var runs []*Run
+	err := DB.Where("status IN ?", statuses).Order("created_at asc").Find(&runs).Error
+	return runs, err
+}
+
+// GetActiveRun 获取会话中尚未结束且未过期的运行
+func GetActiveRun(threadId string) (*Run, error) {
+	var run Run
+	err := DB.Where("thread_id = ? AND status IN ? AND expires_at > ?", threadId, RunActiveStatuses, time.Now().Unix()).
+		First(&run).Error
+	return &run, err
+}
+
+// Insert 插入运行步骤记录
+func (s *RunStep) Insert() error {
+	s.CreatedAt = time.Now().Unix()
+	return DB.Create(s).Error
+}
+
+// Update 更新运行步骤的状态和详情
+func (s *RunStep) Update() error {
+	return DB.Model(s).Select("status", "step_details", "last_error",
+		"cancelled_at", "failed_at", "completed_at", "expired_at").Updates(s).Error
+}
+
+// GetRunStepById 根据ID获取运行中的步骤
+func GetRunStepById(id string, runId string, userId int) (*RunStep, error) {
+	var step RunStep
+	err := DB.Where("id = ? AND run_id = ? AND user_id = ?", id, runId, userId).First(&step).Error
+	return &step, err
+}
+
+// GetRunSteps 分页获取运行中的步骤，after 为上一页最后一个步骤的ID
+func GetRunSteps(runId string, userId int, after string, limit int, asc bool) ([]*RunStep, error) {
+	var steps []*RunStep
+	query := DB.Where("run_id = ? AND user_id = ?", runId, userId)
+	if after != "" {
+		cursor, err := GetRunStepById(after, runId, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = afterCursor(query, cursor.CreatedAt, cursor.Id, asc)
+	}
+	err := query.Order(listOrder(asc)).Limit(limit).Find(&steps).Error
+	return steps, err
+}
+
+// GetAllRunSteps 按时间顺序获取运行的所有步骤
+func GetAllRunSteps(runId string) ([]*RunStep, error) {
+	var steps []*RunStep
+	err := DB.Where("run_id = ?", runId).Order(listOrder(true)).Find(&steps).Error
+	return steps, err
+}
+
+// GetPendingToolCallsStep 获取运行中等待工具输出的步骤
+func GetPendingToolCallsStep(runId string) (*RunStep, error) {
+	var step RunStep
+	err := DB.Where("run_id = ? AND type = ? AND status = ?", runId, RunStepTypeToolCalls, RunStatusInProgress).
+		First(&step).Error
+	return &step, err
+}
+
+// CloseRunSteps 运行结束时将仍在进行的步骤标记为同样的结束状态，timeColumn 为对应的时间字段
+func CloseRunSteps(runId string, status string, timeColumn string) error {
+	return DB.Model(&RunStep{}).Where("run_id = ? AND status = ?", runId, RunStatusInProgress).
+		Updates(map[string]any{"status": status, timeColumn: time.Now().Unix()}).Error
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	StickySessionModeUser   = "user"
+	StickySessionModeToken  = "token"
+	StickySessionModePrefix = "prefix"
+)
+
+// StickySession is the channel and key that last served a session
+type StickySession struct {
+	ChannelId      int    `json:"channel_id"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+}
+
+type stickySessionEntry struct {
+	session   StickySession
+	expiresAt time.Time
+}
+
+var stickySessionsLock sync.Mutex
+var stickySessions = make(map[string]stickySessionEntry)
+var stickySessionsSweptAt = time.Now()
+
+func stickySessionTTL() time.Duration {
+	return time.Duration(config.StickySessionTTL) * time.Second
+}
+
+// GetStickySession returns the session bound to the key, or nil when there is none
+func GetStickySession(sessionKey string) *StickySession {
+	if sessionKey == "" {
+		return nil
+	}
+	if common.RedisEnabled {
+		value, err := common.RedisGet("sticky_session:" + sessionKey)
+		if err != nil {
+			return nil
+		}
+		var session StickySession
+		if err = json.Unmarshal([]byte(value), &session); err != nil {
+			logger.SysError("failed to unmarshal sticky session: " + err.Error())
+			return nil
+		}
+		return &session
+	}
+	stickySessionsLock.Lock()
+	defer stickySessionsLock.Unlock()
+	entry, ok := stickySessions[sessionKey]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return &entry.session
+}
+
+// SetStickySession binds the session to the channel and key that served it, the binding expires after
+// config.StickySessionTTL without request
+func SetStickySession(sessionKey string, session StickySession) {
+	if sessionKey == "" {
+		return
+	}
+	if common.RedisEnabled {
+		jsonBytes, err := json.Marshal(session)
+		if err != nil {
+			logger.SysError("failed to marshal sticky session: " + err.Error())
+			return
+		}
+		if err = common.RedisSet("sticky_session:"+sessionKey, string(jsonBytes), stickySessionTTL()); err != nil {
+			logger.SysError("failed to set sticky session: " + err.Error())
+		}
+		return
+	}
+	stickySessionsLock.Lock()
+	defer stickySessionsLock.Unlock()
+	now := time.Now()
+	if now.Sub(stickySessionsSweptAt) > stickySessionTTL() {
+		for key, entry := range stickySessions {
+			if now.After(entry.expiresAt) {
+				delete(stickySessions, key)
+			}
+		}
+		stickySessionsSweptAt = now
+	}
+	stickySessions[sessionKey] = stickySessionEntry{
+		session:   session,
+		expiresAt: now.Add(stickySessionTTL()),
+	}
+}
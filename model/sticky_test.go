@@ -0,0 +1,47 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestStickySession(t *testing.T) {
+	common.RedisEnabled = false
+	config.StickySessionTTL = 60
+	defer func() { config.StickySessionTTL = 3600 }()
+
+	assert.Nil(t, GetStickySession(""))
+	assert.Nil(t, GetStickySession("default:gpt-4o:user:1"))
+	SetStickySession("default:gpt-4o:user:1", StickySession{ChannelId: 3, KeyFingerprint: "abc"})
+	assert.Equal(t, &StickySession{ChannelId: 3, KeyFingerprint: "abc"}, GetStickySession("default:gpt-4o:user:1"))
+	// the session follows the last channel that served it
+	SetStickySession("default:gpt-4o:user:1", StickySession{ChannelId: 4})
+	assert.Equal(t, 4, GetStickySession("default:gpt-4o:user:1").ChannelId)
+
+	// the session expires after the TTL without request
+	stickySessionsLock.Lock()
+	entry := stickySessions["default:gpt-4o:user:1"]
+	assert.WithinDuration(t, time.Now().Add(time.Minute), entry.expiresAt, time.Second)
+	entry.expiresAt = time.Now().Add(-time.Second)
+	stickySessions["default:gpt-4o:user:1"] = entry
+	stickySessionsLock.Unlock()
+	assert.Nil(t, GetStickySession("default:gpt-4o:user:1"))
+
+	// the expired sessions are swept once per TTL by the next binding
+	SetStickySession("default:gpt-4o:user:2", StickySession{ChannelId: 5})
+	stickySessionsLock.Lock()
+	assert.Contains(t, stickySessions, "default:gpt-4o:user:1")
+	stickySessionsSweptAt = time.Now().Add(-2 * time.Minute)
+	stickySessionsLock.Unlock()
+	SetStickySession("default:gpt-4o:user:3", StickySession{ChannelId: 6})
+	stickySessionsLock.Lock()
+	assert.NotContains(t, stickySessions, "default:gpt-4o:user:1")
+	assert.Contains(t, stickySessions, "default:gpt-4o:user:2")
+	assert.WithinDuration(t, time.Now(), stickySessionsSweptAt, time.Second)
+	stickySessionsLock.Unlock()
+}
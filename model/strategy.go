@@ -0,0 +1,172 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/channelstat"
+)
+
+const (
+	SelectionStrategyRandom   = "random"
+	SelectionStrategyAdaptive = "adaptive"
+	SelectionStrategyCheapest = "cheapest"
+)
+
+// SelectionStrategy spreads the requests over the channels of the same priority, it scores
+// each channel and the channels are picked at random in proportion to their scores.
+type SelectionStrategy interface {
+	Scores(channels []*Channel) []float64
+}
+
+var selectionStrategies = map[string]SelectionStrategy{
+	SelectionStrategyRandom:   weightedRandomStrategy{},
+	SelectionStrategyAdaptive: adaptiveStrategy{},
+	SelectionStrategyCheapest: cheapestStrategy{},
+}
+
+// GroupSelectionStrategy maps the groups to the name of their strategy, the groups not listed use random
+var GroupSelectionStrategy = map[string]string{}
+var groupSelectionStrategyLock sync.RWMutex
+
+func GroupSelectionStrategy2JSONString() string {
+	groupSelectionStrategyLock.RLock()
+	defer groupSelectionStrategyLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupSelectionStrategy)
+	if err != nil {
+		logger.SysError("error marshalling group selection strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupSelectionStrategyByJSONString(jsonStr string) error {
+	groupStrategy := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &groupStrategy); err != nil {
+		return err
+	}
+	for group, name := range groupStrategy {
+		if _, ok := selectionStrategies[name]; !ok {
+			return fmt.Errorf("unknown selection strategy %s of group %s", name, group)
+		}
+	}
+	groupSelectionStrategyLock.Lock()
+	defer groupSelectionStrategyLock.Unlock()
+	GroupSelectionStrategy = groupStrategy
+	return nil
+}
+
+func getSelectionStrategy(group string) SelectionStrategy {
+	groupSelectionStrategyLock.RLock()
+	defer groupSelectionStrategyLock.RUnlock()
+	if strategy, ok := selectionStrategies[GroupSelectionStrategy[group]]; ok {
+		return strategy
+	}
+	return selectionStrategies[SelectionStrategyRandom]
+}
+
+// pickChannel picks a channel at random, in proportion to the scores given by the strategy of the group
+func pickChannel(group string, channels []*Channel) *Channel {
+	scores := getSelectionStrategy(group).Scores(channels)
+	totalScore := 0.0
+	for _, score := range scores {
+		totalScore += score
+	}
+	n := rand.Float64() * totalScore
+	for i, score := range scores {
+		n -= score
+		if n < 0 {
+			return channels[i]
+		}
+	}
+	return channels[len(channels)-1]
+}
+
+// weightedRandomStrategy only follows the weights of the channels
+type weightedRandomStrategy struct{}
+
+func (weightedRandomStrategy) Scores(channels []*Channel) []float64 {
+	scores := make([]float64, len(channels))
+	for i, channel := range channels {
+		scores[i] = float64(channel.GetWeight())
+	}
+	return scores
+}
+
+// minAdaptiveFactor keeps some traffic on the degraded channels, so that their recovery is noticed
+const minAdaptiveFactor = 0.05
+
+// adaptiveStrategy scales the weights by the recent time to first token, latency and error rate of
+// the channels. The latencies are compared to the fastest channel, and the channels without enough
+// recent requests are assumed to be as good as the best one.
+type adaptiveStrategy struct{}
+
+func (adaptiveStrategy) Scores(channels []*Channel) []float64 {
+	stats := make([]channelstat.Stat, len(channels))
+	known := make([]bool, len(channels))
+	bestTTFT, bestLatency := math.MaxFloat64, math.MaxFloat64
+	for i, channel := range channels {
+		stats[i], known[i] = channelstat.Get(channel.Id)
+		if known[i] && stats[i].Latency > 0 {
+			bestTTFT = math.Min(bestTTFT, stats[i].TTFT)
+			bestLatency = math.Min(bestLatency, stats[i].Latency)
+		}
+	}
+	scores := make([]float64, len(channels))
+	for i, channel := range channels {
+		factor := 1.0
+		if known[i] {
+			speed := 0.0
+			if stats[i].Latency > 0 {
+				speed = 0.5*ratio(bestTTFT, stats[i].TTFT) + 0.5*ratio(bestLatency, stats[i].Latency)
+			}
+			health := (1 - stats[i].ErrorRate) * (1 - stats[i].ErrorRate)
+			factor = math.Max(speed*health, minAdaptiveFactor)
+		}
+		scores[i] = float64(channel.GetWeight()) * factor
+	}
+	return scores
+}
+
+// maxCheapestErrorRate is the recent error rate above which a channel is only used when no cheap one is healthy
+const maxCheapestErrorRate = 0.5
+
+// cheapestStrategy sends the requests to the healthy channels of the lowest cost multiplier, in proportion
+// to their weights. The channels without enough recent requests are assumed to be healthy.
+type cheapestStrategy struct{}
+
+func (cheapestStrategy) Scores(channels []*Channel) []float64 {
+	costs := make([]float64, len(channels))
+	healthy := make([]bool, len(channels))
+	anyHealthy := false
+	for i, channel := range channels {
+		cfg, _ := channel.LoadConfig()
+		costs[i] = cfg.GetCostMultiplier()
+		stat, ok := channelstat.Get(channel.Id)
+		healthy[i] = !ok || stat.ErrorRate < maxCheapestErrorRate
+		anyHealthy = anyHealthy || healthy[i]
+	}
+	minCost := math.MaxFloat64
+	for i := range channels {
+		if healthy[i] || !anyHealthy {
+			minCost = math.Min(minCost, costs[i])
+		}
+	}
+	scores := make([]float64, len(channels))
+	for i, channel := range channels {
+		if (healthy[i] || !anyHealthy) && costs[i] == minCost {
+			scores[i] = float64(channel.GetWeight())
+		}
+	}
+	return scores
+}
+
+func ratio(best float64, value float64) float64 {
+	if value <= best {
+		return 1
+	}
+	return best / value
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/channelstat"
+)
+
+func newTestChannel(id int, weight uint, config string) *Channel {
+	return &Channel{Id: id, Weight: &weight, Config: config}
+}
+
+func TestWeightedRandomStrategy(t *testing.T) {
+	cases := []struct {
+		name     string
+		channels []*Channel
+		scores   []float64
+	}{
+		{"default weights", []*Channel{newTestChannel(1, 0, ""), {Id: 2}}, []float64{1, 1}},
+		{"weights", []*Channel{newTestChannel(1, 3, ""), newTestChannel(2, 1, ""), newTestChannel(3, 0, "")}, []float64{3, 1, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.scores, weightedRandomStrategy{}.Scores(c.channels))
+		})
+	}
+}
+
+func TestPickChannel(t *testing.T) {
+	channels := []*Channel{newTestChannel(1, 3, ""), newTestChannel(2, 1, "")}
+	picks := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		picks[pickChannel("default", channels).Id]++
+	}
+	// the first channel gets about three quarters of the requests
+	assert.InDelta(t, 3000, picks[1], 200)
+	assert.Equal(t, 4000, picks[1]+picks[2])
+}
+
+// recordTestStat fills the statistics of the channel with the same request repeated
+func recordTestStat(channelId int, latency time.Duration, success bool) {
+	for i := 0; i < channelstat.MinSamples; i++ {
+		channelstat.Record(channelId, latency, latency, success)
+	}
+}
+
+func TestAdaptiveStrategy(t *testing.T) {
+	recordTestStat(1301, 100*time.Millisecond, true)
+	recordTestStat(1302, 400*time.Millisecond, true)
+	recordTestStat(1303, 0, false)
+	cases := []struct {
+		name     string
+		channels []*Channel
+		scores   []float64
+	}{
+		{"no stats", []*Channel{newTestChannel(1300, 2, ""), newTestChannel(1399, 1, "")}, []float64{2, 1}},
+		// the slow channel is scaled by its latency compared to the fastest one
+		{"latency", []*Channel{newTestChannel(1301, 1, ""), newTestChannel(1302, 2, "")}, []float64{1, 0.5}},
+		// the failing channel keeps a little traffic, the unknown one is as good as the best
+		{"errors", []*Channel{newTestChannel(1301, 1, ""), newTestChannel(1303, 1, ""), newTestChannel(1300, 1, "")}, []float64{1, minAdaptiveFactor, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.InDeltaSlice(t, c.scores, adaptiveStrategy{}.Scores(c.channels), 1e-9)
+		})
+	}
+}
+
+func TestCheapestStrategy(t *testing.T) {
+	recordTestStat(2302, 100*time.Millisecond, false)
+	recordTestStat(2312, 100*time.Millisecond, false)
+	recordTestStat(2313, 100*time.Millisecond, false)
+	cases := []struct {
+		name     string
+		channels []*Channel
+		scores   []float64
+	}{
+		{"default cost", []*Channel{newTestChannel(2300, 2, ""), newTestChannel(2301, 1, "")}, []float64{2, 1}},
+		// the cheapest channels share the requests by weight
+		{"cheapest", []*Channel{
+			newTestChannel(2300, 2, `{"cost_multiplier":0.8}`),
+			newTestChannel(2301, 1, `{"cost_multiplier":0.8}`),
+			newTestChannel(2303, 5, `{"cost_multiplier":1.2}`),
+		}, []float64{2, 1, 0}},
+		// a cheaper channel failing most of its requests is skipped
+		{"unhealthy", []*Channel{
+			newTestChannel(2302, 1, `{"cost_multiplier":0.5}`),
+			newTestChannel(2300, 1, `{"cost_multiplier":0.8}`),
+		}, []float64{0, 1}},
+		// when none is healthy the cheapest one is used anyway
+		{"none healthy", []*Channel{
+			newTestChannel(2312, 1, `{"cost_multiplier":0.5}`),
+			newTestChannel(2313, 1, `{"cost_multiplier":0.8}`),
+		}, []float64{1, 0}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.scores, cheapestStrategy{}.Scores(c.channels))
+		})
+	}
+}
+
+func TestPickChannelOfGroupStrategy(t *testing.T) {
+	err := UpdateGroupSelectionStrategyByJSONString(`{"vip":"cheapest"}`)
+	assert.NoError(t, err)
+	defer UpdateGroupSelectionStrategyByJSONString("{}")
+	channels := []*Channel{
+		newTestChannel(2320, 100, `{"cost_multiplier":1.5}`),
+		newTestChannel(2321, 1, `{"cost_multiplier":0.5}`),
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, 2321, pickChannel("vip", channels).Id)
+	}
+}
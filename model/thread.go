@@ -0,0 +1,121 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Thread 用户通过 /v1/threads 创建的会话，保存助手运行所需的消息历史
+type Thread struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`   // 会话ID
+	UserId    int    `json:"user_id" gorm:"not null;index"`           // 用户ID
+	Metadata  string `json:"metadata" gorm:"type:text"`               // 用户自定义元数据，JSON
+	CreatedAt int64  `json:"created_at" gorm:"bigint;not null;index"` // 创建时间
+}
+
+// ThreadMessage 会话中的一条消息，由用户添加或由运行生成
+type ThreadMessage struct {
+	Id          string `json:"id" gorm:"type:varchar(64);primaryKey"`   // 消息ID
+	UserId      int    `json:"user_id" gorm:"not null;index"`           // 用户ID
+	ThreadId    string `json:"thread_id" gorm:"type:varchar(64);index"` // 所属会话ID
+	Role        string `json:"role" gorm:"type:varchar(16)"`            // 角色：user 或 assistant
+	Content     string `json:"content" gorm:"type:text"`                // 内容块列表，Assistants API 格式的 JSON
+	AssistantId string `json:"assistant_id" gorm:"type:varchar(64)"`    // 生成该消息的助手ID
+	RunId       string `json:"run_id" gorm:"type:varchar(64);index"`    // 生成该消息的运行ID
+	Metadata    string `json:"metadata" gorm:"type:text"`               // 用户自定义元数据，JSON
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;not null;index"` // 创建时间
+}
+
+// listOrder 列表排序，创建时间相同时按ID排序，ID 带有时间前缀，保证同一秒内的先后顺序
+func listOrder(asc bool) string {
+	if asc {
+		return "created_at asc, id asc"
+	}
+	return "created_at desc, id desc"
+}
+
+// afterCursor 只保留排在游标之后的记录
+func afterCursor(query *gorm.DB, createdAt int64, id string, asc bool) *gorm.DB {
+	if asc {
+		return query.Where("(created_at > ? OR (created_at = ? AND id > ?))", createdAt, createdAt, id)
+	}
+	return query.Where("(created_at < ? OR (created_at = ? AND id < ?))", createdAt, createdAt, id)
+}
+
+// Insert 插入会话记录
+func (t *Thread) Insert() error {
+	t.CreatedAt = time.Now().Unix()
+	return DB.Create(t).Error
+}
+
+// UpdateMetadata 更新会话的元数据
+func (t *Thread) UpdateMetadata() error {
+	return DB.Model(t).Select("metadata").Updates(t).Error
+}
+
+// Delete 删除会话及其消息、运行和运行步骤
+func (t *Thread) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("thread_id = ?", t.Id).Delete(&ThreadMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("thread_id = ?", t.Id).Delete(&RunStep{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("thread_id = ?", t.Id).Delete(&Run{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(t).Error
+	})
+}
+
+// GetThreadById 根据ID获取用户的会话
+func GetThreadById(id string, userId int) (*Thread, error) {
+	var thread Thread
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&thread).Error
+	return &thread, err
+}
+
+// Insert 插入消息记录
+func (m *ThreadMessage) Insert() error {
+	m.CreatedAt = time.Now().Unix()
+	return DB.Create(m).Error
+}
+
+// UpdateMetadata 更新消息的元数据
+func (m *ThreadMessage) UpdateMetadata() error {
+	return DB.Model(m).Select("metadata").Updates(m).Error
+}
+
+// GetThreadMessageById 根据ID获取会话中的消息
+func GetThreadMessageById(id string, threadId string, userId int) (*ThreadMessage, error) {
+	var message ThreadMessage
+	err := DB.Where("id = ? AND thread_id = ? AND user_id = ?", id, threadId, userId).First(&message).Error
+	return &message, err
+}
+
+// GetThreadMessages 分页获取会话中的消息，runId 不为空时只返回该运行生成的消息
+func GetThreadMessages(threadId string, userId int, runId string, after string, limit int, asc bool) ([]*ThreadMessage, error) {
+	var messages []*ThreadMessage
+	query := DB.Where("thread_id = ? AND user_id = ?", threadId, userId)
+	if runId != "" {
+		query = query.Where("run_id = ?", runId)
+	}
+	if after != "" {
+		cursor, err := GetThreadMessageById(after, threadId, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = afterCursor(query, cursor.CreatedAt, cursor.Id, asc)
+	}
+	err := query.Order(listOrder(asc)).Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+// GetThreadHistory 按时间顺序获取运行开始前会话中的所有消息，作为对话上下文
+func GetThreadHistory(threadId string, excludeRunId string) ([]*ThreadMessage, error) {
+	var messages []*ThreadMessage
+	err := DB.Where("thread_id = ? AND run_id <> ?", threadId, excludeRunId).Order(listOrder(true)).Find(&messages).Error
+	return messages, err
+}
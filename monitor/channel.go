@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/songquanpeng/one-api/common/config"
@@ -44,6 +45,67 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	notifyRootUser(subject, content)
 }
 
+// DisableChannelOrKey disables the key of a multi-key channel, the channel itself is only disabled with its last key
+func DisableChannelOrKey(channelId int, channelName string, keyFingerprint string, reason string) {
+	if keyFingerprint == "" {
+		DisableChannel(channelId, channelName, reason)
+		return
+	}
+	allDisabled, err := model.SetChannelKeyStatus(channelId, keyFingerprint, model.ChannelStatusAutoDisabled, reason)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to disable key %s of channel #%d: %s", keyFingerprint, channelId, err.Error()))
+		return
+	}
+	logger.SysLog(fmt.Sprintf("key %s of channel #%d has been disabled: %s", keyFingerprint, channelId, reason))
+	if allDisabled {
+		DisableChannel(channelId, channelName, "所有密钥均已被禁用，最后一个密钥的禁用原因："+reason)
+	}
+}
+
+// DisableAbility disables a single model of the channel & notify
+func DisableAbility(channelId int, channelName string, modelName string, reason string) {
+	err := model.SetAbilityStatus(channelId, modelName, model.ChannelStatusAutoDisabled, reason)
+	if errors.Is(err, model.ErrModelNotListed) {
+		// the names served through a pattern are made up by the clients, the failure of the request is enough
+		return
+	}
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to disable model %s of channel #%d: %s", modelName, channelId, err.Error()))
+		return
+	}
+	logger.SysLog(fmt.Sprintf("model %s of channel #%d has been disabled: %s", modelName, channelId, reason))
+	subject := fmt.Sprintf("渠道状态变更提醒")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>您好！</p>
+			<p>渠道「<strong>%s</strong>」（#%d）的模型 <strong>%s</strong> 已被禁用，该渠道的其他模型不受影响。</p>
+			<p>禁用原因：</p>
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+		`, channelName, channelId, modelName, reason),
+	)
+	notifyRootUser(subject, content)
+}
+
+// EnableAbility enables a model of the channel that was disabled on its own
+func EnableAbility(channelId int, channelName string, modelName string) {
+	err := model.SetAbilityStatus(channelId, modelName, model.ChannelStatusEnabled, "")
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to enable model %s of channel #%d: %s", modelName, channelId, err.Error()))
+		return
+	}
+	logger.SysLog(fmt.Sprintf("model %s of channel #%d has been enabled", modelName, channelId))
+	subject := fmt.Sprintf("渠道状态变更提醒")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>您好！</p>
+			<p>渠道「<strong>%s</strong>」（#%d）的模型 <strong>%s</strong> 已被重新启用。</p>
+		`, channelName, channelId, modelName),
+	)
+	notifyRootUser(subject, content)
+}
+
 func MetricDisableChannel(channelId int, successRate float64) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
@@ -62,6 +124,10 @@ func MetricDisableChannel(channelId int, successRate float64) {
 
 // EnableChannel enable & notify
 func EnableChannel(channelId int, channelName string) {
+	// the keys disabled with the channel would disable it again on the first error of a key
+	if err := model.EnableAutoDisabledChannelKeys(channelId); err != nil {
+		logger.SysError(fmt.Sprintf("failed to enable the keys of channel #%d: %s", channelId, err.Error()))
+	}
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusEnabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been enabled", channelId))
 	subject := fmt.Sprintf("渠道状态变更提醒")
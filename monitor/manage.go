@@ -43,6 +43,34 @@ func ShouldDisableChannel(err *model.Error, statusCode int) bool {
 	return false
 }
 
+// ShouldDisableAbility tells whether the error is about the requested model only, such as a model that the
+// upstream doesn't serve or deprecated, in which case the other models of the channel may keep working
+func ShouldDisableAbility(err *model.Error, statusCode int) bool {
+	if !config.AutomaticDisableChannelEnabled {
+		return false
+	}
+	if err == nil {
+		return false
+	}
+	switch err.Code {
+	case "model_not_found", "model_not_available", "model_deprecated", "unsupported_model":
+		return true
+	}
+	if err.Type == "model_not_found" {
+		return true
+	}
+	lowerMessage := strings.ToLower(err.Message)
+	if strings.Contains(lowerMessage, "model_not_found") ||
+		strings.Contains(lowerMessage, "has been deprecated") ||
+		strings.Contains(lowerMessage, "has been decommissioned") ||
+		strings.Contains(lowerMessage, "is deprecated") ||
+		strings.Contains(lowerMessage, "model not found") ||
+		statusCode == http.StatusNotFound && strings.Contains(lowerMessage, "model") && strings.Contains(lowerMessage, "does not exist") {
+		return true
+	}
+	return false
+}
+
 func ShouldEnableChannel(err error, openAIErr *model.Error) bool {
 	if !config.AutomaticEnableChannelEnabled {
 		return false
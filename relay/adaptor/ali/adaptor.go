@@ -29,6 +29,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", meta.BaseURL)
 	case relaymode.ImagesGenerations:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", meta.BaseURL)
+	case relaymode.ImagesEdits:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/image2image/image-synthesis", meta.BaseURL)
 	default:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text-generation/generation", meta.BaseURL)
 	}
@@ -44,9 +46,13 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	}
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 
-	if meta.Mode == relaymode.ImagesGenerations {
+	if meta.Mode == relaymode.ImagesGenerations || meta.Mode == relaymode.ImagesEdits {
 		req.Header.Set("X-DashScope-Async", "enable")
 	}
+	if meta.Mode == relaymode.ImagesEdits {
+		// the multipart request of the client is converted to json
+		req.Header.Set("Content-Type", "application/json")
+	}
 	if a.meta.Config.Plugin != "" {
 		req.Header.Set("X-DashScope-Plugin", a.meta.Config.Plugin)
 	}
@@ -72,6 +78,9 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 		return nil, errors.New("request is nil")
 	}
 
+	if a.meta.Mode == relaymode.ImagesEdits {
+		return ConvertImageEditRequest(*request)
+	}
 	aliRequest := ConvertImageRequest(*request)
 	return aliRequest, nil
 }
@@ -87,7 +96,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		switch meta.Mode {
 		case relaymode.Embeddings:
 			err, usage = EmbeddingHandler(c, resp)
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits:
 			err, usage = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp)
@@ -3,6 +3,7 @@ package ali
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/render"
 	"io"
@@ -78,6 +79,24 @@ func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
 	return &imageRequest
 }
 
+func ConvertImageEditRequest(request model.ImageRequest) (*ImageEditRequest, error) {
+	if len(request.Image) == 0 {
+		return nil, errors.New("image is required")
+	}
+	var imageRequest ImageEditRequest
+	imageRequest.Model = request.Model
+	imageRequest.Input.Prompt = request.Prompt
+	imageRequest.Input.BaseImageUrl = request.Image[0].DataURL()
+	imageRequest.Input.Function = "description_edit"
+	if request.Mask != nil {
+		// only the masked area is repainted
+		imageRequest.Input.Function = "description_edit_with_mask"
+		imageRequest.Input.MaskImageUrl = request.Mask.DataURL()
+	}
+	imageRequest.Parameters.N = request.N
+	return &imageRequest, nil
+}
+
 func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
 	var aliResponse EmbeddingResponse
 	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
@@ -48,6 +48,20 @@ type ImageRequest struct {
 	ResponseFormat string `json:"response_format,omitempty"`
 }
 
+// ImageEditRequest https://help.aliyun.com/zh/model-studio/wanx-image-edit-api-reference
+type ImageEditRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Function     string `json:"function"`
+		Prompt       string `json:"prompt"`
+		BaseImageUrl string `json:"base_image_url"`
+		MaskImageUrl string `json:"mask_image_url,omitempty"`
+	} `json:"input"`
+	Parameters struct {
+		N int `json:"n,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
 type TaskResponse struct {
 	StatusCode int    `json:"status_code,omitempty"`
 	RequestId  string `json:"request_id,omitempty"`
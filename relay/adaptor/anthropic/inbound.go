@@ -0,0 +1,474 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.anthropic.com/en/api/messages
+// This file converts the inbound Messages API to OpenAI chat completions and back,
+// so that Anthropic clients can be served by channels of any type.
+
+func parseRequestContent(raw json.RawMessage) ([]RequestContent, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []RequestContent{{Type: "text", Text: text}}, nil
+	}
+	var blocks []RequestContent
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func requestContentText(raw json.RawMessage) (string, error) {
+	blocks, err := parseRequestContent(raw)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func (s *RequestSource) toURL() string {
+	if s == nil {
+		return ""
+	}
+	switch s.Type {
+	case "base64":
+		return fmt.Sprintf("data:%s;base64,%s", s.MediaType, s.Data)
+	case "url":
+		return s.Url
+	}
+	return ""
+}
+
+func ensureObjectSchema(schema any) any {
+	if schema == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	if params, ok := schema.(map[string]any); ok {
+		if _, ok := params["type"].(string); !ok {
+			params["type"] = "object"
+		}
+	}
+	return schema
+}
+
+// RequestClaude2OpenAI converts an inbound Messages API request to an OpenAI chat completion request.
+func RequestClaude2OpenAI(request *MessagesRequest) (*model.GeneralOpenAIRequest, error) {
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		TopK:        request.TopK,
+		Stream:      request.Stream,
+	}
+	if len(request.StopSequences) > 0 {
+		openaiRequest.Stop = request.StopSequences
+	}
+	if request.Stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if request.Metadata != nil {
+		openaiRequest.User = request.Metadata.UserId
+	}
+
+	system, err := requestContentText(request.System)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system: %w", err)
+	}
+	if system != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    role.System,
+			Content: system,
+		})
+	}
+
+	for _, message := range request.Messages {
+		blocks, err := parseRequestContent(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		if message.Role == role.Assistant {
+			openaiRequest.Messages = append(openaiRequest.Messages, assistantMessageClaude2OpenAI(blocks))
+			continue
+		}
+		var parts []any
+		textOnly := true
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				parts = append(parts, map[string]any{
+					"type": model.ContentTypeText,
+					"text": block.Text,
+				})
+			case "image":
+				url := block.Source.toURL()
+				if url == "" {
+					continue
+				}
+				textOnly = false
+				parts = append(parts, map[string]any{
+					"type":      model.ContentTypeImageURL,
+					"image_url": map[string]any{"url": url},
+				})
+			case "tool_result":
+				// tool results must directly follow the assistant message that issued the tool calls
+				content, err := requestContentText(block.Content)
+				if err != nil {
+					return nil, fmt.Errorf("invalid tool_result content: %w", err)
+				}
+				openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+					Role:       "tool",
+					Content:    content,
+					ToolCallId: block.ToolUseId,
+				})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		userMessage := model.Message{
+			Role:    message.Role,
+			Content: parts,
+		}
+		if textOnly {
+			// plain string content is understood by every adaptor
+			var texts []string
+			for _, part := range parts {
+				texts = append(texts, part.(map[string]any)["text"].(string))
+			}
+			userMessage.Content = strings.Join(texts, "\n")
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, userMessage)
+	}
+
+	for _, tool := range request.Tools {
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  ensureObjectSchema(tool.InputSchema),
+			},
+		})
+	}
+	if request.ToolChoice != nil && len(openaiRequest.Tools) > 0 {
+		switch request.ToolChoice.Type {
+		case "any":
+			openaiRequest.ToolChoice = "required"
+		case "none":
+			openaiRequest.ToolChoice = "none"
+		case "tool":
+			openaiRequest.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": request.ToolChoice.Name},
+			}
+		default:
+			openaiRequest.ToolChoice = "auto"
+		}
+	}
+	return &openaiRequest, nil
+}
+
+func assistantMessageClaude2OpenAI(blocks []RequestContent) model.Message {
+	var text strings.Builder
+	var toolCalls []model.Tool
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			input := block.Input
+			if input == nil {
+				input = map[string]any{}
+			}
+			args, _ := json.Marshal(input)
+			toolCalls = append(toolCalls, model.Tool{
+				Id:   block.Id,
+				Type: "function",
+				Function: model.Function{
+					Name:      block.Name,
+					Arguments: string(args),
+				},
+			})
+		}
+	}
+	return model.Message{
+		Role:      role.Assistant,
+		Content:   text.String(),
+		ToolCalls: toolCalls,
+	}
+}
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+func messageId(openaiId string) string {
+	id := strings.TrimPrefix(openaiId, "chatcmpl-")
+	if id == "" {
+		id = random.GetUUID()
+	}
+	return "msg_" + id
+}
+
+func toolInput(arguments any) map[string]any {
+	input := make(map[string]any)
+	_ = json.Unmarshal([]byte(conv.AsString(arguments)), &input)
+	return input
+}
+
+// ResponseOpenAI2Claude converts an OpenAI chat completion to a Messages API response.
+func ResponseOpenAI2Claude(response *openai.TextResponse, modelName string) *MessagesResponse {
+	claudeResponse := MessagesResponse{
+		Id:      messageId(response.Id),
+		Type:    "message",
+		Role:    role.Assistant,
+		Model:   modelName,
+		Content: make([]ContentBlock, 0),
+		Usage: Usage{
+			InputTokens:  response.PromptTokens,
+			OutputTokens: response.CompletionTokens,
+		},
+	}
+	stopReason := "end_turn"
+	if len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		if reasoning := conv.AsString(choice.ReasoningContent); reasoning != "" {
+			signature := ""
+			claudeResponse.Content = append(claudeResponse.Content, ContentBlock{
+				Type:      "thinking",
+				Thinking:  &reasoning,
+				Signature: &signature,
+			})
+		}
+		if text := choice.StringContent(); text != "" {
+			claudeResponse.Content = append(claudeResponse.Content, ContentBlock{
+				Type: "text",
+				Text: &text,
+			})
+		}
+		for _, toolCall := range choice.ToolCalls {
+			claudeResponse.Content = append(claudeResponse.Content, ContentBlock{
+				Type:  "tool_use",
+				Id:    toolCall.Id,
+				Name:  toolCall.Function.Name,
+				Input: toolInput(toolCall.Function.Arguments),
+			})
+		}
+		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
+	}
+	claudeResponse.StopReason = &stopReason
+	return &claudeResponse
+}
+
+// ResponseConverter renders OpenAI chat completion output as Messages API responses and stream events.
+type ResponseConverter struct {
+	modelName  string
+	started    bool
+	blockIndex int
+	blockType  string
+	stopReason string
+	usage      *model.Usage
+}
+
+func NewResponseConverter(modelName string) *ResponseConverter {
+	return &ResponseConverter{
+		modelName:  modelName,
+		blockIndex: -1,
+	}
+}
+
+func (r *ResponseConverter) ContentType(stream bool) string {
+	if stream {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func writeEvent(w io.Writer, event *StreamEvent) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, jsonData)
+	return err
+}
+
+func (r *ResponseConverter) start(w io.Writer, id string) error {
+	if r.started {
+		return nil
+	}
+	r.started = true
+	return writeEvent(w, &StreamEvent{
+		Type: "message_start",
+		Message: &MessagesResponse{
+			Id:      messageId(id),
+			Type:    "message",
+			Role:    role.Assistant,
+			Model:   r.modelName,
+			Content: make([]ContentBlock, 0),
+		},
+	})
+}
+
+func (r *ResponseConverter) stopBlock(w io.Writer) error {
+	if r.blockType == "" {
+		return nil
+	}
+	r.blockType = ""
+	index := r.blockIndex
+	return writeEvent(w, &StreamEvent{
+		Type:  "content_block_stop",
+		Index: &index,
+	})
+}
+
+func (r *ResponseConverter) startBlock(w io.Writer, block ContentBlock) error {
+	if err := r.stopBlock(w); err != nil {
+		return err
+	}
+	r.blockIndex++
+	r.blockType = block.Type
+	index := r.blockIndex
+	return writeEvent(w, &StreamEvent{
+		Type:         "content_block_start",
+		Index:        &index,
+		ContentBlock: &block,
+	})
+}
+
+func (r *ResponseConverter) delta(w io.Writer, blockType string, delta StreamEventDelta) error {
+	if r.blockType != blockType {
+		empty := ""
+		block := ContentBlock{Type: blockType}
+		switch blockType {
+		case "text":
+			block.Text = &empty
+		case "thinking":
+			block.Thinking = &empty
+		}
+		if err := r.startBlock(w, block); err != nil {
+			return err
+		}
+	}
+	index := r.blockIndex
+	return writeEvent(w, &StreamEvent{
+		Type:  "content_block_delta",
+		Index: &index,
+		Delta: &delta,
+	})
+}
+
+func (r *ResponseConverter) ConvertStreamChunk(w io.Writer, chunk *openai.ChatCompletionsStreamResponse) error {
+	if err := r.start(w, chunk.Id); err != nil {
+		return err
+	}
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	if reasoning := conv.AsString(choice.Delta.ReasoningContent); reasoning != "" {
+		if err := r.delta(w, "thinking", StreamEventDelta{Type: "thinking_delta", Thinking: reasoning}); err != nil {
+			return err
+		}
+	}
+	if text := conv.AsString(choice.Delta.Content); text != "" {
+		if err := r.delta(w, "text", StreamEventDelta{Type: "text_delta", Text: text}); err != nil {
+			return err
+		}
+	}
+	for _, toolCall := range choice.Delta.ToolCalls {
+		if toolCall.Id != "" || toolCall.Function.Name != "" {
+			err := r.startBlock(w, ContentBlock{
+				Type:  "tool_use",
+				Id:    toolCall.Id,
+				Name:  toolCall.Function.Name,
+				Input: map[string]any{},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if arguments := conv.AsString(toolCall.Function.Arguments); arguments != "" {
+			if err := r.delta(w, "tool_use", StreamEventDelta{Type: "input_json_delta", PartialJson: arguments}); err != nil {
+				return err
+			}
+		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		r.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		return r.stopBlock(w)
+	}
+	return nil
+}
+
+// ConvertStreamEnd closes the message; usage is the usage billed by one-api and takes precedence.
+func (r *ResponseConverter) ConvertStreamEnd(w io.Writer, usage *model.Usage) error {
+	if err := r.start(w, ""); err != nil {
+		return err
+	}
+	if err := r.stopBlock(w); err != nil {
+		return err
+	}
+	if usage == nil {
+		usage = r.usage
+	}
+	if r.stopReason == "" {
+		r.stopReason = "end_turn"
+	}
+	claudeUsage := Usage{}
+	if usage != nil {
+		claudeUsage.InputTokens = usage.PromptTokens
+		claudeUsage.OutputTokens = usage.CompletionTokens
+	}
+	err := writeEvent(w, &StreamEvent{
+		Type:  "message_delta",
+		Delta: &StreamEventDelta{StopReason: &r.stopReason},
+		Usage: &claudeUsage,
+	})
+	if err != nil {
+		return err
+	}
+	return writeEvent(w, &StreamEvent{Type: "message_stop"})
+}
+
+func (r *ResponseConverter) ConvertResponse(w io.Writer, response *openai.TextResponse) error {
+	jsonData, err := json.Marshal(ResponseOpenAI2Claude(response, r.modelName))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonData)
+	return err
+}
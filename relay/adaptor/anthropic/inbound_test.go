@@ -0,0 +1,79 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestClaude2OpenAI(t *testing.T) {
+	body := `{
+		"model": "claude-3-5-sonnet",
+		"max_tokens": 1024,
+		"system": [{"type": "text", "text": "be brief"}],
+		"tools": [{"name": "get_weather", "input_schema": {"properties": {"city": {"type": "string"}}}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": "weather in Paris?"},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "sunny"}]},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}
+			]}
+		]
+	}`
+	var request MessagesRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+	openaiRequest, err := RequestClaude2OpenAI(&request)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "required", openaiRequest.ToolChoice)
+	assert.Equal(t, "object", openaiRequest.Tools[0].Function.Parameters.(map[string]any)["type"])
+	assert.Len(t, openaiRequest.Messages, 5)
+	assert.Equal(t, "system", openaiRequest.Messages[0].Role)
+	assert.Equal(t, "be brief", openaiRequest.Messages[0].Content)
+	assert.Equal(t, "weather in Paris?", openaiRequest.Messages[1].Content)
+	assert.Equal(t, `{"city":"Paris"}`, openaiRequest.Messages[2].ToolCalls[0].Function.Arguments)
+	assert.Equal(t, "tool", openaiRequest.Messages[3].Role)
+	assert.Equal(t, "toolu_1", openaiRequest.Messages[3].ToolCallId)
+	assert.Equal(t, "sunny", openaiRequest.Messages[3].Content)
+	parts := openaiRequest.Messages[4].ParseContent()
+	assert.Equal(t, model.ContentTypeImageURL, parts[0].Type)
+	assert.Equal(t, "data:image/png;base64,AAAA", parts[0].ImageURL.Url)
+}
+
+func TestResponseConverterStream(t *testing.T) {
+	converter := NewResponseConverter("claude-3-5-sonnet")
+	var buf bytes.Buffer
+	stop := "tool_calls"
+	chunks := []openai.ChatCompletionsStreamResponse{
+		{Id: "chatcmpl-1", Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{Content: "Hi"}}}},
+		{Id: "chatcmpl-1", Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{ToolCalls: []model.Tool{{Id: "call_1", Function: model.Function{Name: "f"}}}}}}},
+		{Id: "chatcmpl-1", Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{ToolCalls: []model.Tool{{Function: model.Function{Arguments: `{"a":1}`}}}}}}},
+		{Id: "chatcmpl-1", Choices: []openai.ChatCompletionsStreamResponseChoice{{FinishReason: &stop}}},
+	}
+	for i := range chunks {
+		assert.NoError(t, converter.ConvertStreamChunk(&buf, &chunks[i]))
+	}
+	assert.NoError(t, converter.ConvertStreamEnd(&buf, &model.Usage{PromptTokens: 3, CompletionTokens: 5}))
+
+	var events []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}, events)
+	assert.Contains(t, buf.String(), `"stop_reason":"tool_use"`)
+	assert.Contains(t, buf.String(), `"output_tokens":5`)
+}
@@ -2,6 +2,7 @@ package anthropic
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/songquanpeng/one-api/common/render"
@@ -136,6 +137,13 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 				mimeType, data, _ := image.GetImageFromUrl(part.ImageURL.Url)
 				content.Source.MediaType = mimeType
 				content.Source.Data = data
+			} else if part.Type == model.ContentTypeFile {
+				source := fileSource(part.File)
+				if source == nil {
+					continue
+				}
+				content.Type = "document"
+				content.Source = source
 			}
 			contents = append(contents, content)
 		}
@@ -145,6 +153,35 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 	return &claudeRequest
 }
 
+// fileSource converts an inline file to the source of a document block,
+// claude only reads PDF and plain text documents.
+// https://docs.anthropic.com/en/docs/build-with-claude/pdf-support
+func fileSource(file *model.File) *ImageSource {
+	mimeType, data, ok := file.InlineData()
+	if !ok {
+		return nil
+	}
+	if mimeType == "application/pdf" {
+		return &ImageSource{
+			Type:      "base64",
+			MediaType: mimeType,
+			Data:      data,
+		}
+	}
+	if strings.HasPrefix(mimeType, "text/") {
+		text, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil
+		}
+		return &ImageSource{
+			Type:      "text",
+			MediaType: "text/plain",
+			Data:      string(text),
+		}
+	}
+	return nil
+}
+
 // https://docs.anthropic.com/claude/reference/messages-streaming
 func StreamResponseClaude2OpenAI(claudeResponse *StreamResponse) (*openai.ChatCompletionsStreamResponse, *Response) {
 	var response *Response
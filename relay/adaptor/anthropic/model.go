@@ -1,5 +1,7 @@
 package anthropic
 
+import "encoding/json"
+
 // https://docs.anthropic.com/claude/reference/messages_post
 
 type Metadata struct {
@@ -94,3 +96,112 @@ type StreamResponse struct {
 	Delta        *Delta    `json:"delta"`
 	Usage        *Usage    `json:"usage"`
 }
+
+// The types below describe the inbound /v1/messages API, where one-api acts as
+// an Anthropic-compatible server in front of any channel.
+
+// MessagesRequest is the request body of an inbound Messages API call.
+// System and message content may be either a string or a list of content blocks.
+type MessagesRequest struct {
+	Model         string            `json:"model"`
+	Messages      []MessagesMessage `json:"messages"`
+	System        json.RawMessage   `json:"system,omitempty"`
+	MaxTokens     int               `json:"max_tokens,omitempty"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+	Stream        bool              `json:"stream,omitempty"`
+	Temperature   *float64          `json:"temperature,omitempty"`
+	TopP          *float64          `json:"top_p,omitempty"`
+	TopK          int               `json:"top_k,omitempty"`
+	Tools         []MessagesTool    `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice       `json:"tool_choice,omitempty"`
+	Thinking      *Thinking         `json:"thinking,omitempty"`
+	Metadata      *Metadata         `json:"metadata,omitempty"`
+}
+
+type MessagesMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// RequestContent is a content block of an inbound request message.
+type RequestContent struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *RequestSource  `json:"source,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     any             `json:"input,omitempty"`
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+type RequestSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type MessagesTool struct {
+	Type        string `json:"type,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema,omitempty"`
+}
+
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// ContentBlock is a content block rendered back to Messages API clients.
+// Text fields are pointers so that empty strings are still serialized.
+type ContentBlock struct {
+	Type      string  `json:"type"`
+	Text      *string `json:"text,omitempty"`
+	Thinking  *string `json:"thinking,omitempty"`
+	Signature *string `json:"signature,omitempty"`
+	Id        string  `json:"id,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Input     any     `json:"input,omitempty"`
+}
+
+type MessagesResponse struct {
+	Id           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   *string        `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+type StreamEventDelta struct {
+	Type         string  `json:"type,omitempty"`
+	Text         string  `json:"text,omitempty"`
+	Thinking     string  `json:"thinking,omitempty"`
+	PartialJson  string  `json:"partial_json,omitempty"`
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+type StreamEvent struct {
+	Type         string            `json:"type"`
+	Message      *MessagesResponse `json:"message,omitempty"`
+	Index        *int              `json:"index,omitempty"`
+	ContentBlock *ContentBlock     `json:"content_block,omitempty"`
+	Delta        *StreamEventDelta `json:"delta,omitempty"`
+	Usage        *Usage            `json:"usage,omitempty"`
+}
+
+type ErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
@@ -33,6 +33,20 @@ func stopReasonCohere2OpenAI(reason *string) string {
 	}
 }
 
+func ConvertRerankRequest(request model.RerankRequest) *RerankRequest {
+	cohereRequest := RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.Documents,
+		TopN:            request.TopN,
+		MaxChunksPerDoc: request.MaxChunksPerDoc,
+	}
+	if request.ReturnDocuments != nil {
+		cohereRequest.ReturnDocuments = *request.ReturnDocuments
+	}
+	return &cohereRequest
+}
+
 func ConvertRequest(textRequest model.GeneralOpenAIRequest) *Request {
 	cohereRequest := Request{
 		Model:            textRequest.Model,
@@ -226,3 +240,32 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &usage
 }
+
+func RerankHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResponse model.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	openai.SetRerankSearchUnits(c, &rerankResponse)
+	// cohere bills search units and doesn't count the document tokens
+	usage := openai.RerankUsage(&rerankResponse, promptTokens)
+	rerankResponse.Model = modelName
+	rerankResponse.Usage = usage
+	jsonResponse, err := json.Marshal(rerankResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, usage
+}
@@ -145,3 +145,13 @@ type Usage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
 }
+
+// https://docs.cohere.com/v1/reference/rerank
+type RerankRequest struct {
+	Model           string `json:"model"`
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	TopN            int    `json:"top_n,omitempty"`
+	ReturnDocuments bool   `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int    `json:"max_chunks_per_doc,omitempty"`
+}
@@ -5,9 +5,14 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/budget"
+	"github.com/songquanpeng/one-api/relay/concurrency"
+	"github.com/songquanpeng/one-api/relay/cooldown"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 )
 
 func SetupCommonRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) {
@@ -23,7 +28,7 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -31,13 +36,57 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	if err != nil {
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
+	release, err := AcquireChannelSlot(c, meta)
+	if err != nil {
+		return nil, fmt.Errorf("acquire channel slot failed: %w", err)
+	}
+	if meta.Config.HasDailyBudget() {
+		budget.AddRequest(meta.ChannelId, meta.Config.BudgetPeriod(time.Now()))
+	}
 	resp, err := DoRequest(c, req)
 	if err != nil {
+		release()
 		return nil, fmt.Errorf("do request failed: %w", err)
 	}
+	cooldown.RecordResponse(meta.ChannelId, resp)
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
 	return resp, nil
 }
 
+// AcquireChannelSlot enforces the max concurrency of the channel. The slot is held until the response body
+// is closed, or at the latest until the request is over.
+func AcquireChannelSlot(c *gin.Context, meta *meta.Meta) (func(), error) {
+	if meta.Config.MaxConcurrency <= 0 {
+		return func() {}, nil
+	}
+	ctx := c.Request.Context()
+	release, err := concurrency.Acquire(ctx, meta.ChannelId, meta.Config.MaxConcurrency, meta.Config.QueueSize,
+		time.Duration(meta.Config.QueueTimeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	releaseOnce := func() {
+		once.Do(release)
+	}
+	go func() {
+		<-ctx.Done()
+		releaseOnce()
+	}()
+	return releaseOnce, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
 func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	resp, err := client.HTTPClient.Do(req)
 	if err != nil {
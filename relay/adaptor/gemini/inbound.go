@@ -0,0 +1,415 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://ai.google.dev/api/generate-content
+// This file converts the inbound generateContent API to OpenAI chat completions and back,
+// so that Google GenAI clients can be served by channels of any type.
+
+// lowerSchemaTypes rewrites Gemini schema types such as "OBJECT" to the JSON schema spelling.
+func lowerSchemaTypes(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if key == "type" {
+				if typ, ok := value.(string); ok {
+					v[key] = strings.ToLower(typ)
+					continue
+				}
+			}
+			v[key] = lowerSchemaTypes(value)
+		}
+	case []any:
+		for i := range v {
+			v[i] = lowerSchemaTypes(v[i])
+		}
+	}
+	return schema
+}
+
+func functionDeclarations(tools []ChatTools) ([]FunctionDeclaration, error) {
+	var declarations []FunctionDeclaration
+	for _, tool := range tools {
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		jsonData, err := json.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		var items []FunctionDeclaration
+		if err = json.Unmarshal(jsonData, &items); err != nil {
+			return nil, err
+		}
+		declarations = append(declarations, items...)
+	}
+	return declarations, nil
+}
+
+// RequestGemini2OpenAI converts an inbound generateContent request to an OpenAI chat completion request.
+func RequestGemini2OpenAI(request *ChatRequest, modelName string, stream bool) (*model.GeneralOpenAIRequest, error) {
+	config := request.GenerationConfig
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      stream,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+		MaxTokens:   config.MaxOutputTokens,
+		N:           config.CandidateCount,
+	}
+	if len(config.StopSequences) > 0 {
+		openaiRequest.Stop = config.StopSequences
+	}
+	if stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if config.ResponseSchema != nil {
+		schema, _ := lowerSchemaTypes(config.ResponseSchema).(map[string]any)
+		openaiRequest.ResponseFormat = &model.ResponseFormat{
+			Type: "json_schema",
+			JsonSchema: &model.JSONSchema{
+				Name:   "response",
+				Schema: schema,
+			},
+		}
+	} else if config.ResponseMimeType == "application/json" {
+		openaiRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+	}
+
+	if request.SystemInstruction != nil {
+		var texts []string
+		for _, part := range request.SystemInstruction.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+				Role:    role.System,
+				Content: strings.Join(texts, "\n"),
+			})
+		}
+	}
+
+	// gemini matches function responses to calls by name, openai by id
+	pendingCallIds := make(map[string][]string)
+	callCount := 0
+	for _, content := range request.Contents {
+		if content.Role == "model" {
+			message := model.Message{Role: role.Assistant}
+			var text strings.Builder
+			for _, part := range content.Parts {
+				if part.FunctionCall != nil {
+					callCount++
+					id := fmt.Sprintf("call_%d", callCount)
+					pendingCallIds[part.FunctionCall.FunctionName] = append(pendingCallIds[part.FunctionCall.FunctionName], id)
+					args, _ := json.Marshal(part.FunctionCall.Arguments)
+					message.ToolCalls = append(message.ToolCalls, model.Tool{
+						Id:   id,
+						Type: "function",
+						Function: model.Function{
+							Name:      part.FunctionCall.FunctionName,
+							Arguments: string(args),
+						},
+					})
+					continue
+				}
+				text.WriteString(part.Text)
+			}
+			message.Content = text.String()
+			openaiRequest.Messages = append(openaiRequest.Messages, message)
+			continue
+		}
+		var parts []any
+		textOnly := true
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := ""
+				if ids := pendingCallIds[name]; len(ids) > 0 {
+					id = ids[0]
+					pendingCallIds[name] = ids[1:]
+				}
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+					Role:       "tool",
+					Content:    string(response),
+					ToolCallId: id,
+				})
+			case part.InlineData != nil:
+				textOnly = false
+				parts = append(parts, map[string]any{
+					"type": model.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					},
+				})
+			case part.Text != "":
+				parts = append(parts, map[string]any{
+					"type": model.ContentTypeText,
+					"text": part.Text,
+				})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		message := model.Message{
+			Role:    "user",
+			Content: parts,
+		}
+		if textOnly {
+			var texts []string
+			for _, part := range parts {
+				texts = append(texts, part.(map[string]any)["text"].(string))
+			}
+			message.Content = strings.Join(texts, "\n")
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, message)
+	}
+
+	declarations, err := functionDeclarations(request.Tools)
+	if err != nil {
+		return nil, fmt.Errorf("invalid function declarations: %w", err)
+	}
+	for _, declaration := range declarations {
+		parameters := declaration.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        declaration.Name,
+				Description: declaration.Description,
+				Parameters:  lowerSchemaTypes(parameters),
+			},
+		})
+	}
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil && len(openaiRequest.Tools) > 0 {
+		callingConfig := request.ToolConfig.FunctionCallingConfig
+		switch callingConfig.Mode {
+		case "ANY":
+			openaiRequest.ToolChoice = "required"
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				openaiRequest.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": callingConfig.AllowedFunctionNames[0]},
+				}
+			}
+		case "NONE":
+			openaiRequest.ToolChoice = "none"
+		default:
+			openaiRequest.ToolChoice = "auto"
+		}
+	}
+	return &openaiRequest, nil
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func usageOpenAI2Gemini(usage *model.Usage) *UsageMetadata {
+	if usage == nil {
+		return nil
+	}
+	return &UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+func functionCallPart(toolCall model.Tool) Part {
+	args := make(map[string]any)
+	_ = json.Unmarshal([]byte(conv.AsString(toolCall.Function.Arguments)), &args)
+	return Part{
+		FunctionCall: &FunctionCall{
+			FunctionName: toolCall.Function.Name,
+			Arguments:    args,
+		},
+	}
+}
+
+// ResponseOpenAI2Gemini converts an OpenAI chat completion to a generateContent response.
+func ResponseOpenAI2Gemini(response *openai.TextResponse, modelName string) *ChatResponse {
+	geminiResponse := ChatResponse{
+		Candidates:    make([]ChatCandidate, 0, len(response.Choices)),
+		UsageMetadata: usageOpenAI2Gemini(&response.Usage),
+		ModelVersion:  modelName,
+	}
+	for _, choice := range response.Choices {
+		parts := make([]Part, 0)
+		if text := choice.StringContent(); text != "" {
+			parts = append(parts, Part{Text: text})
+		}
+		for _, toolCall := range choice.ToolCalls {
+			parts = append(parts, functionCallPart(toolCall))
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, ChatCandidate{
+			Content: ChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        int64(choice.Index),
+		})
+	}
+	return &geminiResponse
+}
+
+// ResponseConverter renders OpenAI chat completion output as generateContent responses.
+// Streams are written as server-sent events when sse is set, as a JSON array otherwise.
+type ResponseConverter struct {
+	modelName    string
+	sse          bool
+	chunks       int
+	toolCalls    []model.Tool
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewResponseConverter(modelName string, sse bool) *ResponseConverter {
+	return &ResponseConverter{
+		modelName: modelName,
+		sse:       sse,
+	}
+}
+
+func (r *ResponseConverter) ContentType(stream bool) string {
+	if stream && r.sse {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (r *ResponseConverter) writeChunk(w io.Writer, response *ChatResponse) error {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	r.chunks++
+	if r.sse {
+		_, err = fmt.Fprintf(w, "data: %s\r\n\r\n", jsonData)
+		return err
+	}
+	separator := ","
+	if r.chunks == 1 {
+		separator = "["
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", separator, jsonData)
+	return err
+}
+
+func (r *ResponseConverter) ConvertStreamChunk(w io.Writer, chunk *openai.ChatCompletionsStreamResponse) error {
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	for _, toolCall := range choice.Delta.ToolCalls {
+		// gemini sends complete function calls, so arguments are collected until the stream ends
+		if toolCall.Id != "" || toolCall.Function.Name != "" || len(r.toolCalls) == 0 {
+			toolCall.Function.Arguments = conv.AsString(toolCall.Function.Arguments)
+			r.toolCalls = append(r.toolCalls, toolCall)
+			continue
+		}
+		last := &r.toolCalls[len(r.toolCalls)-1].Function
+		last.Arguments = conv.AsString(last.Arguments) + conv.AsString(toolCall.Function.Arguments)
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		r.finishReason = *choice.FinishReason
+	}
+	text := conv.AsString(choice.Delta.Content)
+	if text == "" {
+		return nil
+	}
+	return r.writeChunk(w, &ChatResponse{
+		Candidates: []ChatCandidate{{
+			Content: ChatContent{
+				Role:  "model",
+				Parts: []Part{{Text: text}},
+			},
+		}},
+		ModelVersion: r.modelName,
+	})
+}
+
+// ConvertStreamEnd writes the last chunk carrying the function calls, finish reason and usage.
+func (r *ResponseConverter) ConvertStreamEnd(w io.Writer, usage *model.Usage) error {
+	if usage == nil {
+		usage = r.usage
+	}
+	parts := make([]Part, 0, len(r.toolCalls))
+	for _, toolCall := range r.toolCalls {
+		parts = append(parts, functionCallPart(toolCall))
+	}
+	err := r.writeChunk(w, &ChatResponse{
+		Candidates: []ChatCandidate{{
+			Content: ChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason: finishReasonOpenAI2Gemini(r.finishReason),
+		}},
+		UsageMetadata: usageOpenAI2Gemini(usage),
+		ModelVersion:  r.modelName,
+	})
+	if err != nil || r.sse {
+		return err
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+func (r *ResponseConverter) ConvertResponse(w io.Writer, response *openai.TextResponse) error {
+	jsonData, err := json.Marshal(ResponseOpenAI2Gemini(response, r.modelName))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonData)
+	return err
+}
+
+// ErrorStatus maps an HTTP status code to the canonical status name used in Google API errors.
+func ErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,70 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestGemini2OpenAI(t *testing.T) {
+	body := `{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"contents": [
+			{"role": "user", "parts": [{"text": "weather in Paris?"}]},
+			{"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"result": "sunny"}}}]},
+			{"role": "user", "parts": [{"text": "and this?"}, {"inlineData": {"mimeType": "image/png", "data": "AAAA"}}]}
+		],
+		"tools": [{"functionDeclarations": [{"name": "get_weather", "parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING"}}}}]}],
+		"toolConfig": {"functionCallingConfig": {"mode": "ANY"}},
+		"generationConfig": {"temperature": 0.5, "maxOutputTokens": 100}
+	}`
+	var request ChatRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+	openaiRequest, err := RequestGemini2OpenAI(&request, "gemini-pro", false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "gemini-pro", openaiRequest.Model)
+	assert.Equal(t, 100, openaiRequest.MaxTokens)
+	assert.Equal(t, "required", openaiRequest.ToolChoice)
+	parameters := openaiRequest.Tools[0].Function.Parameters.(map[string]any)
+	assert.Equal(t, "object", parameters["type"])
+	assert.Len(t, openaiRequest.Messages, 5)
+	assert.Equal(t, "be brief", openaiRequest.Messages[0].Content)
+	assert.Equal(t, "weather in Paris?", openaiRequest.Messages[1].Content)
+	toolCall := openaiRequest.Messages[2].ToolCalls[0]
+	assert.Equal(t, `{"city":"Paris"}`, toolCall.Function.Arguments)
+	assert.Equal(t, "tool", openaiRequest.Messages[3].Role)
+	assert.Equal(t, toolCall.Id, openaiRequest.Messages[3].ToolCallId)
+	parts := openaiRequest.Messages[4].ParseContent()
+	assert.Equal(t, "data:image/png;base64,AAAA", parts[1].ImageURL.Url)
+}
+
+func TestResponseConverterStream(t *testing.T) {
+	converter := NewResponseConverter("gemini-pro", false)
+	var buf bytes.Buffer
+	stop := "tool_calls"
+	chunks := []openai.ChatCompletionsStreamResponse{
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{Content: "Hi"}}}},
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{ToolCalls: []model.Tool{{Id: "call_1", Function: model.Function{Name: "f"}}}}}}},
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{ToolCalls: []model.Tool{{Function: model.Function{Arguments: `{"a":1}`}}}}}}},
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{FinishReason: &stop}}},
+	}
+	for i := range chunks {
+		assert.NoError(t, converter.ConvertStreamChunk(&buf, &chunks[i]))
+	}
+	assert.NoError(t, converter.ConvertStreamEnd(&buf, &model.Usage{PromptTokens: 3, CompletionTokens: 5}))
+
+	var responses []ChatResponse
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &responses))
+	assert.Len(t, responses, 2)
+	assert.Equal(t, "Hi", responses[0].Candidates[0].Content.Parts[0].Text)
+	last := responses[1]
+	assert.Equal(t, "f", last.Candidates[0].Content.Parts[0].FunctionCall.FunctionName)
+	assert.Equal(t, "STOP", last.Candidates[0].FinishReason)
+	assert.Equal(t, 8, last.UsageMetadata.TotalTokenCount)
+}
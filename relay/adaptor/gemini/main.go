@@ -122,6 +122,17 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
 						Data:     data,
 					},
 				})
+			} else if part.Type == model.ContentTypeFile {
+				mimeType, data, ok := part.File.InlineData()
+				if !ok {
+					continue
+				}
+				parts = append(parts, Part{
+					InlineData: &InlineData{
+						MimeType: mimeType,
+						Data:     data,
+					},
+				})
 			}
 		}
 		content.Parts = parts
@@ -187,6 +198,8 @@ func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbedding
 type ChatResponse struct {
 	Candidates     []ChatCandidate    `json:"candidates"`
 	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
+	UsageMetadata  *UsageMetadata     `json:"usageMetadata,omitempty"`
+	ModelVersion   string             `json:"modelVersion,omitempty"`
 }
 
 func (g *ChatResponse) GetResponseText() string {
@@ -1,13 +1,46 @@
 package gemini
 
+import "encoding/json"
+
 type ChatRequest struct {
 	Contents          []ChatContent        `json:"contents"`
 	SafetySettings    []ChatSafetySettings `json:"safety_settings,omitempty"`
 	GenerationConfig  ChatGenerationConfig `json:"generation_config,omitempty"`
 	Tools             []ChatTools          `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig          `json:"tool_config,omitempty"`
 	SystemInstruction *ChatContent         `json:"system_instruction,omitempty"`
 }
 
+// UnmarshalJSON accepts the camelCase field names sent by the Google GenAI SDKs
+// as well as the snake_case names used by this package.
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	type chatRequest ChatRequest
+	var request struct {
+		chatRequest
+		SafetySettings    []ChatSafetySettings  `json:"safetySettings"`
+		GenerationConfig  *ChatGenerationConfig `json:"generationConfig"`
+		ToolConfig        *ToolConfig           `json:"toolConfig"`
+		SystemInstruction *ChatContent          `json:"systemInstruction"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	*r = ChatRequest(request.chatRequest)
+	if request.SafetySettings != nil {
+		r.SafetySettings = request.SafetySettings
+	}
+	if request.GenerationConfig != nil {
+		r.GenerationConfig = *request.GenerationConfig
+	}
+	if request.ToolConfig != nil {
+		r.ToolConfig = request.ToolConfig
+	}
+	if request.SystemInstruction != nil {
+		r.SystemInstruction = request.SystemInstruction
+	}
+	return nil
+}
+
 type EmbeddingRequest struct {
 	Model                string      `json:"model"`
 	Content              ChatContent `json:"content"`
@@ -45,10 +78,16 @@ type FunctionCall struct {
 	Arguments    any    `json:"args"`
 }
 
+type FunctionResponse struct {
+	Name     string `json:"name"`
+	Response any    `json:"response"`
+}
+
 type Part struct {
-	Text         string        `json:"text,omitempty"`
-	InlineData   *InlineData   `json:"inlineData,omitempty"`
-	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	Text             string            `json:"text,omitempty"`
+	InlineData       *InlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
 }
 
 type ChatContent struct {
@@ -65,6 +104,42 @@ type ChatTools struct {
 	FunctionDeclarations any `json:"function_declarations,omitempty"`
 }
 
+func (t *ChatTools) UnmarshalJSON(data []byte) error {
+	var tools struct {
+		FunctionDeclarations      any `json:"function_declarations"`
+		FunctionDeclarationsCamel any `json:"functionDeclarations"`
+	}
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return err
+	}
+	t.FunctionDeclarations = tools.FunctionDeclarations
+	if tools.FunctionDeclarationsCamel != nil {
+		t.FunctionDeclarations = tools.FunctionDeclarationsCamel
+	}
+	return nil
+}
+
+type FunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
 type ChatGenerationConfig struct {
 	ResponseMimeType string   `json:"responseMimeType,omitempty"`
 	ResponseSchema   any      `json:"responseSchema,omitempty"`
@@ -75,3 +150,7 @@ type ChatGenerationConfig struct {
 	CandidateCount   int      `json:"candidateCount,omitempty"`
 	StopSequences    []string `json:"stopSequences,omitempty"`
 }
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
@@ -19,3 +19,9 @@ type Adaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 }
+
+// RerankAdaptor is implemented by the adaptors that convert /v1/rerank requests,
+// the request is sent as is to the other channels supporting rerank
+type RerankAdaptor interface {
+	ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error)
+}
@@ -0,0 +1,12 @@
+package jina
+
+// https://jina.ai/reranker
+// https://jina.ai/embeddings
+
+var ModelList = []string{
+	"jina-reranker-v2-base-multilingual",
+	"jina-reranker-v1-base-en",
+	"jina-reranker-v1-turbo-en",
+	"jina-colbert-v2",
+	"jina-embeddings-v3",
+}
@@ -0,0 +1,238 @@
+package ollama
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://github.com/ollama/ollama/blob/main/docs/api.md
+// This file converts the inbound Ollama chat and generate APIs to OpenAI chat completions and back,
+// so that the tools built for a local Ollama can be served by channels of any type.
+
+// imageDataURL turns the raw base64 images of ollama into the data urls expected by openai.
+func imageDataURL(data string) string {
+	mimeType := "image/png"
+	if decoded, err := base64.StdEncoding.DecodeString(data); err == nil {
+		mimeType = http.DetectContentType(decoded)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, data)
+}
+
+func messageOllama2OpenAI(message Message) model.Message {
+	if len(message.Images) == 0 {
+		return model.Message{
+			Role:    message.Role,
+			Content: message.Content,
+		}
+	}
+	parts := []any{map[string]any{
+		"type": model.ContentTypeText,
+		"text": message.Content,
+	}}
+	for _, image := range message.Images {
+		parts = append(parts, map[string]any{
+			"type": model.ContentTypeImageURL,
+			"image_url": map[string]any{
+				"url": imageDataURL(image),
+			},
+		})
+	}
+	return model.Message{
+		Role:    message.Role,
+		Content: parts,
+	}
+}
+
+func responseFormatOllama2OpenAI(format any) *model.ResponseFormat {
+	switch v := format.(type) {
+	case string:
+		if v == "json" {
+			return &model.ResponseFormat{Type: "json_object"}
+		}
+	case map[string]any:
+		return &model.ResponseFormat{
+			Type: "json_schema",
+			JsonSchema: &model.JSONSchema{
+				Name:   "response",
+				Schema: v,
+			},
+		}
+	}
+	return nil
+}
+
+func newOpenAIRequest(modelName string, options *Options, format any, stream bool) *model.GeneralOpenAIRequest {
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:          modelName,
+		Stream:         stream,
+		ResponseFormat: responseFormatOllama2OpenAI(format),
+	}
+	if stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if options != nil {
+		openaiRequest.Seed = float64(options.Seed)
+		openaiRequest.Temperature = options.Temperature
+		openaiRequest.TopP = options.TopP
+		openaiRequest.TopK = options.TopK
+		openaiRequest.FrequencyPenalty = options.FrequencyPenalty
+		openaiRequest.PresencePenalty = options.PresencePenalty
+		openaiRequest.NumCtx = options.NumCtx
+		if options.NumPredict > 0 {
+			openaiRequest.MaxTokens = options.NumPredict
+		}
+		if len(options.Stop) > 0 {
+			openaiRequest.Stop = options.Stop
+		}
+	}
+	return &openaiRequest
+}
+
+// RequestChat2OpenAI converts an inbound /api/chat request to an OpenAI chat completion request,
+// stream is passed separately because ollama streams when the field is absent.
+func RequestChat2OpenAI(request *ChatRequest, stream bool) *model.GeneralOpenAIRequest {
+	openaiRequest := newOpenAIRequest(request.Model, request.Options, request.Format, stream)
+	for _, message := range request.Messages {
+		openaiRequest.Messages = append(openaiRequest.Messages, messageOllama2OpenAI(message))
+	}
+	return openaiRequest
+}
+
+// RequestGenerate2OpenAI converts an inbound /api/generate request to an OpenAI chat completion request.
+func RequestGenerate2OpenAI(request *GenerateRequest) *model.GeneralOpenAIRequest {
+	stream := request.Stream == nil || *request.Stream
+	openaiRequest := newOpenAIRequest(request.Model, request.Options, request.Format, stream)
+	if request.System != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    role.System,
+			Content: request.System,
+		})
+	}
+	openaiRequest.Messages = append(openaiRequest.Messages, messageOllama2OpenAI(Message{
+		Role:    "user",
+		Content: request.Prompt,
+		Images:  request.Images,
+	}))
+	return openaiRequest
+}
+
+func doneReasonOpenAI2Ollama(reason string) string {
+	if reason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// ResponseConverter renders OpenAI chat completion output as /api/chat or /api/generate responses,
+// streams are written as newline delimited JSON.
+type ResponseConverter struct {
+	modelName    string
+	generate     bool
+	createdAt    time.Time
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewResponseConverter(modelName string, generate bool) *ResponseConverter {
+	return &ResponseConverter{
+		modelName: modelName,
+		generate:  generate,
+		createdAt: time.Now(),
+	}
+}
+
+func (r *ResponseConverter) ContentType(stream bool) string {
+	if stream {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+func (r *ResponseConverter) newResponse(text string) *ChatResponse {
+	response := ChatResponse{
+		Model:     r.modelName,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if r.generate {
+		response.Response = text
+	} else {
+		response.Message = Message{
+			Role:    role.Assistant,
+			Content: text,
+		}
+	}
+	return &response
+}
+
+// finish fills the fields of the last response, ollama reports the durations in nanoseconds
+func (r *ResponseConverter) finish(response *ChatResponse, finishReason string, usage *model.Usage) {
+	response.Done = true
+	response.DoneReason = doneReasonOpenAI2Ollama(finishReason)
+	response.TotalDuration = int(time.Since(r.createdAt).Nanoseconds())
+	if usage != nil {
+		response.PromptEvalCount = usage.PromptTokens
+		response.EvalCount = usage.CompletionTokens
+	}
+}
+
+func writeLine(w io.Writer, response *ChatResponse) error {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", jsonData)
+	return err
+}
+
+func (r *ResponseConverter) ConvertStreamChunk(w io.Writer, chunk *openai.ChatCompletionsStreamResponse) error {
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		r.finishReason = *choice.FinishReason
+	}
+	text := conv.AsString(choice.Delta.Content)
+	if text == "" {
+		return nil
+	}
+	return writeLine(w, r.newResponse(text))
+}
+
+// ConvertStreamEnd writes the last line carrying the done reason and the token counts.
+func (r *ResponseConverter) ConvertStreamEnd(w io.Writer, usage *model.Usage) error {
+	if usage == nil {
+		usage = r.usage
+	}
+	response := r.newResponse("")
+	r.finish(response, r.finishReason, usage)
+	return writeLine(w, response)
+}
+
+func (r *ResponseConverter) ConvertResponse(w io.Writer, response *openai.TextResponse) error {
+	var text, finishReason string
+	if len(response.Choices) > 0 {
+		text = response.Choices[0].StringContent()
+		finishReason = response.Choices[0].FinishReason
+	}
+	ollamaResponse := r.newResponse(text)
+	r.finish(ollamaResponse, finishReason, &response.Usage)
+	jsonData, err := json.Marshal(ollamaResponse)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonData)
+	return err
+}
@@ -0,0 +1,63 @@
+package ollama
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestGenerate2OpenAI(t *testing.T) {
+	body := `{
+		"model": "llama3",
+		"prompt": "describe",
+		"system": "be brief",
+		"images": ["iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="],
+		"format": "json",
+		"options": {"temperature": 0.5, "num_predict": 64, "stop": ["\n"]}
+	}`
+	var request GenerateRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+	openaiRequest := RequestGenerate2OpenAI(&request)
+
+	assert.True(t, openaiRequest.Stream)
+	assert.Equal(t, 64, openaiRequest.MaxTokens)
+	assert.Equal(t, 0.5, *openaiRequest.Temperature)
+	assert.Equal(t, "json_object", openaiRequest.ResponseFormat.Type)
+	assert.Len(t, openaiRequest.Messages, 2)
+	assert.Equal(t, "be brief", openaiRequest.Messages[0].Content)
+	parts := openaiRequest.Messages[1].ParseContent()
+	assert.Equal(t, "describe", parts[0].Text)
+	assert.True(t, strings.HasPrefix(parts[1].ImageURL.Url, "data:image/png;base64,"))
+}
+
+func TestResponseConverterStream(t *testing.T) {
+	converter := NewResponseConverter("llama3", false)
+	var buf bytes.Buffer
+	stop := "stop"
+	chunks := []openai.ChatCompletionsStreamResponse{
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{Content: "Hel"}}}},
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{Content: "lo"}}}},
+		{Choices: []openai.ChatCompletionsStreamResponseChoice{{FinishReason: &stop}}},
+	}
+	for i := range chunks {
+		assert.NoError(t, converter.ConvertStreamChunk(&buf, &chunks[i]))
+	}
+	assert.NoError(t, converter.ConvertStreamEnd(&buf, &model.Usage{PromptTokens: 3, CompletionTokens: 5}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	var first, last ChatResponse
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &last))
+	assert.Equal(t, "Hel", first.Message.Content)
+	assert.False(t, first.Done)
+	assert.True(t, last.Done)
+	assert.Equal(t, "stop", last.DoneReason)
+	assert.Equal(t, 3, last.PromptEvalCount)
+	assert.Equal(t, 5, last.EvalCount)
+}
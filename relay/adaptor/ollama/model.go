@@ -9,6 +9,7 @@ type Options struct {
 	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
 	NumPredict       int      `json:"num_predict,omitempty"`
 	NumCtx           int      `json:"num_ctx,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
 }
 
 type Message struct {
@@ -22,6 +23,18 @@ type ChatRequest struct {
 	Messages []Message `json:"messages,omitempty"`
 	Stream   bool      `json:"stream"`
 	Options  *Options  `json:"options,omitempty"`
+	Format   any       `json:"format,omitempty"`
+}
+
+type GenerateRequest struct {
+	Model   string   `json:"model"`
+	Prompt  string   `json:"prompt"`
+	System  string   `json:"system,omitempty"`
+	Images  []string `json:"images,omitempty"`
+	Stream  *bool    `json:"stream,omitempty"`
+	Raw     bool     `json:"raw,omitempty"`
+	Options *Options `json:"options,omitempty"`
+	Format  any      `json:"format,omitempty"`
 }
 
 type ChatResponse struct {
@@ -30,6 +43,7 @@ type ChatResponse struct {
 	Message         Message `json:"message,omitempty"`
 	Response        string  `json:"response,omitempty"` // for stream response
 	Done            bool    `json:"done,omitempty"`
+	DoneReason      string  `json:"done_reason,omitempty"`
 	TotalDuration   int     `json:"total_duration,omitempty"`
 	LoadDuration    int     `json:"load_duration,omitempty"`
 	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
@@ -51,3 +65,24 @@ type EmbeddingResponse struct {
 	Model      string      `json:"model"`
 	Embeddings [][]float64 `json:"embeddings"`
 }
+
+type ModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+type ModelTag struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model"`
+	ModifiedAt string       `json:"modified_at"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	Details    ModelDetails `json:"details"`
+}
+
+type TagsResponse struct {
+	Models []ModelTag `json:"models"`
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/geminiv2"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
 	"github.com/songquanpeng/one-api/relay/adaptor/novita"
+	"github.com/songquanpeng/one-api/relay/adaptor/siliconflow"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -31,6 +32,9 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Mode == relaymode.Realtime {
+		return getRealtimeURL(meta), nil
+	}
 	switch meta.ChannelType {
 	case channeltype.Azure:
 		if meta.Mode == relaymode.ImagesGenerations {
@@ -39,6 +43,30 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, meta.ActualModelName, meta.Config.APIVersion)
 			return fullRequestURL, nil
 		}
+		if meta.Mode == relaymode.ImagesEdits || meta.Mode == relaymode.ImagesVariations {
+			// https://learn.microsoft.com/en-us/azure/ai-services/openai/dall-e-quickstart
+			// https://{resource_name}.openai.azure.com/openai/deployments/gpt-image-1/images/edits?api-version=2025-04-01-preview
+			task := strings.TrimPrefix(strings.Split(meta.RequestURLPath, "?")[0], "/v1/")
+			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s", meta.BaseURL, meta.ActualModelName, task, meta.Config.APIVersion)
+			return fullRequestURL, nil
+		}
+		if meta.Mode == relaymode.FineTuning {
+			// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/fine-tuning
+			// https://{resource_name}.openai.azure.com/openai/fine_tuning/jobs?api-version=2024-10-21
+			// the training files are uploaded to /openai/files of the same resource
+			path, query, _ := strings.Cut(strings.TrimPrefix(meta.RequestURLPath, "/v1"), "?")
+			fullRequestURL := fmt.Sprintf("%s/openai%s?api-version=%s", meta.BaseURL, path, meta.Config.APIVersion)
+			if query != "" {
+				fullRequestURL += "&" + query
+			}
+			return fullRequestURL, nil
+		}
+		if meta.Mode == relaymode.Responses {
+			// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/responses
+			// the deployment is taken from the model field of the request body
+			fullRequestURL := fmt.Sprintf("%s/openai/responses?api-version=%s", meta.BaseURL, meta.Config.APIVersion)
+			return fullRequestURL, nil
+		}
 
 		// https://learn.microsoft.com/en-us/azure/cognitive-services/openai/chatgpt-quickstart?pivots=rest-api&tabs=command-line#rest-api
 		requestURL := strings.Split(meta.RequestURLPath, "?")[0]
@@ -74,6 +102,9 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 		return nil
 	}
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	if meta.Mode == relaymode.Realtime && req.Header.Get("OpenAI-Beta") == "" {
+		req.Header.Set("OpenAI-Beta", "realtime=v1")
+	}
 	if meta.ChannelType == channeltype.OpenRouter {
 		req.Header.Set("HTTP-Referer", "https://github.com/songquanpeng/one-api")
 		req.Header.Set("X-Title", "One API")
@@ -102,6 +133,16 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	return request, nil
 }
 
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if a.ChannelType == channeltype.SiliconFlow {
+		return siliconflow.ConvertRerankRequest(request), nil
+	}
+	return request, nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
 }
@@ -118,8 +159,12 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		}
 	} else {
 		switch meta.Mode {
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations,
+			relaymode.ImagesEdits,
+			relaymode.ImagesVariations:
 			err, _ = ImageHandler(c, resp)
+		case relaymode.Rerank:
+			err, usage = RerankHandler(c, resp, meta.PromptTokens)
 		default:
 			err, usage, responseText = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
 		}
@@ -3,12 +3,77 @@ package openai
 import (
 	"bytes"
 	"encoding/json"
-	"github.com/gin-gonic/gin"
-	"github.com/songquanpeng/one-api/relay/model"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
+func writeImageFile(writer *multipart.Writer, field string, file *model.ImageFile) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, file.Filename))
+	header.Set("Content-Type", file.ContentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(file.Data)
+	return err
+}
+
+// ConvertImageEditRequest rebuilds the multipart body of an image edit or variation request,
+// the boundary of the client request is kept so that its Content-Type header stays valid.
+func ConvertImageEditRequest(request *model.ImageRequest, relayMode int, boundary string) (io.Reader, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	fields := [][2]string{
+		{"model", request.Model},
+		{"n", strconv.Itoa(request.N)},
+		{"size", request.Size},
+		{"response_format", request.ResponseFormat},
+		{"user", request.User},
+	}
+	if relayMode == relaymode.ImagesEdits {
+		fields = append(fields, [2]string{"prompt", request.Prompt}, [2]string{"quality", request.Quality})
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return nil, err
+		}
+	}
+	imageField := "image"
+	if len(request.Image) > 1 {
+		imageField = "image[]"
+	}
+	for _, image := range request.Image {
+		if err := writeImageFile(writer, imageField, image); err != nil {
+			return nil, err
+		}
+	}
+	if request.Mask != nil {
+		if err := writeImageFile(writer, "mask", request.Mask); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
 func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
 	var imageResponse ImageResponse
 	responseBody, err := io.ReadAll(resp.Body)
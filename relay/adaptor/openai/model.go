@@ -1,6 +1,10 @@
 package openai
 
-import "github.com/songquanpeng/one-api/relay/model"
+import (
+	"encoding/json"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
 
 type TextContent struct {
 	Type string `json:"type,omitempty"`
@@ -143,3 +147,125 @@ type CompletionsStreamResponse struct {
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 }
+
+// https://platform.openai.com/docs/api-reference/responses
+
+type ResponsesRequest struct {
+	Model              string              `json:"model"`
+	Input              json.RawMessage     `json:"input,omitempty"`
+	Instructions       string              `json:"instructions,omitempty"`
+	PreviousResponseId string              `json:"previous_response_id,omitempty"`
+	Store              *bool               `json:"store,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	TopP               *float64            `json:"top_p,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	Tools              []ResponsesTool     `json:"tools,omitempty"`
+	ToolChoice         any                 `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	Text               *ResponsesText      `json:"text,omitempty"`
+	Reasoning          *ResponsesReasoning `json:"reasoning,omitempty"`
+	Metadata           map[string]any      `json:"metadata,omitempty"`
+	User               string              `json:"user,omitempty"`
+}
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesTextFormat struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort *string `json:"effort,omitempty"`
+}
+
+// ResponsesInputItem is an item of the input list, e.g. a message or a function call output
+type ResponsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+}
+
+type ResponsesContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	ImageUrl    string `json:"image_url,omitempty"`
+	FileId      string `json:"file_id,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	FileData    string `json:"file_data,omitempty"`
+	Annotations []any  `json:"annotations"`
+}
+
+type ResponsesOutputItem struct {
+	Type      string             `json:"type"`
+	Id        string             `json:"id"`
+	Status    string             `json:"status,omitempty"`
+	Role      string             `json:"role,omitempty"`
+	Content   []ResponsesContent `json:"content,omitempty"`
+	CallId    string             `json:"call_id,omitempty"`
+	Name      string             `json:"name,omitempty"`
+	Arguments *string            `json:"arguments,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponsesResponse struct {
+	Id                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status"`
+	Model              string                      `json:"model"`
+	Output             []ResponsesOutputItem       `json:"output"`
+	Instructions       *string                     `json:"instructions"`
+	PreviousResponseId *string                     `json:"previous_response_id"`
+	Tools              []ResponsesTool             `json:"tools"`
+	ToolChoice         any                         `json:"tool_choice"`
+	ParallelToolCalls  bool                        `json:"parallel_tool_calls"`
+	Temperature        *float64                    `json:"temperature"`
+	TopP               *float64                    `json:"top_p"`
+	MaxOutputTokens    *int                        `json:"max_output_tokens"`
+	Metadata           map[string]any              `json:"metadata"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Error              *model.Error                `json:"error"`
+	Usage              *ResponsesUsage             `json:"usage"`
+}
+
+type ResponsesStreamEvent struct {
+	Type           string               `json:"type"`
+	SequenceNumber int                  `json:"sequence_number"`
+	Response       *ResponsesResponse   `json:"response,omitempty"`
+	OutputIndex    *int                 `json:"output_index,omitempty"`
+	ContentIndex   *int                 `json:"content_index,omitempty"`
+	ItemId         string               `json:"item_id,omitempty"`
+	Item           *ResponsesOutputItem `json:"item,omitempty"`
+	Part           *ResponsesContent    `json:"part,omitempty"`
+	Delta          string               `json:"delta,omitempty"`
+	Text           *string              `json:"text,omitempty"`
+	Arguments      *string              `json:"arguments,omitempty"`
+}
@@ -0,0 +1,52 @@
+package openai
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// https://platform.openai.com/docs/api-reference/realtime-server-events/response/done
+
+type RealtimeTokenDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	TextTokens   int `json:"text_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens        int                  `json:"total_tokens"`
+	InputTokens        int                  `json:"input_tokens"`
+	OutputTokens       int                  `json:"output_tokens"`
+	InputTokenDetails  RealtimeTokenDetails `json:"input_token_details"`
+	OutputTokenDetails RealtimeTokenDetails `json:"output_token_details"`
+}
+
+type RealtimeResponse struct {
+	Id     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage,omitempty"`
+}
+
+type RealtimeEvent struct {
+	Type     string            `json:"type"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+}
+
+// getRealtimeURL returns the websocket url of the realtime api
+func getRealtimeURL(meta *meta.Meta) string {
+	var fullRequestURL string
+	if meta.ChannelType == channeltype.Azure {
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/realtime-audio-websockets
+		fullRequestURL = fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s", meta.BaseURL, meta.Config.APIVersion, url.QueryEscape(meta.ActualModelName))
+	} else {
+		fullRequestURL = GetFullRequestURL(meta.BaseURL, "/v1/realtime?model="+url.QueryEscape(meta.ActualModelName), meta.ChannelType)
+	}
+	if strings.HasPrefix(fullRequestURL, "https://") {
+		return "wss://" + strings.TrimPrefix(fullRequestURL, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(fullRequestURL, "http://")
+}
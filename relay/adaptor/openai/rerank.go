@@ -0,0 +1,67 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankUsage returns the document tokens reported by the upstream,
+// falling back to the tokens counted locally
+func RerankUsage(response *model.RerankResponse, promptTokens int) *model.Usage {
+	usage := &model.Usage{PromptTokens: promptTokens}
+	switch {
+	case response.Usage != nil && response.Usage.PromptTokens != 0:
+		usage.PromptTokens = response.Usage.PromptTokens
+	case response.Usage != nil && response.Usage.TotalTokens != 0:
+		// jina only returns the total tokens
+		usage.PromptTokens = response.Usage.TotalTokens
+	case response.Meta != nil && response.Meta.Tokens != nil && response.Meta.Tokens.InputTokens != 0:
+		usage.PromptTokens = response.Meta.Tokens.InputTokens
+	case response.Meta != nil && response.Meta.BilledUnits != nil && response.Meta.BilledUnits.InputTokens != 0:
+		usage.PromptTokens = response.Meta.BilledUnits.InputTokens
+	}
+	usage.TotalTokens = usage.PromptTokens
+	return usage
+}
+
+// SetRerankSearchUnits saves the search units billed by the upstream for the rerank billing
+func SetRerankSearchUnits(c *gin.Context, response *model.RerankResponse) {
+	if response.Meta != nil && response.Meta.BilledUnits != nil && response.Meta.BilledUnits.SearchUnits != 0 {
+		c.Set(ctxkey.RerankSearchUnits, response.Meta.BilledUnits.SearchUnits)
+	}
+}
+
+func RerankHandler(c *gin.Context, resp *http.Response, promptTokens int) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResponse model.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	SetRerankSearchUnits(c, &rerankResponse)
+
+	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(c.Writer, resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, RerankUsage(&rerankResponse, promptTokens)
+}
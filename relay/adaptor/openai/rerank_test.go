@@ -0,0 +1,30 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRerankUsage(t *testing.T) {
+	cases := []struct {
+		body         string
+		promptTokens int
+	}{
+		// jina
+		{`{"model": "jina-reranker-v2-base-multilingual", "usage": {"total_tokens": 15}, "results": []}`, 15},
+		// siliconflow
+		{`{"id": "1", "results": [], "meta": {"billed_units": {"input_tokens": 12}, "tokens": {"input_tokens": 11}}}`, 11},
+		// cohere doesn't return the tokens
+		{`{"id": "1", "results": [], "meta": {"billed_units": {"search_units": 1}}}`, 7},
+	}
+	for _, c := range cases {
+		var response model.RerankResponse
+		assert.NoError(t, json.Unmarshal([]byte(c.body), &response))
+		usage := RerankUsage(&response, 7)
+		assert.Equal(t, c.promptTokens, usage.PromptTokens)
+		assert.Equal(t, c.promptTokens, usage.TotalTokens)
+	}
+}
@@ -0,0 +1,708 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// This file implements the Responses API: it is passed through to OpenAI compatible
+// upstreams, and translated to chat completions and back for every other channel.
+
+// ResponsesInputToMessages converts the input of a Responses request to chat completion messages.
+func ResponsesInputToMessages(input json.RawMessage) ([]model.Message, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return []model.Message{{Role: "user", Content: text}}, nil
+	}
+	var items []ResponsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	var messages []model.Message
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			content, err := responsesContentToChat(item.Content)
+			if err != nil {
+				return nil, err
+			}
+			messageRole := item.Role
+			if messageRole == "developer" {
+				messageRole = role.System
+			}
+			messages = append(messages, model.Message{
+				Role:    messageRole,
+				Content: content,
+			})
+		case "function_call":
+			toolCall := model.Tool{
+				Id:   item.CallId,
+				Type: "function",
+				Function: model.Function{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// parallel function calls belong to the same assistant message
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == role.Assistant {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, toolCall)
+				continue
+			}
+			messages = append(messages, model.Message{
+				Role:      role.Assistant,
+				Content:   "",
+				ToolCalls: []model.Tool{toolCall},
+			})
+		case "function_call_output":
+			var output string
+			if err := json.Unmarshal(item.Output, &output); err != nil {
+				output = string(item.Output)
+			}
+			messages = append(messages, model.Message{
+				Role:       "tool",
+				Content:    output,
+				ToolCallId: item.CallId,
+			})
+		case "reasoning":
+			// reasoning items are only meaningful to the upstream that produced them
+			continue
+		default:
+			return nil, fmt.Errorf("input item type %s is not supported", item.Type)
+		}
+	}
+	return messages, nil
+}
+
+func responsesContentToChat(content json.RawMessage) (any, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+	var parts []ResponsesContent
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+	var chatParts []any
+	var texts []string
+	textOnly := true
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			texts = append(texts, part.Text)
+			chatParts = append(chatParts, map[string]any{
+				"type": model.ContentTypeText,
+				"text": part.Text,
+			})
+		case "input_image":
+			textOnly = false
+			chatParts = append(chatParts, map[string]any{
+				"type": model.ContentTypeImageURL,
+				"image_url": map[string]any{
+					"url": part.ImageUrl,
+				},
+			})
+		case "input_file":
+			textOnly = false
+			file := map[string]any{}
+			for key, value := range map[string]string{"file_id": part.FileId, "filename": part.Filename, "file_data": part.FileData} {
+				if value != "" {
+					file[key] = value
+				}
+			}
+			chatParts = append(chatParts, map[string]any{
+				"type": model.ContentTypeFile,
+				"file": file,
+			})
+		default:
+			return nil, fmt.Errorf("content type %s is not supported", part.Type)
+		}
+	}
+	if textOnly {
+		return strings.Join(texts, "\n"), nil
+	}
+	return chatParts, nil
+}
+
+// MessagesToResponsesInput converts chat completion messages back to Responses input items,
+// it is used to replay a stored conversation to an upstream that does not know about it.
+func MessagesToResponsesInput(messages []model.Message) []any {
+	var items []any
+	for _, message := range messages {
+		switch message.Role {
+		case role.Assistant:
+			if text := message.StringContent(); text != "" {
+				items = append(items, map[string]any{
+					"type":    "message",
+					"role":    role.Assistant,
+					"content": []any{map[string]any{"type": "output_text", "text": text}},
+				})
+			}
+			for _, toolCall := range message.ToolCalls {
+				items = append(items, map[string]any{
+					"type":      "function_call",
+					"call_id":   toolCall.Id,
+					"name":      toolCall.Function.Name,
+					"arguments": conv.AsString(toolCall.Function.Arguments),
+				})
+			}
+		case "tool":
+			items = append(items, map[string]any{
+				"type":    "function_call_output",
+				"call_id": message.ToolCallId,
+				"output":  message.StringContent(),
+			})
+		default:
+			var content any = message.StringContent()
+			if !message.IsStringContent() {
+				var parts []any
+				for _, part := range message.ParseContent() {
+					switch part.Type {
+					case model.ContentTypeText:
+						parts = append(parts, map[string]any{"type": "input_text", "text": part.Text})
+					case model.ContentTypeImageURL:
+						parts = append(parts, map[string]any{"type": "input_image", "image_url": part.ImageURL.Url})
+					case model.ContentTypeFile:
+						parts = append(parts, map[string]any{"type": "input_file", "filename": part.File.Filename, "file_data": part.File.FileData})
+					}
+				}
+				content = parts
+			}
+			items = append(items, map[string]any{
+				"type":    "message",
+				"role":    message.Role,
+				"content": content,
+			})
+		}
+	}
+	return items
+}
+
+// ResponsesOutputToMessages converts the output of a response to chat completion messages.
+func ResponsesOutputToMessages(output []ResponsesOutputItem) []model.Message {
+	message := model.Message{Role: role.Assistant}
+	var text strings.Builder
+	for _, item := range output {
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				text.WriteString(content.Text)
+			}
+		case "function_call":
+			message.ToolCalls = append(message.ToolCalls, model.Tool{
+				Id:   item.CallId,
+				Type: "function",
+				Function: model.Function{
+					Name:      item.Name,
+					Arguments: conv.AsString(item.Arguments),
+				},
+			})
+		}
+	}
+	message.Content = text.String()
+	if text.Len() == 0 && len(message.ToolCalls) == 0 {
+		return nil
+	}
+	return []model.Message{message}
+}
+
+// RequestResponses2OpenAI converts a Responses request to a chat completion request,
+// history holds the messages of the responses chained by previous_response_id.
+func RequestResponses2OpenAI(request *ResponsesRequest, history []model.Message) (*model.GeneralOpenAIRequest, error) {
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:            request.Model,
+		Stream:           request.Stream,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		MaxTokens:        request.MaxOutputTokens,
+		ParallelTooCalls: request.ParallelToolCalls,
+		User:             request.User,
+	}
+	if request.Stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if request.Reasoning != nil {
+		openaiRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+	if request.Text != nil && request.Text.Format != nil {
+		switch request.Text.Format.Type {
+		case "json_schema":
+			openaiRequest.ResponseFormat = &model.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &model.JSONSchema{
+					Name:        request.Text.Format.Name,
+					Description: request.Text.Format.Description,
+					Schema:      request.Text.Format.Schema,
+					Strict:      request.Text.Format.Strict,
+				},
+			}
+		case "json_object":
+			openaiRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	// instructions of previous responses are not carried over
+	if request.Instructions != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    role.System,
+			Content: request.Instructions,
+		})
+	}
+	openaiRequest.Messages = append(openaiRequest.Messages, history...)
+	messages, err := ResponsesInputToMessages(request.Input)
+	if err != nil {
+		return nil, err
+	}
+	openaiRequest.Messages = append(openaiRequest.Messages, messages...)
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported by this channel", tool.Type)
+		}
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	switch toolChoice := request.ToolChoice.(type) {
+	case string:
+		openaiRequest.ToolChoice = toolChoice
+	case map[string]any:
+		if toolChoice["type"] == "function" {
+			openaiRequest.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": toolChoice["name"]},
+			}
+		}
+	}
+	return &openaiRequest, nil
+}
+
+func responsesStatus(finishReason string) (string, *ResponsesIncompleteDetails) {
+	switch finishReason {
+	case "length":
+		return "incomplete", &ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		return "incomplete", &ResponsesIncompleteDetails{Reason: "content_filter"}
+	default:
+		return "completed", nil
+	}
+}
+
+func responsesUsage(usage *model.Usage) *ResponsesUsage {
+	if usage == nil {
+		return nil
+	}
+	return &ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+// ResponsesUsage2Usage converts the usage of a response to the usage used for billing.
+func ResponsesUsage2Usage(usage *ResponsesUsage) *model.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &model.Usage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.InputTokens + usage.OutputTokens,
+	}
+}
+
+// ResponsesOutputText concatenates the text of the output messages of a response.
+func ResponsesOutputText(response *ResponsesResponse) string {
+	var text strings.Builder
+	for _, item := range response.Output {
+		for _, content := range item.Content {
+			text.WriteString(content.Text)
+		}
+		if item.Arguments != nil {
+			text.WriteString(*item.Arguments)
+		}
+	}
+	return text.String()
+}
+
+// ResponsesConverter renders chat completion output as a Responses API response or event stream.
+type ResponsesConverter struct {
+	response ResponsesResponse
+	sequence int
+	started  bool
+	// the output item that is being streamed, text or function call
+	current      *ResponsesOutputItem
+	currentIndex int
+	text         strings.Builder
+	arguments    strings.Builder
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewResponsesConverter(id string, request *ResponsesRequest) *ResponsesConverter {
+	response := ResponsesResponse{
+		Id:                id,
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Status:            "in_progress",
+		Model:             request.Model,
+		Output:            []ResponsesOutputItem{},
+		Tools:             request.Tools,
+		ToolChoice:        request.ToolChoice,
+		ParallelToolCalls: request.ParallelToolCalls == nil || *request.ParallelToolCalls,
+		Temperature:       request.Temperature,
+		TopP:              request.TopP,
+		Metadata:          request.Metadata,
+	}
+	if response.Tools == nil {
+		response.Tools = []ResponsesTool{}
+	}
+	if response.ToolChoice == nil {
+		response.ToolChoice = "auto"
+	}
+	if request.Instructions != "" {
+		response.Instructions = &request.Instructions
+	}
+	if request.PreviousResponseId != "" {
+		response.PreviousResponseId = &request.PreviousResponseId
+	}
+	if request.MaxOutputTokens != 0 {
+		response.MaxOutputTokens = &request.MaxOutputTokens
+	}
+	return &ResponsesConverter{response: response}
+}
+
+// Response returns the response rendered to the client, complete once the relay has finished.
+func (r *ResponsesConverter) Response() *ResponsesResponse {
+	return &r.response
+}
+
+func (r *ResponsesConverter) ContentType(stream bool) string {
+	if stream {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (r *ResponsesConverter) writeEvent(w io.Writer, event *ResponsesStreamEvent) error {
+	event.SequenceNumber = r.sequence
+	r.sequence++
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, jsonData)
+	return err
+}
+
+func (r *ResponsesConverter) snapshot() *ResponsesResponse {
+	response := r.response
+	response.Output = append([]ResponsesOutputItem{}, r.response.Output...)
+	return &response
+}
+
+func (r *ResponsesConverter) openItem(w io.Writer, item ResponsesOutputItem) error {
+	if err := r.closeItem(w); err != nil {
+		return err
+	}
+	r.currentIndex = len(r.response.Output)
+	r.response.Output = append(r.response.Output, item)
+	r.current = &r.response.Output[r.currentIndex]
+	index := r.currentIndex
+	if err := r.writeEvent(w, &ResponsesStreamEvent{
+		Type:        "response.output_item.added",
+		OutputIndex: &index,
+		Item:        &item,
+	}); err != nil {
+		return err
+	}
+	if item.Type != "message" {
+		return nil
+	}
+	contentIndex := 0
+	return r.writeEvent(w, &ResponsesStreamEvent{
+		Type:         "response.content_part.added",
+		ItemId:       item.Id,
+		OutputIndex:  &index,
+		ContentIndex: &contentIndex,
+		Part:         &ResponsesContent{Type: "output_text", Annotations: []any{}},
+	})
+}
+
+func (r *ResponsesConverter) closeItem(w io.Writer) error {
+	if r.current == nil {
+		return nil
+	}
+	item := r.current
+	r.current = nil
+	index := r.currentIndex
+	item.Status = "completed"
+	if item.Type == "message" {
+		text := r.text.String()
+		r.text.Reset()
+		contentIndex := 0
+		part := ResponsesContent{Type: "output_text", Text: text, Annotations: []any{}}
+		item.Content = []ResponsesContent{part}
+		if err := r.writeEvent(w, &ResponsesStreamEvent{
+			Type:         "response.output_text.done",
+			ItemId:       item.Id,
+			OutputIndex:  &index,
+			ContentIndex: &contentIndex,
+			Text:         &text,
+		}); err != nil {
+			return err
+		}
+		if err := r.writeEvent(w, &ResponsesStreamEvent{
+			Type:         "response.content_part.done",
+			ItemId:       item.Id,
+			OutputIndex:  &index,
+			ContentIndex: &contentIndex,
+			Part:         &part,
+		}); err != nil {
+			return err
+		}
+	} else {
+		arguments := r.arguments.String()
+		r.arguments.Reset()
+		item.Arguments = &arguments
+		if err := r.writeEvent(w, &ResponsesStreamEvent{
+			Type:        "response.function_call_arguments.done",
+			ItemId:      item.Id,
+			OutputIndex: &index,
+			Arguments:   &arguments,
+		}); err != nil {
+			return err
+		}
+	}
+	done := *item
+	return r.writeEvent(w, &ResponsesStreamEvent{
+		Type:        "response.output_item.done",
+		OutputIndex: &index,
+		Item:        &done,
+	})
+}
+
+func (r *ResponsesConverter) ConvertStreamChunk(w io.Writer, chunk *ChatCompletionsStreamResponse) error {
+	if chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+	if !r.started {
+		r.started = true
+		if err := r.writeEvent(w, &ResponsesStreamEvent{Type: "response.created", Response: r.snapshot()}); err != nil {
+			return err
+		}
+		if err := r.writeEvent(w, &ResponsesStreamEvent{Type: "response.in_progress", Response: r.snapshot()}); err != nil {
+			return err
+		}
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		r.finishReason = *choice.FinishReason
+	}
+	if text := conv.AsString(choice.Delta.Content); text != "" {
+		if r.current == nil || r.current.Type != "message" {
+			if err := r.openItem(w, ResponsesOutputItem{
+				Type:    "message",
+				Id:      "msg_" + strings.TrimPrefix(r.response.Id, "resp_"),
+				Status:  "in_progress",
+				Role:    role.Assistant,
+				Content: []ResponsesContent{},
+			}); err != nil {
+				return err
+			}
+		}
+		r.text.WriteString(text)
+		index, contentIndex := r.currentIndex, 0
+		if err := r.writeEvent(w, &ResponsesStreamEvent{
+			Type:         "response.output_text.delta",
+			ItemId:       r.current.Id,
+			OutputIndex:  &index,
+			ContentIndex: &contentIndex,
+			Delta:        text,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, toolCall := range choice.Delta.ToolCalls {
+		if toolCall.Id != "" || toolCall.Function.Name != "" || r.current == nil || r.current.Type != "function_call" {
+			arguments := ""
+			if err := r.openItem(w, ResponsesOutputItem{
+				Type:      "function_call",
+				Id:        "fc_" + toolCall.Id,
+				Status:    "in_progress",
+				CallId:    toolCall.Id,
+				Name:      toolCall.Function.Name,
+				Arguments: &arguments,
+			}); err != nil {
+				return err
+			}
+		}
+		delta := conv.AsString(toolCall.Function.Arguments)
+		if delta == "" {
+			continue
+		}
+		r.arguments.WriteString(delta)
+		index := r.currentIndex
+		if err := r.writeEvent(w, &ResponsesStreamEvent{
+			Type:        "response.function_call_arguments.delta",
+			ItemId:      r.current.Id,
+			OutputIndex: &index,
+			Delta:       delta,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertStreamEnd closes the open output item and sends the completed response.
+func (r *ResponsesConverter) ConvertStreamEnd(w io.Writer, usage *model.Usage) error {
+	if usage == nil {
+		usage = r.usage
+	}
+	if err := r.closeItem(w); err != nil {
+		return err
+	}
+	r.response.Status, r.response.IncompleteDetails = responsesStatus(r.finishReason)
+	r.response.Usage = responsesUsage(usage)
+	eventType := "response.completed"
+	if r.response.Status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	return r.writeEvent(w, &ResponsesStreamEvent{Type: eventType, Response: r.snapshot()})
+}
+
+func (r *ResponsesConverter) ConvertResponse(w io.Writer, response *TextResponse) error {
+	r.response.Status = "completed"
+	if len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		if text := choice.StringContent(); text != "" {
+			r.response.Output = append(r.response.Output, ResponsesOutputItem{
+				Type:    "message",
+				Id:      "msg_" + strings.TrimPrefix(r.response.Id, "resp_"),
+				Status:  "completed",
+				Role:    role.Assistant,
+				Content: []ResponsesContent{{Type: "output_text", Text: text, Annotations: []any{}}},
+			})
+		}
+		for _, toolCall := range choice.ToolCalls {
+			arguments := conv.AsString(toolCall.Function.Arguments)
+			r.response.Output = append(r.response.Output, ResponsesOutputItem{
+				Type:      "function_call",
+				Id:        "fc_" + toolCall.Id,
+				Status:    "completed",
+				CallId:    toolCall.Id,
+				Name:      toolCall.Function.Name,
+				Arguments: &arguments,
+			})
+		}
+		r.response.Status, r.response.IncompleteDetails = responsesStatus(choice.FinishReason)
+	}
+	r.response.Usage = responsesUsage(&response.Usage)
+	jsonData, err := json.Marshal(r.response)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonData)
+	return err
+}
+
+// ResponsesHandler passes a Responses API response through to the client.
+func ResponsesHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *ResponsesResponse) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var response ResponsesResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if response.Error != nil && response.Error.Type != "" {
+		return &model.ErrorWithStatusCode{
+			Error:      *response.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &response
+}
+
+// ResponsesStreamHandler passes a Responses API event stream through to the client,
+// the final response is taken from the terminal event.
+func ResponsesStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *ResponsesResponse) {
+	scanner := bufio.NewScanner(resp.Body)
+	// the terminal event carries the whole response
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	var response *ResponsesResponse
+
+	common.SetEventStreamHeaders(c)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, _ = c.Writer.WriteString(line + "\n")
+		if line == "" {
+			c.Writer.Flush()
+			continue
+		}
+		if !strings.HasPrefix(line, dataPrefix) {
+			continue
+		}
+		var event ResponsesStreamEvent
+		err := json.Unmarshal([]byte(line[dataPrefixLength:]), &event)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		switch event.Type {
+		case "response.completed", "response.incomplete", "response.failed":
+			response = event.Response
+		}
+	}
+	c.Writer.Flush()
+
+	if err := scanner.Err(); err != nil {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, response
+}
@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestResponses2OpenAI(t *testing.T) {
+	body := `{
+		"model": "gpt-4o",
+		"instructions": "be brief",
+		"input": [
+			{"role": "user", "content": [{"type": "input_text", "text": "look"}, {"type": "input_image", "image_url": "data:image/png;base64,AAAA"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"}
+		],
+		"tools": [{"type": "function", "name": "get_weather", "parameters": {"type": "object"}}],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"max_output_tokens": 64
+	}`
+	var request ResponsesRequest
+	assert.NoError(t, json.Unmarshal([]byte(body), &request))
+	history := []model.Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}
+	openaiRequest, err := RequestResponses2OpenAI(&request, history)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 64, openaiRequest.MaxTokens)
+	assert.Len(t, openaiRequest.Messages, 6)
+	assert.Equal(t, "be brief", openaiRequest.Messages[0].Content)
+	assert.Equal(t, "hello", openaiRequest.Messages[2].Content)
+	assert.Equal(t, "data:image/png;base64,AAAA", openaiRequest.Messages[3].ParseContent()[1].ImageURL.Url)
+	assert.Equal(t, "call_1", openaiRequest.Messages[4].ToolCalls[0].Id)
+	assert.Equal(t, "tool", openaiRequest.Messages[5].Role)
+	assert.Equal(t, "sunny", openaiRequest.Messages[5].Content)
+	assert.Equal(t, "get_weather", openaiRequest.ToolChoice.(map[string]any)["function"].(map[string]any)["name"])
+}
+
+func TestResponsesConverter(t *testing.T) {
+	converter := NewResponsesConverter("resp_1", &ResponsesRequest{Model: "gpt-4o"})
+	var buf bytes.Buffer
+	response := TextResponse{
+		Choices: []TextResponseChoice{{
+			Message: model.Message{
+				Content:   "Hi",
+				ToolCalls: []model.Tool{{Id: "call_1", Function: model.Function{Name: "f", Arguments: `{"a":1}`}}},
+			},
+			FinishReason: "length",
+		}},
+		Usage: model.Usage{PromptTokens: 3, CompletionTokens: 5},
+	}
+	assert.NoError(t, converter.ConvertResponse(&buf, &response))
+
+	result := converter.Response()
+	assert.Equal(t, "incomplete", result.Status)
+	assert.Equal(t, "max_output_tokens", result.IncompleteDetails.Reason)
+	assert.Len(t, result.Output, 2)
+	assert.Equal(t, "Hi", result.Output[0].Content[0].Text)
+	assert.Equal(t, `{"a":1}`, *result.Output[1].Arguments)
+	assert.Equal(t, 8, result.Usage.TotalTokens)
+
+	messages := ResponsesOutputToMessages(result.Output)
+	assert.Equal(t, "Hi", messages[0].Content)
+	assert.Equal(t, "f", messages[0].ToolCalls[0].Function.Name)
+}
@@ -22,22 +22,43 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-// ImagesEditsHandler just copy response body to client
+// convertImageEditRequest converts an edit to the inpainting of flux fill, the mask is required
 //
 // https://replicate.com/black-forest-labs/flux-fill-pro
-// func ImagesEditsHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-// 	c.Writer.WriteHeader(resp.StatusCode)
-// 	for k, v := range resp.Header {
-// 		c.Writer.Header().Set(k, v[0])
-// 	}
-
-// 	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-// 		return ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError), nil
-// 	}
-// 	defer resp.Body.Close()
-
-// 	return nil, nil
-// }
+func convertImageEditRequest(request *model.ImageRequest) (*InpaintingImageByFlusReplicateRequest, error) {
+	if len(request.Image) == 0 || request.Mask == nil {
+		return nil, errors.New("both image and mask are required by flux fill")
+	}
+	return &InpaintingImageByFlusReplicateRequest{
+		Input: FluxInpaintingInput{
+			Mask:            request.Mask.DataURL(),
+			Image:           request.Image[0].DataURL(),
+			Seed:            int(time.Now().UnixNano()),
+			Steps:           50,
+			Prompt:          request.Prompt,
+			Guidance:        3,
+			OutputFormat:    "png",
+			SafetyTolerance: 5,
+		},
+	}, nil
+}
+
+// convertImageVariationRequest converts a variation to flux redux
+//
+// https://replicate.com/black-forest-labs/flux-redux-dev
+func convertImageVariationRequest(request *model.ImageRequest) (*ReduxImageRequest, error) {
+	if len(request.Image) == 0 {
+		return nil, errors.New("image is required by flux redux")
+	}
+	return &ReduxImageRequest{
+		Input: FluxReduxInput{
+			ReduxImage:   request.Image[0].DataURL(),
+			AspectRatio:  "1:1",
+			NumOutputs:   1, // billed as a single image like the other replicate image models
+			OutputFormat: "png",
+		},
+	}, nil
+}
 
 var errNextLoop = errors.New("next_loop")
 
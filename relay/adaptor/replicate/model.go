@@ -52,6 +52,21 @@ type FluxInpaintingInput struct {
 	PromptUnsampling bool   `json:"prompt_unsampling"`
 }
 
+// ReduxImageRequest is request to create variations of an image by flux redux
+//
+// https://replicate.com/black-forest-labs/flux-redux-dev/api/schema
+type ReduxImageRequest struct {
+	Input FluxReduxInput `json:"input"`
+}
+
+// FluxReduxInput is input of ReduxImageRequest
+type FluxReduxInput struct {
+	ReduxImage   string `json:"redux_image" binding:"required"`
+	AspectRatio  string `json:"aspect_ratio"`
+	NumOutputs   int    `json:"num_outputs" binding:"min=1,max=4"`
+	OutputFormat string `json:"output_format"`
+}
+
 // ImageResponse is response of DrawImageByFluxProRequest
 //
 // https://replicate.com/black-forest-labs/flux-pro?prediction=kg1krwsdf9rg80ch1sgsrgq7h8&output=json
@@ -0,0 +1,19 @@
+package siliconflow
+
+import (
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.siliconflow.cn/api-reference/rerank/create-rerank
+
+// ConvertRerankRequest flattens the documents, siliconflow only accepts plain strings
+func ConvertRerankRequest(request *model.RerankRequest) *model.RerankRequest {
+	texts := request.DocumentTexts()
+	documents := make([]any, 0, len(texts))
+	for _, text := range texts {
+		documents = append(documents, text)
+	}
+	converted := *request
+	converted.Documents = documents
+	return &converted
+}
@@ -3,6 +3,7 @@ package billing
 import (
 	"context"
 	"fmt"
+	"math"
 
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
@@ -20,7 +21,16 @@ func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, tokenId
 	}
 }
 
-func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQuota int64, userId int, channelId int, modelRatio float64, groupRatio float64, modelName string, tokenName string) {
+// UpstreamCost converts the quota charged to the user into what the channel was paid, the group ratio is taken
+// out and the cost multiplier of the channel applied. It is unknown for the groups that are free of charge.
+func UpstreamCost(quota int64, groupRatio float64, costMultiplier float64) int64 {
+	if groupRatio <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(quota) / groupRatio * costMultiplier))
+}
+
+func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQuota int64, userId int, channelId int, modelRatio float64, groupRatio float64, costMultiplier float64, modelName string, tokenName string) {
 	// quotaDelta is remaining quota to be consumed
 	err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
 	if err != nil {
@@ -41,6 +51,7 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 			ModelName:        modelName,
 			TokenName:        tokenName,
 			Quota:            int(totalQuota),
+			UpstreamCost:     int(UpstreamCost(totalQuota, groupRatio, costMultiplier)),
 			Content:          logContent,
 		})
 		model.UpdateUserUsedQuotaAndRequestCount(userId, totalQuota)
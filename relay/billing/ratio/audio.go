@@ -0,0 +1,42 @@
+package ratio
+
+import "strings"
+
+// AudioRatio is the price of the audio input tokens relative to the text input tokens
+// https://openai.com/api/pricing/
+var AudioRatio = map[string]float64{
+	"gpt-4o-realtime-preview":                 40.0 / 5,  // $40 / 1M audio input tokens
+	"gpt-4o-realtime-preview-2024-10-01":      100.0 / 5, // $100 / 1M audio input tokens
+	"gpt-4o-realtime-preview-2024-12-17":      40.0 / 5,
+	"gpt-4o-mini-realtime-preview":            10.0 / 0.6, // $10 / 1M audio input tokens
+	"gpt-4o-mini-realtime-preview-2024-12-17": 10.0 / 0.6,
+}
+
+// AudioCompletionRatio is the price of the audio output tokens relative to the audio input tokens
+var AudioCompletionRatio = map[string]float64{
+	"gpt-4o-realtime-preview":                 2,
+	"gpt-4o-realtime-preview-2024-10-01":      2,
+	"gpt-4o-realtime-preview-2024-12-17":      2,
+	"gpt-4o-mini-realtime-preview":            2,
+	"gpt-4o-mini-realtime-preview-2024-12-17": 2,
+}
+
+func GetAudioRatio(name string) float64 {
+	if ratio, ok := AudioRatio[name]; ok {
+		return ratio
+	}
+	if strings.HasPrefix(name, "gpt-4o-mini") {
+		return AudioRatio["gpt-4o-mini-realtime-preview"]
+	}
+	if strings.HasPrefix(name, "gpt-4o") {
+		return AudioRatio["gpt-4o-realtime-preview"]
+	}
+	return 1
+}
+
+func GetAudioCompletionRatio(name string) float64 {
+	if ratio, ok := AudioCompletionRatio[name]; ok {
+		return ratio
+	}
+	return 2
+}
@@ -87,6 +87,12 @@ var ModelRatio = map[string]float64{
 	"text-moderation-latest":  0.1,
 	"dall-e-2":                0.02 * USD, // $0.016 - $0.020 / image
 	"dall-e-3":                0.04 * USD, // $0.040 - $0.120 / image
+	// the audio tokens of the realtime models are priced with AudioRatio
+	"gpt-4o-realtime-preview":                 5.0 / 1000 * USD,
+	"gpt-4o-realtime-preview-2024-10-01":      5.0 / 1000 * USD,
+	"gpt-4o-realtime-preview-2024-12-17":      5.0 / 1000 * USD,
+	"gpt-4o-mini-realtime-preview":            0.6 / 1000 * USD,
+	"gpt-4o-mini-realtime-preview-2024-12-17": 0.6 / 1000 * USD,
 	// https://docs.anthropic.com/en/docs/about-claude/models
 	"claude-instant-1.2":         0.8 / 1000 * USD,
 	"claude-2.0":                 8.0 / 1000 * USD,
@@ -337,6 +343,16 @@ var ModelRatio = map[string]float64{
 	// https://platform.deepseek.com/api-docs/pricing/
 	"deepseek-chat":     0.14 * MILLI_USD,
 	"deepseek-reasoner": 0.55 * MILLI_USD,
+	// rerank models billed per document token, see RerankRatio for the ones billed per search unit
+	// https://jina.ai/reranker
+	"jina-reranker-v2-base-multilingual": 0.02 / 1000 * USD,
+	"jina-reranker-v1-base-en":           0.02 / 1000 * USD,
+	"jina-reranker-v1-turbo-en":          0.02 / 1000 * USD,
+	"jina-colbert-v2":                    0.02 / 1000 * USD,
+	// https://siliconflow.cn/pricing
+	"BAAI/bge-reranker-v2-m3":             0,
+	"Pro/BAAI/bge-reranker-v2-m3":         0.0007 * RMB,
+	"netease-youdao/bce-reranker-base_v1": 0,
 	// https://www.deepl.com/pro?cta=header-prices
 	"deepl-zh": 25.0 / 1000 * USD,
 	"deepl-en": 25.0 / 1000 * USD,
@@ -0,0 +1,45 @@
+package ratio
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var rerankRatioLock sync.RWMutex
+
+// RerankRatio is the price of the rerank models billed per search unit,
+// the rerank models not listed here are billed per document token with ModelRatio
+// 1 === $0.002 / 1 search unit
+var RerankRatio = map[string]float64{
+	// https://cohere.com/pricing
+	"rerank-v3.5":              1, // $2 / 1K searches
+	"rerank-english-v3.0":      1,
+	"rerank-multilingual-v3.0": 1,
+	"rerank-english-v2.0":      1,
+	"rerank-multilingual-v2.0": 1,
+}
+
+func RerankRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(RerankRatio)
+	if err != nil {
+		logger.SysError("error marshalling rerank ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateRerankRatioByJSONString(jsonStr string) error {
+	rerankRatioLock.Lock()
+	defer rerankRatioLock.Unlock()
+	RerankRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &RerankRatio)
+}
+
+// GetRerankRatio returns the price of a search unit, ok is false when the model is billed per token
+func GetRerankRatio(name string) (ratio float64, ok bool) {
+	rerankRatioLock.RLock()
+	defer rerankRatioLock.RUnlock()
+	ratio, ok = RerankRatio[name]
+	return
+}
@@ -0,0 +1,53 @@
+package budget
+
+import (
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+// A channel may have a daily budget of requests and tokens. The usage of a channel is counted per period, which
+// starts at the daily reset time of the channel, so that a new period starts with an empty usage.
+
+// Usage is what a channel used in a period
+type Usage struct {
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+type store interface {
+	add(channelId int, period time.Time, usage Usage)
+	get(channelId int, period time.Time) Usage
+}
+
+var localStore = newMemoryStore()
+
+func getStore() store {
+	if common.RedisEnabled {
+		return redisStore{}
+	}
+	return localStore
+}
+
+// AddRequest counts a request sent to the channel in the period
+func AddRequest(channelId int, period time.Time) {
+	getStore().add(channelId, period, Usage{Requests: 1})
+}
+
+// AddTokens counts the tokens used by a request of the channel in the period
+func AddTokens(channelId int, period time.Time, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	getStore().add(channelId, period, Usage{Tokens: tokens})
+}
+
+// Get returns the usage of the channel in the period
+func Get(channelId int, period time.Time) Usage {
+	return getStore().get(channelId, period)
+}
+
+// IsExhausted tells whether the usage reached one of the limits, a limit of 0 is no limit
+func (usage Usage) IsExhausted(requestLimit int64, tokenLimit int64) bool {
+	return requestLimit > 0 && usage.Requests >= requestLimit || tokenLimit > 0 && usage.Tokens >= tokenLimit
+}
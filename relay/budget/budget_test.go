@@ -0,0 +1,30 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestBudget(t *testing.T) {
+	common.RedisEnabled = false
+	today := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
+	AddRequest(1, today)
+	AddRequest(1, today)
+	AddTokens(1, today, 150)
+	assert.Equal(t, Usage{Requests: 2, Tokens: 150}, Get(1, today))
+	assert.True(t, Get(1, today).IsExhausted(2, 0))
+	assert.False(t, Get(1, today).IsExhausted(3, 200))
+	assert.True(t, Get(1, today).IsExhausted(0, 100))
+
+	// a new period starts empty, and the late requests of the previous one are not counted in it
+	AddRequest(1, tomorrow)
+	AddTokens(1, today, 50)
+	assert.Equal(t, Usage{Requests: 1}, Get(1, tomorrow))
+	assert.Equal(t, Usage{}, Get(1, today))
+	assert.Equal(t, Usage{}, Get(2, today))
+}
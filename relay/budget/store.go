@@ -0,0 +1,90 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// periodTTL keeps the usage of a period a bit longer than the period itself
+const periodTTL = 48 * time.Hour
+
+type periodUsage struct {
+	period time.Time
+	usage  Usage
+}
+
+// memoryStore counts the usage of this node only, it is used when redis is not enabled
+type memoryStore struct {
+	lock  sync.Mutex
+	usage map[int]*periodUsage
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		usage: make(map[int]*periodUsage),
+	}
+}
+
+func (s *memoryStore) add(channelId int, period time.Time, usage Usage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, ok := s.usage[channelId]
+	if !ok || current.period.Before(period) {
+		current = &periodUsage{period: period}
+		s.usage[channelId] = current
+	} else if current.period.After(period) {
+		// the request started before the reset
+		return
+	}
+	current.usage.Requests += usage.Requests
+	current.usage.Tokens += usage.Tokens
+}
+
+func (s *memoryStore) get(channelId int, period time.Time) Usage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, ok := s.usage[channelId]
+	if !ok || !current.period.Equal(period) {
+		return Usage{}
+	}
+	return current.usage
+}
+
+// redisStore shares the usage between the nodes, in a hash per channel and period
+type redisStore struct{}
+
+func redisKey(channelId int, period time.Time) string {
+	return fmt.Sprintf("channel_budget:%d:%d", channelId, period.Unix())
+}
+
+func (redisStore) add(channelId int, period time.Time, usage Usage) {
+	ctx := context.Background()
+	key := redisKey(channelId, period)
+	pipe := common.RDB.TxPipeline()
+	if usage.Requests != 0 {
+		pipe.HIncrBy(ctx, key, "requests", usage.Requests)
+	}
+	if usage.Tokens != 0 {
+		pipe.HIncrBy(ctx, key, "tokens", usage.Tokens)
+	}
+	pipe.Expire(ctx, key, periodTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.SysError("failed to count the usage of channel " + strconv.Itoa(channelId) + ": " + err.Error())
+	}
+}
+
+func (redisStore) get(channelId int, period time.Time) Usage {
+	values, err := common.RDB.HGetAll(context.Background(), redisKey(channelId, period)).Result()
+	if err != nil {
+		return Usage{}
+	}
+	requests, _ := strconv.ParseInt(values["requests"], 10, 64)
+	tokens, _ := strconv.ParseInt(values["tokens"], 10, 64)
+	return Usage{Requests: requests, Tokens: tokens}
+}
@@ -0,0 +1,64 @@
+package channelstat
+
+import (
+	"sync"
+	"time"
+)
+
+// the rolling averages are exponentially weighted, each new request counts for alpha of the average
+const alpha = 0.2
+
+// MinSamples is the number of requests needed before the statistics of a channel are trusted
+const MinSamples = 5
+
+// Stat holds the rolling averages of the recent requests relayed to a channel
+type Stat struct {
+	TTFT      float64   `json:"ttft"`       // time to first token, in seconds
+	Latency   float64   `json:"latency"`    // total latency, in seconds
+	ErrorRate float64   `json:"error_rate"` // between 0 and 1
+	Samples   int       `json:"samples"`
+	UpdatedAt time.Time `json:"updated_at"`
+	successes int
+}
+
+var stats = make(map[int]*Stat)
+var statsLock sync.RWMutex
+
+func average(current float64, value float64, samples int) float64 {
+	if samples == 0 {
+		return value
+	}
+	return current + alpha*(value-current)
+}
+
+// Record adds the result of a request to the statistics of the channel, the latencies of
+// the failed requests are left out since an error is often returned much faster than an answer.
+func Record(channelId int, ttft time.Duration, latency time.Duration, success bool) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	stat, ok := stats[channelId]
+	if !ok {
+		stat = &Stat{}
+		stats[channelId] = stat
+	}
+	errorValue := 1.0
+	if success {
+		errorValue = 0
+		stat.TTFT = average(stat.TTFT, ttft.Seconds(), stat.successes)
+		stat.Latency = average(stat.Latency, latency.Seconds(), stat.successes)
+		stat.successes++
+	}
+	stat.ErrorRate = average(stat.ErrorRate, errorValue, stat.Samples)
+	stat.Samples++
+	stat.UpdatedAt = time.Now()
+}
+
+// Get returns the statistics of the channel, ok is false until MinSamples requests were recorded
+func Get(channelId int) (stat Stat, ok bool) {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	if s, exists := stats[channelId]; exists {
+		stat = *s
+	}
+	return stat, stat.Samples >= MinSamples
+}
@@ -0,0 +1,29 @@
+package channelstat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	for i := 0; i < MinSamples-1; i++ {
+		Record(1, time.Second, 2*time.Second, true)
+	}
+	_, ok := Get(1)
+	assert.False(t, ok)
+
+	Record(1, 3*time.Second, 4*time.Second, false)
+	stat, ok := Get(1)
+	assert.True(t, ok)
+	// the latencies of the failures are ignored
+	assert.InDelta(t, 1, stat.TTFT, 1e-9)
+	assert.InDelta(t, 2, stat.Latency, 1e-9)
+	assert.InDelta(t, alpha, stat.ErrorRate, 1e-9)
+
+	Record(1, 2*time.Second, 2*time.Second, true)
+	stat, _ = Get(1)
+	assert.InDelta(t, 1+alpha, stat.TTFT, 1e-9)
+	assert.InDelta(t, alpha*(1-alpha), stat.ErrorRate, 1e-9)
+}
@@ -0,0 +1,133 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// The circuit of a channel and model opens after config.CircuitBreakerFailureThreshold consecutive
+// failures, the channel then gets no request for the model during the cooldown. After the cooldown
+// the circuit is half-open: a single trial request is let through, which closes the circuit when it
+// succeeds and opens it again when it fails.
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// circuit is the state of a channel and model as kept by the store
+type circuit struct {
+	failures int  // consecutive failures
+	open     bool // in the cooldown
+	trial    bool // a trial request of the half-open circuit is in flight
+}
+
+type store interface {
+	get(key string) circuit
+	// claimTrial reserves the trial request of a half-open circuit, it is released after ttl
+	claimTrial(key string, ttl time.Duration) bool
+	// fail counts a failure, and opens the circuit for cooldown once the failures reach threshold
+	fail(key string, threshold int, cooldown time.Duration)
+	succeed(key string)
+	releaseTrial(key string)
+}
+
+var localStore = newMemoryStore()
+
+func getStore() store {
+	if common.RedisEnabled {
+		return redisStore{}
+	}
+	return localStore
+}
+
+func enabled() bool {
+	return config.CircuitBreakerFailureThreshold > 0
+}
+
+func cooldown() time.Duration {
+	return time.Duration(config.CircuitBreakerCooldown) * time.Second
+}
+
+func getKey(channelId int, model string) string {
+	return fmt.Sprintf("%d:%s", channelId, model)
+}
+
+func (c circuit) state() string {
+	switch {
+	case c.failures < config.CircuitBreakerFailureThreshold:
+		return StateClosed
+	case c.open:
+		return StateOpen
+	default:
+		return StateHalfOpen
+	}
+}
+
+// GetState returns the state of the circuit of the channel for the model
+func GetState(channelId int, model string) string {
+	if !enabled() {
+		return StateClosed
+	}
+	return getStore().get(getKey(channelId, model)).state()
+}
+
+// Allow tells whether the channel may be picked for the model, it doesn't reserve the trial request
+// of a half-open circuit, which is done by Acquire once the channel is picked.
+func Allow(channelId int, model string) bool {
+	if !enabled() {
+		return true
+	}
+	c := getStore().get(getKey(channelId, model))
+	switch c.state() {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		return !c.trial
+	default:
+		return false
+	}
+}
+
+// Acquire is called for the picked channel, it fails when another request took the trial of a half-open circuit
+func Acquire(channelId int, model string) bool {
+	if !enabled() {
+		return true
+	}
+	key := getKey(channelId, model)
+	s := getStore()
+	switch s.get(key).state() {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		return s.claimTrial(key, cooldown())
+	default:
+		return false
+	}
+}
+
+// Report feeds the result of a request relayed to the channel for the model
+func Report(channelId int, model string, success bool) {
+	if !enabled() || model == "" {
+		return
+	}
+	key := getKey(channelId, model)
+	if success {
+		getStore().succeed(key)
+		return
+	}
+	getStore().fail(key, config.CircuitBreakerFailureThreshold, cooldown())
+}
+
+// Release gives back the trial of a half-open circuit taken by Acquire, for a request cancelled before it told
+// anything about the channel
+func Release(channelId int, model string) {
+	if !enabled() || model == "" {
+		return
+	}
+	getStore().releaseTrial(getKey(channelId, model))
+}
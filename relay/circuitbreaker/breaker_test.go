@@ -0,0 +1,44 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestCircuit(t *testing.T) {
+	common.RedisEnabled = false
+	config.CircuitBreakerFailureThreshold = 2
+	config.CircuitBreakerCooldown = 0
+
+	Report(1, "gpt-4o", false)
+	assert.Equal(t, StateClosed, GetState(1, "gpt-4o"))
+	Report(1, "gpt-4o", false)
+	assert.Equal(t, StateHalfOpen, GetState(1, "gpt-4o"))
+	assert.Equal(t, StateClosed, GetState(1, "gpt-4o-mini"))
+
+	// a single trial request goes through the half-open circuit
+	localStore.circuits["1:gpt-4o"].openUntil = time.Now().Add(time.Minute)
+	assert.Equal(t, StateOpen, GetState(1, "gpt-4o"))
+	assert.False(t, Allow(1, "gpt-4o"))
+	localStore.circuits["1:gpt-4o"].openUntil = time.Time{}
+	config.CircuitBreakerCooldown = 60
+	assert.True(t, Allow(1, "gpt-4o"))
+	assert.True(t, Acquire(1, "gpt-4o"))
+	assert.False(t, Allow(1, "gpt-4o"))
+	assert.False(t, Acquire(1, "gpt-4o"))
+	// a trial cancelled before it told anything is given back
+	Release(1, "gpt-4o")
+	assert.True(t, Acquire(1, "gpt-4o"))
+
+	// the failure of the trial opens the circuit again, its success closes it
+	Report(1, "gpt-4o", false)
+	assert.Equal(t, StateOpen, GetState(1, "gpt-4o"))
+	Report(1, "gpt-4o", true)
+	assert.Equal(t, StateClosed, GetState(1, "gpt-4o"))
+	assert.True(t, Acquire(1, "gpt-4o"))
+}
@@ -0,0 +1,163 @@
+package circuitbreaker
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+type memoryCircuit struct {
+	failures   int
+	openUntil  time.Time
+	trialUntil time.Time
+}
+
+// memoryStore keeps the circuits of this node only, it is used when redis is not enabled
+type memoryStore struct {
+	lock     sync.Mutex
+	circuits map[string]*memoryCircuit
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		circuits: make(map[string]*memoryCircuit),
+	}
+}
+
+func (s *memoryStore) get(key string) circuit {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.circuits[key]
+	if !ok {
+		return circuit{}
+	}
+	now := time.Now()
+	return circuit{
+		failures: c.failures,
+		open:     now.Before(c.openUntil),
+		trial:    now.Before(c.trialUntil),
+	}
+}
+
+func (s *memoryStore) claimTrial(key string, ttl time.Duration) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.circuits[key]
+	if !ok {
+		return true
+	}
+	now := time.Now()
+	if now.Before(c.trialUntil) {
+		return false
+	}
+	c.trialUntil = now.Add(ttl)
+	return true
+}
+
+func (s *memoryStore) fail(key string, threshold int, cooldown time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.circuits[key]
+	if !ok {
+		c = &memoryCircuit{}
+		s.circuits[key] = c
+	}
+	c.failures++
+	c.trialUntil = time.Time{}
+	if c.failures >= threshold {
+		c.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+func (s *memoryStore) succeed(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.circuits, key)
+}
+
+func (s *memoryStore) releaseTrial(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c, ok := s.circuits[key]; ok {
+		c.trialUntil = time.Time{}
+	}
+}
+
+// the failures of a circuit nobody sends a request to are forgotten after this
+const redisFailuresExpiration = time.Hour
+
+// redisStore shares the circuits between the nodes
+type redisStore struct{}
+
+// redisKeys puts the key in a hash tag, so that the keys of a circuit are in the same slot of a cluster
+func redisKeys(key string) (failuresKey string, openKey string, trialKey string) {
+	tag := "{" + key + "}"
+	return "circuit_failures:" + tag, "circuit_open:" + tag, "circuit_trial:" + tag
+}
+
+func (redisStore) get(key string) circuit {
+	failuresKey, openKey, trialKey := redisKeys(key)
+	values, err := common.RDB.MGet(context.Background(), failuresKey, openKey, trialKey).Result()
+	if err != nil {
+		logger.SysError("failed to get circuit " + key + ": " + err.Error())
+		return circuit{}
+	}
+	var c circuit
+	if failures, ok := values[0].(string); ok {
+		c.failures, _ = strconv.Atoi(failures)
+	}
+	c.open = values[1] != nil
+	c.trial = values[2] != nil
+	return c
+}
+
+func (redisStore) claimTrial(key string, ttl time.Duration) bool {
+	_, _, trialKey := redisKeys(key)
+	ok, err := common.RDB.SetNX(context.Background(), trialKey, "1", ttl).Result()
+	if err != nil {
+		logger.SysError("failed to claim the trial of circuit " + key + ": " + err.Error())
+		return true
+	}
+	return ok
+}
+
+func (redisStore) fail(key string, threshold int, cooldown time.Duration) {
+	ctx := context.Background()
+	failuresKey, openKey, trialKey := redisKeys(key)
+	var failures *redis.IntCmd
+	_, err := common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.Incr(ctx, failuresKey)
+		pipe.Expire(ctx, failuresKey, redisFailuresExpiration)
+		pipe.Del(ctx, trialKey)
+		return nil
+	})
+	if err != nil {
+		logger.SysError("failed to count the failure of circuit " + key + ": " + err.Error())
+		return
+	}
+	if int(failures.Val()) >= threshold {
+		if err = common.RDB.Set(ctx, openKey, "1", cooldown).Err(); err != nil {
+			logger.SysError("failed to open circuit " + key + ": " + err.Error())
+		}
+	}
+}
+
+func (redisStore) succeed(key string) {
+	failuresKey, openKey, trialKey := redisKeys(key)
+	if err := common.RDB.Del(context.Background(), failuresKey, openKey, trialKey).Err(); err != nil {
+		logger.SysError("failed to close circuit " + key + ": " + err.Error())
+	}
+}
+
+func (redisStore) releaseTrial(key string) {
+	_, _, trialKey := redisKeys(key)
+	if err := common.RDB.Del(context.Background(), trialKey).Err(); err != nil {
+		logger.SysError("failed to release the trial of circuit " + key + ": " + err.Error())
+	}
+}
@@ -0,0 +1,58 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+// A channel with a max concurrency serves at most that many requests at a time, the others wait for a
+// slot in a FIFO queue of bounded size. The slots and the queue are shared by the nodes through redis.
+
+var (
+	ErrQueueFull    = errors.New("the channel is saturated and its wait queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting for a free slot of the channel")
+)
+
+// DefaultQueueTimeout is used when a channel has a queue but no timeout
+const DefaultQueueTimeout = 30 * time.Second
+
+type store interface {
+	// acquire takes a slot of the channel, or waits for one in the queue
+	acquire(ctx context.Context, channelId int, limit int, queueSize int, timeout time.Duration) (release func(), err error)
+	inFlight(channelId int) int
+}
+
+var localStore = newMemoryStore()
+
+func getStore() store {
+	if common.RedisEnabled {
+		return redisStore{}
+	}
+	return localStore
+}
+
+// Acquire takes a slot of the channel, waiting up to timeout in its queue when all the slots are taken.
+// The returned function gives the slot back, it must be called exactly once.
+func Acquire(ctx context.Context, channelId int, limit int, queueSize int, timeout time.Duration) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	if timeout <= 0 {
+		timeout = DefaultQueueTimeout
+	}
+	return getStore().acquire(ctx, channelId, limit, queueSize, timeout)
+}
+
+// IsSaturated tells whether all the slots of the channel are taken
+func IsSaturated(channelId int, limit int) bool {
+	if limit <= 0 {
+		return false
+	}
+	return getStore().inFlight(channelId) >= limit
+}
@@ -0,0 +1,50 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestLimiter(t *testing.T) {
+	common.RedisEnabled = false
+	ctx := context.Background()
+
+	release1, err := Acquire(ctx, 1, 2, 1, time.Second)
+	assert.NoError(t, err)
+	release2, err := Acquire(ctx, 1, 2, 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, IsSaturated(1, 2))
+	assert.False(t, IsSaturated(2, 2))
+
+	// the third request waits for a slot, the fourth finds the queue full
+	acquired := make(chan func())
+	go func() {
+		release3, err := Acquire(ctx, 1, 2, 1, time.Second)
+		assert.NoError(t, err)
+		acquired <- release3
+	}()
+	assert.Eventually(t, func() bool {
+		localStore.lock.Lock()
+		defer localStore.lock.Unlock()
+		return localStore.semaphores[1].waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+	_, err = Acquire(ctx, 1, 2, 1, time.Second)
+	assert.Equal(t, ErrQueueFull, err)
+
+	release1()
+	release3 := <-acquired
+	assert.True(t, IsSaturated(1, 2))
+
+	// the queued request gives up after the timeout
+	_, err = Acquire(ctx, 1, 2, 1, 10*time.Millisecond)
+	assert.Equal(t, ErrQueueTimeout, err)
+
+	release2()
+	release3()
+	assert.False(t, IsSaturated(1, 2))
+}
@@ -0,0 +1,225 @@
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+type semaphore struct {
+	inFlight int
+	waiters  *list.List // of chan struct{}, closed when the slot is handed over
+}
+
+// memoryStore keeps the slots of this node only, it is used when redis is not enabled
+type memoryStore struct {
+	lock       sync.Mutex
+	semaphores map[int]*semaphore
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		semaphores: make(map[int]*semaphore),
+	}
+}
+
+func (s *memoryStore) getSemaphore(channelId int) *semaphore {
+	sem, ok := s.semaphores[channelId]
+	if !ok {
+		sem = &semaphore{waiters: list.New()}
+		s.semaphores[channelId] = sem
+	}
+	return sem
+}
+
+func (s *memoryStore) acquire(ctx context.Context, channelId int, limit int, queueSize int, timeout time.Duration) (func(), error) {
+	release := func() {
+		s.release(channelId)
+	}
+	s.lock.Lock()
+	sem := s.getSemaphore(channelId)
+	if sem.inFlight < limit && sem.waiters.Len() == 0 {
+		sem.inFlight++
+		s.lock.Unlock()
+		return release, nil
+	}
+	if sem.waiters.Len() >= queueSize {
+		s.lock.Unlock()
+		return nil, ErrQueueFull
+	}
+	granted := make(chan struct{})
+	waiter := sem.waiters.PushBack(granted)
+	s.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	err := ErrQueueTimeout
+	select {
+	case <-granted:
+		return release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-granted:
+		// the slot was handed over meanwhile
+		return release, nil
+	default:
+		sem.waiters.Remove(waiter)
+		return nil, err
+	}
+}
+
+// release hands the slot over to the first waiter, if any
+func (s *memoryStore) release(channelId int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sem := s.getSemaphore(channelId)
+	if first := sem.waiters.Front(); first != nil {
+		sem.waiters.Remove(first)
+		close(first.Value.(chan struct{}))
+		return
+	}
+	if sem.inFlight > 0 {
+		sem.inFlight--
+	}
+}
+
+func (s *memoryStore) inFlight(channelId int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sem, ok := s.semaphores[channelId]; ok {
+		return sem.inFlight
+	}
+	return 0
+}
+
+// the slots are leases, so that those of a node that died are taken back eventually
+const redisSlotLease = 15 * time.Minute
+const redisPollInterval = 50 * time.Millisecond
+
+// redisStore shares the slots between the nodes, the slots and the queue of a channel are sorted sets whose
+// members are the requests, scored by the expiration of their lease. The queue is in the order of arrival
+// since all its requests have the same lease.
+type redisStore struct{}
+
+// redisKeys puts the channel in a hash tag, so that the keys of a channel are in the same slot of a cluster
+func redisKeys(channelId int) []string {
+	tag := "{" + strconv.Itoa(channelId) + "}"
+	return []string{"channel_slots:" + tag, "channel_queue:" + tag}
+}
+
+// enterScript takes a slot when one is free and nobody is queued, it returns 1, or queues the request and
+// returns 0, or returns -1 when the queue is full
+var enterScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[2]) and redis.call('ZCARD', KEYS[2]) == 0 then
+	redis.call('ZADD', KEYS[1], now + tonumber(ARGV[4]), ARGV[6])
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	return 1
+end
+if redis.call('ZCARD', KEYS[2]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[2], now + tonumber(ARGV[5]), ARGV[6])
+	redis.call('PEXPIRE', KEYS[2], ARGV[5])
+	return 0
+end
+return -1
+`)
+
+// pollScript moves a queued request to the slots once it is among the first ones for the free slots, it
+// returns 1 when the slot is taken, 0 when the request still waits and -1 when it left the queue
+var pollScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+local rank = redis.call('ZRANK', KEYS[2], ARGV[4])
+if not rank then
+	return -1
+end
+if rank < tonumber(ARGV[2]) - redis.call('ZCARD', KEYS[1]) then
+	redis.call('ZREM', KEYS[2], ARGV[4])
+	redis.call('ZADD', KEYS[1], now + tonumber(ARGV[3]), ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+func (redisStore) acquire(ctx context.Context, channelId int, limit int, queueSize int, timeout time.Duration) (func(), error) {
+	keys := redisKeys(channelId)
+	member := helper.GenRequestID()
+	release := func() {
+		if err := common.RDB.ZRem(context.Background(), keys[0], member).Err(); err != nil {
+			logger.SysError("failed to release the slot of channel " + strconv.Itoa(channelId) + ": " + err.Error())
+		}
+	}
+	// the lease of a queued request outlives its timeout a little, so that it is not pruned while polling
+	queueLease := timeout + time.Minute
+	entered, err := enterScript.Run(ctx, common.RDB, keys, time.Now().UnixMilli(), limit, queueSize,
+		redisSlotLease.Milliseconds(), queueLease.Milliseconds(), member).Int()
+	if err != nil {
+		// the limit is not enforced while redis is unavailable
+		logger.SysError("failed to acquire a slot of channel " + strconv.Itoa(channelId) + ": " + err.Error())
+		return func() {}, nil
+	}
+	switch entered {
+	case 1:
+		return release, nil
+	case -1:
+		return nil, ErrQueueFull
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(redisPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-deadline.C:
+			err = ErrQueueTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-ticker.C:
+			polled, pollErr := pollScript.Run(context.Background(), common.RDB, keys, time.Now().UnixMilli(), limit,
+				redisSlotLease.Milliseconds(), member).Int()
+			if pollErr != nil {
+				logger.SysError("failed to poll the queue of channel " + strconv.Itoa(channelId) + ": " + pollErr.Error())
+				continue
+			}
+			switch polled {
+			case 1:
+				return release, nil
+			case -1:
+				return nil, ErrQueueTimeout
+			}
+			continue
+		}
+		if remErr := common.RDB.ZRem(context.Background(), keys[1], member).Err(); remErr != nil {
+			logger.SysError("failed to leave the queue of channel " + strconv.Itoa(channelId) + ": " + remErr.Error())
+		}
+		return nil, err
+	}
+}
+
+func (redisStore) inFlight(channelId int) int {
+	keys := redisKeys(channelId)
+	count, err := common.RDB.ZCount(context.Background(), keys[0], strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf").Result()
+	if err != nil {
+		logger.SysError("failed to count the slots of channel " + strconv.Itoa(channelId) + ": " + err.Error())
+		return 0
+	}
+	return int(count)
+}
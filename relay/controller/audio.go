@@ -110,10 +110,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}()
 
 	// map model name
-	modelMapping := c.GetStringMapString(ctxkey.ModelMapping)
-	if modelMapping != nil && modelMapping[audioModel] != "" {
-		audioModel = modelMapping[audioModel]
-	}
+	audioModel, _ = getMappedModelName(audioModel, c.GetStringMapString(ctxkey.ModelMapping))
 
 	baseURL := channeltype.ChannelBaseURLs[channelType]
 	requestURL := c.Request.URL.String()
@@ -216,7 +213,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	succeed = true
 	quotaDelta := quota - preConsumedQuota
 	defer func(ctx context.Context) {
-		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, meta.Config.GetCostMultiplier(), audioModel, tokenName)
 	}(c.Request.Context())
 
 	for k, v := range resp.Header {
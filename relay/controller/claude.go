@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayClaudeMessagesHelper serves the Anthropic Messages API on top of the chat completion relay,
+// so that Claude clients can use channels of any type.
+func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	claudeRequest := &anthropic.MessagesRequest{}
+	err := common.UnmarshalBodyReusable(c, claudeRequest)
+	if err != nil {
+		logger.Errorf(ctx, "unmarshal claude request failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_claude_request", http.StatusBadRequest)
+	}
+	textRequest, err := anthropic.RequestClaude2OpenAI(claudeRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_claude_request", http.StatusBadRequest)
+	}
+	return relayConvertedChatRequest(c, meta, textRequest, anthropic.NewResponseConverter(claudeRequest.Model))
+}
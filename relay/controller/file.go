@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func getFileDataURL(file *model.File) (string, error) {
+	reader, err := storage.Get().Open(file.Id)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data:%s;base64,%s", file.MimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// resolveFileContent replaces the references to files uploaded through /v1/files in the message
+// content with their inline data, so that adaptors never have to know about stored files.
+// Images become image_url parts, other files keep the file part with file_data set.
+func resolveFileContent(meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest) (bool, error) {
+	resolved := false
+	for _, message := range textRequest.Messages {
+		parts, ok := message.Content.([]any)
+		if !ok {
+			continue
+		}
+		for i, part := range parts {
+			contentMap, ok := part.(map[string]any)
+			if !ok {
+				continue
+			}
+			var fileId string
+			switch contentMap["type"] {
+			case relaymodel.ContentTypeFile:
+				if subObj, ok := contentMap["file"].(map[string]any); ok {
+					fileId, _ = subObj["file_id"].(string)
+				}
+			case "image_file":
+				if subObj, ok := contentMap["image_file"].(map[string]any); ok {
+					fileId, _ = subObj["file_id"].(string)
+				}
+			}
+			if fileId == "" {
+				continue
+			}
+			file, err := model.GetFileById(fileId, meta.UserId, meta.TokenId)
+			if err != nil {
+				return false, fmt.Errorf("file %s not found", fileId)
+			}
+			dataURL, err := getFileDataURL(file)
+			if err != nil {
+				return false, fmt.Errorf("read file %s failed: %w", fileId, err)
+			}
+			if strings.HasPrefix(file.MimeType, "image/") {
+				parts[i] = map[string]any{
+					"type": relaymodel.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": dataURL,
+					},
+				}
+			} else {
+				parts[i] = map[string]any{
+					"type": relaymodel.ContentTypeFile,
+					"file": map[string]any{
+						"filename":  file.Filename,
+						"file_data": dataURL,
+					},
+				}
+			}
+			resolved = true
+		}
+	}
+	return resolved, nil
+}
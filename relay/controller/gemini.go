@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayGeminiHelper serves the Gemini generateContent and streamGenerateContent API on top of
+// the chat completion relay, so that Google GenAI clients can use channels of any type.
+func RelayGeminiHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	modelName, action, _ := strings.Cut(c.Param("model"), ":")
+	var stream bool
+	switch action {
+	case "generateContent":
+	case "streamGenerateContent":
+		stream = true
+	default:
+		return openai.ErrorWrapper(fmt.Errorf("unsupported action: %s", action), "invalid_gemini_request", http.StatusNotFound)
+	}
+	geminiRequest := &gemini.ChatRequest{}
+	err := common.UnmarshalBodyReusable(c, geminiRequest)
+	if err != nil {
+		logger.Errorf(ctx, "unmarshal gemini request failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	textRequest, err := gemini.RequestGemini2OpenAI(geminiRequest, modelName, stream)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	converter := gemini.NewResponseConverter(modelName, c.Query("alt") == "sse")
+	return relayConvertedChatRequest(c, meta, textRequest, converter)
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channelstat"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/circuitbreaker"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// hedgeAttempt is the request sent to one of the raced channels
+type hedgeAttempt struct {
+	meta           *meta.Meta
+	adaptor        adaptor.Adaptor
+	channel        *model.Channel // nil for the channel selected by the distributor
+	keyFingerprint string
+	cancel         context.CancelFunc
+	start          time.Time
+	end            time.Time
+	resp           *http.Response
+	err            error
+}
+
+func (a *hedgeAttempt) succeeded() bool {
+	return a.err == nil && a.resp.StatusCode == http.StatusOK
+}
+
+// result returns the answer of the attempt kept, its request is cancelled once the body is closed
+func (a *hedgeAttempt) result() (*http.Response, adaptor.Adaptor, error) {
+	if a.resp == nil {
+		a.cancel()
+		return nil, a.adaptor, a.err
+	}
+	a.resp.Body = &cancelingBody{ReadCloser: a.resp.Body, cancel: a.cancel}
+	return a.resp, a.adaptor, a.err
+}
+
+// discard drops the attempt that lost the race. Its outcome is recorded as for the other requests, but an attempt
+// cancelled because the other channel answered first only tells how slow its channel is.
+func (a *hedgeAttempt) discard(modelName string) {
+	a.cancel()
+	latency := a.end.Sub(a.start)
+	switch {
+	case a.succeeded():
+		RecordChannelResult(a.meta.ChannelId, modelName, a.keyFingerprint, nil, latency, latency)
+	case errors.Is(a.err, context.Canceled):
+		// the trial of a half-open circuit is given back, the channel did not fail
+		circuitbreaker.Release(a.meta.ChannelId, modelName)
+		channelstat.Record(a.meta.ChannelId, latency, latency, true)
+	case a.err != nil:
+		RecordChannelResult(a.meta.ChannelId, modelName, a.keyFingerprint,
+			openai.ErrorWrapper(a.err, "do_request_failed", http.StatusInternalServerError), latency, latency)
+	default:
+		RecordChannelResult(a.meta.ChannelId, modelName, a.keyFingerprint, RelayErrorHandler(a.resp), latency, latency)
+	}
+	if a.resp != nil {
+		_ = a.resp.Body.Close()
+	}
+}
+
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type peekedBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func startHedgeAttempt(c *gin.Context, attempt *hedgeAttempt, requestBody []byte, results chan<- *hedgeAttempt) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attempt.cancel = cancel
+	attemptContext := c.Copy()
+	attemptContext.Request = c.Request.WithContext(ctx)
+	attempt.start = time.Now()
+	go func() {
+		attempt.resp, attempt.err = attempt.adaptor.DoRequest(attemptContext, attempt.meta, bytes.NewReader(requestBody))
+		if attempt.succeeded() && attempt.meta.IsStream {
+			// a stream answers with its first chunk, the headers may come long before it
+			reader := bufio.NewReader(attempt.resp.Body)
+			if _, err := reader.Peek(1); err != nil {
+				_ = attempt.resp.Body.Close()
+				attempt.resp, attempt.err = nil, err
+			} else {
+				attempt.resp.Body = peekedBody{Reader: reader, Closer: attempt.resp.Body}
+			}
+		}
+		attempt.end = time.Now()
+		results <- attempt
+	}()
+}
+
+// newHedgeAttempt prepares the request to the channel racing the selected one, it returns nil when there is none
+func newHedgeAttempt(c *gin.Context, meta *meta.Meta) *hedgeAttempt {
+	channel := model.GetHedgeChannel(meta.Group, c.GetString(ctxkey.OriginalModel), meta.ChannelId, meta.ChannelType, meta.ActualModelName)
+	if channel == nil {
+		return nil
+	}
+	hedgeMeta := *meta
+	hedgeMeta.ChannelId = channel.Id
+	hedgeMeta.BaseURL = channel.GetBaseURL()
+	if hedgeMeta.BaseURL == "" {
+		hedgeMeta.BaseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	key, fingerprint := channel.NextKey()
+	hedgeMeta.APIKey = key
+	hedgeMeta.Config = channel.GetConfig()
+	hedgeAdaptor := relay.GetAdaptor(hedgeMeta.APIType)
+	hedgeAdaptor.Init(&hedgeMeta)
+	return &hedgeAttempt{
+		meta:           &hedgeMeta,
+		adaptor:        hedgeAdaptor,
+		channel:        channel,
+		keyFingerprint: fingerprint,
+	}
+}
+
+// doHedgedRequest sends the request to the selected channel, and races it on a second channel when it has not
+// answered within the hedge delay of the group or the model. The first successful answer wins and the other
+// request is cancelled. The meta and the context are switched to the winning channel, which is the only one billed.
+func doHedgedRequest(c *gin.Context, meta *meta.Meta, a adaptor.Adaptor, requestBody io.Reader) (*http.Response, adaptor.Adaptor, error) {
+	delay := model.GetHedgeDelay(meta.Group, meta.OriginModelName)
+	if delay <= 0 {
+		resp, err := a.DoRequest(c, meta, requestBody)
+		return resp, a, err
+	}
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, a, err
+	}
+	results := make(chan *hedgeAttempt, 2)
+	// the meta of the losing request is still read while the meta of the winner is copied over
+	selectedMeta := *meta
+	selected := &hedgeAttempt{meta: &selectedMeta, adaptor: a, keyFingerprint: c.GetString(ctxkey.KeyFingerprint)}
+	startHedgeAttempt(c, selected, body, results)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case attempt := <-results:
+		return attempt.result()
+	case <-timer.C:
+	}
+	hedge := newHedgeAttempt(c, meta)
+	if hedge == nil {
+		return (<-results).result()
+	}
+	logger.Infof(c.Request.Context(), "channel #%d has not answered within %d ms, racing channel #%d", meta.ChannelId, delay.Milliseconds(), hedge.channel.Id)
+	startHedgeAttempt(c, hedge, body, results)
+	modelName := c.GetString(ctxkey.OriginalModel)
+	winner := <-results
+	if winner.succeeded() {
+		loser := selected
+		if winner == selected {
+			loser = hedge
+		}
+		loser.cancel()
+		go func() {
+			(<-results).discard(modelName)
+		}()
+	} else {
+		// the other request may still succeed, the error of the selected channel is kept when both fail
+		other := <-results
+		if other.succeeded() || other == selected {
+			winner, other = other, winner
+		}
+		other.discard(modelName)
+	}
+	selectedId, winnerId := meta.ChannelId, meta.ChannelId
+	if winner == hedge {
+		winnerId = hedge.channel.Id
+		*meta = *hedge.meta
+		c.Set(ctxkey.ChannelId, hedge.channel.Id)
+		c.Set(ctxkey.ChannelName, hedge.channel.Name)
+		c.Set(ctxkey.KeyFingerprint, hedge.keyFingerprint)
+	}
+	meta.Hedge = fmt.Sprintf("对冲请求：渠道 #%d 在 %d ms 内未响应，渠道 #%d 胜出", selectedId, delay.Milliseconds(), winnerId)
+	return winner.result()
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/channelstat"
+	"github.com/songquanpeng/one-api/relay/circuitbreaker"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// testChannelId gives each attempt its own channel, the circuits and the statistics are kept for the whole process
+var testChannelId = 1800
+
+func nextTestChannelId() int {
+	testChannelId++
+	return testChannelId
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecorder) Close() error {
+	b.closed = true
+	return nil
+}
+
+func newTestHedgeAttempt(channelId int, statusCode int, err error) (*hedgeAttempt, *closeRecorder, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempt := &hedgeAttempt{
+		meta:   &meta.Meta{ChannelId: channelId},
+		cancel: cancel,
+		start:  time.Now().Add(-time.Second),
+		end:    time.Now(),
+		err:    err,
+	}
+	body := &closeRecorder{Reader: strings.NewReader(`{"error":{"message":"upstream error"}}`)}
+	if err == nil {
+		attempt.resp = &http.Response{StatusCode: statusCode, Header: http.Header{}, Body: body}
+	}
+	return attempt, body, ctx
+}
+
+func TestHedgeAttemptResult(t *testing.T) {
+	// the request of the winner is cancelled once its body is closed
+	winner, body, ctx := newTestHedgeAttempt(nextTestChannelId(), http.StatusOK, nil)
+	resp, _, err := winner.result()
+	assert.NoError(t, err)
+	assert.NoError(t, ctx.Err())
+	_ = resp.Body.Close()
+	assert.True(t, body.closed)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	// without an answer there is nothing to read
+	failed, _, ctx := newTestHedgeAttempt(nextTestChannelId(), 0, errors.New("connection refused"))
+	_, _, err = failed.result()
+	assert.Error(t, err)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestHedgeAttemptDiscard(t *testing.T) {
+	common.RedisEnabled = false
+	config.CircuitBreakerFailureThreshold = 2
+	config.CircuitBreakerCooldown = 0
+	defer func() {
+		config.CircuitBreakerFailureThreshold = 5
+		config.CircuitBreakerCooldown = 60
+	}()
+
+	cases := []struct {
+		name       string
+		statusCode int
+		err        error
+		errorRate  float64
+		state      string // the state of the circuit after a failure recorded before the attempt
+	}{
+		{"succeeded", http.StatusOK, nil, 0, circuitbreaker.StateClosed},
+		{"failed", 0, errors.New("connection refused"), 1, circuitbreaker.StateHalfOpen},
+		{"error status", http.StatusInternalServerError, nil, 1, circuitbreaker.StateHalfOpen},
+		// a loser cancelled because the other channel answered first did not fail
+		{"cancelled", 0, context.Canceled, 0, circuitbreaker.StateClosed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			channelId := nextTestChannelId()
+			circuitbreaker.Report(channelId, "gpt-4o", false)
+			loser, body, ctx := newTestHedgeAttempt(channelId, c.statusCode, c.err)
+			loser.discard("gpt-4o")
+
+			assert.ErrorIs(t, ctx.Err(), context.Canceled)
+			assert.Equal(t, c.err == nil, body.closed)
+			stat, _ := channelstat.Get(channelId)
+			assert.Equal(t, 1, stat.Samples)
+			assert.Equal(t, c.errorRate, stat.ErrorRate)
+			if c.errorRate == 0 {
+				// the latency of the loser is the time it ran for
+				assert.InDelta(t, 1, stat.Latency, 0.1)
+			}
+			assert.Equal(t, c.state, circuitbreaker.GetState(channelId, "gpt-4o"))
+		})
+	}
+
+	t.Run("cancelled trial", func(t *testing.T) {
+		// the trial of the half-open circuit taken by the loser is given back
+		channelId := nextTestChannelId()
+		circuitbreaker.Report(channelId, "gpt-4o", false)
+		circuitbreaker.Report(channelId, "gpt-4o", false)
+		// the trial is held for the cooldown
+		config.CircuitBreakerCooldown = 60
+		assert.True(t, circuitbreaker.Acquire(channelId, "gpt-4o"))
+		assert.False(t, circuitbreaker.Allow(channelId, "gpt-4o"))
+		loser, _, _ := newTestHedgeAttempt(channelId, 0, context.Canceled)
+		loser.discard("gpt-4o")
+		assert.True(t, circuitbreaker.Allow(channelId, "gpt-4o"))
+	})
+}
@@ -7,9 +7,11 @@ import (
 	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/modelpattern"
 
 	"github.com/gin-gonic/gin"
 
@@ -19,8 +21,12 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/budget"
+	"github.com/songquanpeng/one-api/relay/channelstat"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/circuitbreaker"
 	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/cooldown"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -107,12 +113,16 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
+	// the upstream cost leaves out the group and batch ratios charged to the user
+	upstreamCost := int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * modelRatio * meta.Config.GetCostMultiplier()))
 	totalTokens := promptTokens + completionTokens
 	if totalTokens == 0 {
 		// in this case, must be some error happened
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
+		upstreamCost = 0
 	}
+	recordChannelTokens(meta, totalTokens)
 	quotaDelta := quota - preConsumedQuota
 	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
 	if err != nil {
@@ -123,6 +133,12 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
 	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
+	if meta.BatchId != "" {
+		logContent += fmt.Sprintf("，批处理 %s 倍率：%.2f", meta.BatchId, getBatchRatio(meta))
+	}
+	if meta.Hedge != "" {
+		logContent += "，" + meta.Hedge
+	}
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
@@ -131,6 +147,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		ModelName:         textRequest.Model,
 		TokenName:         meta.TokenName,
 		Quota:             int(quota),
+		UpstreamCost:      int(upstreamCost),
 		Content:           logContent,
 		IsStream:          meta.IsStream,
 		ElapsedTime:       helper.CalcElapsedTime(meta.StartTime),
@@ -140,15 +157,53 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
 }
 
-func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
-	if mapping == nil {
-		return modelName, false
+// recordChannelTokens counts the tokens of the request in the daily budget of the channel
+func recordChannelTokens(meta *meta.Meta, tokens int) {
+	if meta.Config.HasDailyBudget() {
+		budget.AddTokens(meta.ChannelId, meta.Config.BudgetPeriod(time.Now()), int64(tokens))
+	}
+}
+
+// RecordChannelResult feeds the outcome of a request relayed to the channel to the circuit breaker and the health
+// of the channel key, and its latency to the adaptive channel selection unless the latency is 0
+func RecordChannelResult(channelId int, modelName string, keyFingerprint string, bizErr *relaymodel.ErrorWithStatusCode, ttft time.Duration, latency time.Duration) {
+	if bizErr != nil && bizErr.StatusCode/100 == 4 && bizErr.StatusCode != http.StatusUnauthorized &&
+		bizErr.StatusCode != http.StatusForbidden && bizErr.StatusCode != http.StatusNotFound &&
+		bizErr.StatusCode != http.StatusTooManyRequests {
+		// invalid requests are not the fault of the channel, a 404 is the model missing upstream and only
+		// opens the circuit of that model
+		return
+	}
+	if IsRateLimited(channelId, bizErr) {
+		// the channel is skipped until the reset of its rate limit, it is not unhealthy
+		return
 	}
-	mappedModelName := mapping[modelName]
-	if mappedModelName != "" {
-		return mappedModelName, true
+	circuitbreaker.Report(channelId, modelName, bizErr == nil)
+	errMessage := ""
+	if bizErr != nil {
+		errMessage = bizErr.Message
 	}
-	return modelName, false
+	model.RecordChannelKeyResult(channelId, keyFingerprint, bizErr == nil, errMessage)
+	if latency > 0 {
+		channelstat.Record(channelId, ttft, latency, bizErr == nil)
+	}
+}
+
+// IsRateLimited tells whether the error is a 429 of an upstream which said when to come back
+func IsRateLimited(channelId int, err *relaymodel.ErrorWithStatusCode) bool {
+	return err != nil && err.StatusCode == http.StatusTooManyRequests && cooldown.IsCoolingDown(channelId)
+}
+
+// getBatchRatio returns the discount of the requests executed for a batch of /v1/batches
+func getBatchRatio(meta *meta.Meta) float64 {
+	if meta.BatchId == "" {
+		return 1
+	}
+	return config.BatchRatio
+}
+
+func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
+	return modelpattern.Map(modelName, mapping)
 }
 
 func isErrorHappened(meta *meta.Meta, resp *http.Response) bool {
@@ -7,7 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
@@ -17,15 +20,90 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
-func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
+func readImageFile(header *multipart.FileHeader) (*relaymodel.ImageFile, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+	return &relaymodel.ImageFile{
+		Filename:    header.Filename,
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// getImageEditRequest parses the multipart/form-data request of /v1/images/edits and /v1/images/variations
+func getImageEditRequest(c *gin.Context) (*relaymodel.ImageRequest, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	// reset request body for the channels that take it as is
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	value := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	imageRequest := &relaymodel.ImageRequest{
+		Model:          value("model"),
+		Prompt:         value("prompt"),
+		Size:           value("size"),
+		Quality:        value("quality"),
+		ResponseFormat: value("response_format"),
+		User:           value("user"),
+	}
+	if n := value("n"); n != "" {
+		if imageRequest.N, err = strconv.Atoi(n); err != nil {
+			return nil, fmt.Errorf("invalid value of n: %s", n)
+		}
+	}
+	for _, header := range append(form.File["image"], form.File["image[]"]...) {
+		image, err := readImageFile(header)
+		if err != nil {
+			return nil, err
+		}
+		imageRequest.Image = append(imageRequest.Image, image)
+	}
+	if masks := form.File["mask"]; len(masks) > 0 {
+		if imageRequest.Mask, err = readImageFile(masks[0]); err != nil {
+			return nil, err
+		}
+	}
+	return imageRequest, nil
+}
+
+func getImageRequest(c *gin.Context, relayMode int) (*relaymodel.ImageRequest, error) {
 	imageRequest := &relaymodel.ImageRequest{}
-	err := common.UnmarshalBodyReusable(c, imageRequest)
+	var err error
+	if relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations {
+		imageRequest, err = getImageEditRequest(c)
+	} else {
+		err = common.UnmarshalBodyReusable(c, imageRequest)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -66,12 +144,28 @@ func getImageSizeRatio(model string, size string) float64 {
 	return 1
 }
 
-func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
-	// check prompt length
-	if imageRequest.Prompt == "" {
+func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	// check prompt length, variations are made from the image only
+	if imageRequest.Prompt == "" && meta.Mode != relaymode.ImagesVariations {
 		return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
 	}
 
+	if meta.Mode == relaymode.ImagesEdits || meta.Mode == relaymode.ImagesVariations {
+		if len(imageRequest.Image) == 0 {
+			return openai.ErrorWrapper(errors.New("image is required"), "image_missing", http.StatusBadRequest)
+		}
+		switch meta.APIType {
+		case apitype.OpenAI, apitype.Replicate:
+		case apitype.Ali:
+			// ali edits the image from the prompt, it has no variations
+			if meta.Mode == relaymode.ImagesVariations {
+				return openai.ErrorWrapper(errors.New("image variations are not supported by ali"), "image_variations_not_supported", http.StatusBadRequest)
+			}
+		default:
+			return openai.ErrorWrapper(fmt.Errorf("image edits are not supported by channel type %d", meta.ChannelType), "image_edits_not_supported", http.StatusBadRequest)
+		}
+	}
+
 	// model validation
 	if !isValidImageSize(imageRequest.Model, imageRequest.Size) {
 		return openai.ErrorWrapper(errors.New("size not supported for this image model"), "size_not_supported", http.StatusBadRequest)
@@ -135,7 +229,16 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	c.Set("response_format", imageRequest.ResponseFormat)
 
 	var requestBody io.Reader
-	if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
+	if relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations {
+		requestBody = c.Request.Body
+		if isModelMapped {
+			_, params, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+			requestBody, err = openai.ConvertImageEditRequest(imageRequest, relayMode, params["boundary"])
+			if err != nil {
+				return openai.ErrorWrapper(err, "convert_image_request_failed", http.StatusInternalServerError)
+			}
+		}
+	} else if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
 		jsonStr, err := json.Marshal(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
@@ -173,13 +276,16 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	ratio := modelRatio * groupRatio
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
-	var quota int64
+	costRatio := modelRatio * meta.Config.GetCostMultiplier()
+	var quota, upstreamCost int64
 	switch meta.ChannelType {
 	case channeltype.Replicate:
 		// replicate always return 1 image
 		quota = int64(ratio * imageCostRatio * 1000)
+		upstreamCost = int64(costRatio * imageCostRatio * 1000)
 	default:
 		quota = int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
+		upstreamCost = int64(costRatio*imageCostRatio*1000) * int64(imageRequest.N)
 	}
 
 	if userQuota-quota < 0 {
@@ -219,6 +325,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 				ModelName:        imageRequest.Model,
 				TokenName:        tokenName,
 				Quota:            int(quota),
+				UpstreamCost:     int(upstreamCost),
 				Content:          logContent,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// newImageEditContext builds a multipart/form-data request with the values and the files given by field
+func newImageEditContext(t *testing.T, path string, values map[string]string, files map[string][]byte) *gin.Context {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range values {
+		assert.NoError(t, writer.WriteField(key, value))
+	}
+	for field, data := range files {
+		// the content type is left to the detection
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="`+field+`"; filename="`+field+`.png"`)
+		header.Set("Content-Type", "application/octet-stream")
+		part, err := writer.CreatePart(header)
+		assert.NoError(t, err)
+		_, _ = part.Write(data)
+	}
+	assert.NoError(t, writer.Close())
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+func TestGetImageEditRequest(t *testing.T) {
+	c := newImageEditContext(t, "/v1/images/edits",
+		map[string]string{"model": "dall-e-2", "prompt": "A cat wearing a hat", "n": "2", "size": "512x512", "response_format": "b64_json"},
+		map[string][]byte{"image": testPNG, "mask": testPNG})
+	imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+	assert.NoError(t, err)
+	assert.Equal(t, "dall-e-2", imageRequest.Model)
+	assert.Equal(t, "A cat wearing a hat", imageRequest.Prompt)
+	assert.Equal(t, 2, imageRequest.N)
+	assert.Equal(t, "512x512", imageRequest.Size)
+	assert.Equal(t, "b64_json", imageRequest.ResponseFormat)
+	if assert.Len(t, imageRequest.Image, 1) {
+		assert.Equal(t, "image.png", imageRequest.Image[0].Filename)
+		assert.Equal(t, "image/png", imageRequest.Image[0].ContentType)
+		assert.Equal(t, testPNG, imageRequest.Image[0].Data)
+	}
+	if assert.NotNil(t, imageRequest.Mask) {
+		assert.Equal(t, testPNG, imageRequest.Mask.Data)
+	}
+	// the body is kept for the channels that take it as is
+	body, err := io.ReadAll(c.Request.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "A cat wearing a hat")
+
+	// the images may also be sent as an array
+	c = newImageEditContext(t, "/v1/images/edits", map[string]string{"prompt": "A cat"}, map[string][]byte{"image[]": testPNG})
+	imageRequest, err = getImageRequest(c, relaymode.ImagesEdits)
+	assert.NoError(t, err)
+	assert.Len(t, imageRequest.Image, 1)
+	assert.Nil(t, imageRequest.Mask)
+
+	c = newImageEditContext(t, "/v1/images/edits", map[string]string{"prompt": "A cat", "n": "two"}, map[string][]byte{"image": testPNG})
+	_, err = getImageRequest(c, relaymode.ImagesEdits)
+	assert.Error(t, err)
+}
+
+func TestGetImageVariationRequest(t *testing.T) {
+	c := newImageEditContext(t, "/v1/images/variations", nil, map[string][]byte{"image": testPNG})
+	imageRequest, err := getImageRequest(c, relaymode.ImagesVariations)
+	assert.NoError(t, err)
+	// the defaults of the generations apply
+	assert.Equal(t, "dall-e-2", imageRequest.Model)
+	assert.Equal(t, 1, imageRequest.N)
+	assert.Equal(t, "1024x1024", imageRequest.Size)
+	assert.Empty(t, imageRequest.Prompt)
+	assert.Len(t, imageRequest.Image, 1)
+
+	// variations need no prompt but an image, and are not made by every channel
+	assert.Nil(t, validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesVariations, APIType: apitype.OpenAI}))
+	imageRequest.Image = nil
+	if err := validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesVariations, APIType: apitype.OpenAI}); assert.NotNil(t, err) {
+		assert.Equal(t, "image_missing", err.Error.Code)
+	}
+	c = newImageEditContext(t, "/v1/images/variations", nil, map[string][]byte{"image": testPNG})
+	imageRequest, err = getImageRequest(c, relaymode.ImagesVariations)
+	assert.NoError(t, err)
+	if err := validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesVariations, APIType: apitype.Ali}); assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.StatusCode)
+		assert.Equal(t, "image_variations_not_supported", err.Error.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayOllamaHelper serves the Ollama chat and generate API on top of the chat completion relay,
+// so that the tools built for a local Ollama can use channels of any type.
+func RelayOllamaHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	var textRequest *relaymodel.GeneralOpenAIRequest
+	generate := strings.HasPrefix(c.Request.URL.Path, "/api/generate")
+	if generate {
+		generateRequest := &ollama.GenerateRequest{}
+		if err := common.UnmarshalBodyReusable(c, generateRequest); err != nil {
+			logger.Errorf(ctx, "unmarshal ollama request failed: %s", err.Error())
+			return openai.ErrorWrapper(err, "invalid_ollama_request", http.StatusBadRequest)
+		}
+		textRequest = ollama.RequestGenerate2OpenAI(generateRequest)
+	} else {
+		chatRequest := &ollama.ChatRequest{}
+		if err := common.UnmarshalBodyReusable(c, chatRequest); err != nil {
+			logger.Errorf(ctx, "unmarshal ollama request failed: %s", err.Error())
+			return openai.ErrorWrapper(err, "invalid_ollama_request", http.StatusBadRequest)
+		}
+		// ChatRequest.Stream is not a pointer, ollama streams when the field is absent
+		var streamRequest struct {
+			Stream *bool `json:"stream"`
+		}
+		_ = common.UnmarshalBodyReusable(c, &streamRequest)
+		textRequest = ollama.RequestChat2OpenAI(chatRequest, streamRequest.Stream == nil || *streamRequest.Stream)
+	}
+	converter := ollama.NewResponseConverter(textRequest.Model, generate)
+	return relayConvertedChatRequest(c, meta, textRequest, converter)
+}
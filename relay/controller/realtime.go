@@ -0,0 +1,336 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/budget"
+	"github.com/songquanpeng/one-api/relay/cooldown"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// the key of the browser clients is sent as a subprotocol, it is never forwarded to the upstream
+const realtimeKeyProtocolPrefix = "openai-insecure-api-key."
+
+var realtimeUpgrader = websocket.Upgrader{
+	CheckOrigin: network.IsOriginAllowed,
+}
+
+// realtimeSession pipes the frames of a realtime session and bills every response.done event
+type realtimeSession struct {
+	ctx      context.Context
+	meta     *meta.Meta
+	client   *websocket.Conn
+	upstream *websocket.Conn
+
+	modelRatio           float64
+	groupRatio           float64
+	completionRatio      float64
+	audioRatio           float64
+	audioCompletionRatio float64
+
+	responses         int
+	quota             int64
+	upstreamCost      int64
+	inputTokens       int
+	outputTokens      int
+	inputAudioTokens  int
+	outputAudioTokens int
+}
+
+func getRealtimeSubprotocols(r *http.Request) []string {
+	var protocols []string
+	for _, protocol := range websocket.Subprotocols(r) {
+		if !strings.HasPrefix(protocol, realtimeKeyProtocolPrefix) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+func RelayRealtimeHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return openai.ErrorWrapper(errors.New("the realtime api requires a websocket connection"), "websocket_required", http.StatusBadRequest)
+	}
+	if meta.APIType != apitype.OpenAI {
+		return openai.ErrorWrapper(fmt.Errorf("realtime is not supported by channel type %d", meta.ChannelType), "realtime_not_supported", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = c.Query("model")
+	meta.ActualModelName, _ = getMappedModelName(meta.OriginModelName, meta.ModelMapping)
+
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	a.Init(meta)
+	fullRequestURL, err := a.GetRequestURL(meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+	req, err := http.NewRequest(http.MethodGet, fullRequestURL, nil)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	if beta := c.Request.Header.Get("OpenAI-Beta"); beta != "" {
+		req.Header.Set("OpenAI-Beta", beta)
+	}
+	err = a.SetupRequestHeader(c, req, meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	header := http.Header{}
+	for k, v := range req.Header {
+		if len(v) > 0 && v[0] != "" {
+			header[k] = v
+		}
+	}
+
+	// connect to the upstream first, so that the failures can still be retried on another channel
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 30 * time.Second,
+		Subprotocols:     getRealtimeSubprotocols(c.Request),
+	}
+	// the slot of the channel is held for the whole session
+	release, err := adaptor.AcquireChannelSlot(c, meta)
+	if err != nil {
+		return openai.ErrorWrapper(fmt.Errorf("acquire channel slot failed: %w", err), "do_request_failed", http.StatusInternalServerError)
+	}
+	defer release()
+	if meta.Config.HasDailyBudget() {
+		budget.AddRequest(meta.ChannelId, meta.Config.BudgetPeriod(time.Now()))
+	}
+	upstream, resp, err := dialer.DialContext(ctx, fullRequestURL, header)
+	if resp != nil {
+		cooldown.RecordResponse(meta.ChannelId, resp)
+	}
+	if err != nil {
+		logger.Errorf(ctx, "dial realtime upstream failed: %s", err.Error())
+		if resp != nil {
+			return RelayErrorHandler(resp)
+		}
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	var responseHeader http.Header
+	if protocol := upstream.Subprotocol(); protocol != "" {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {protocol}}
+	}
+	client, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, responseHeader)
+	if err != nil {
+		// the upgrader has replied to the client already
+		logger.Errorf(ctx, "upgrade realtime connection failed: %s", err.Error())
+		_ = upstream.Close()
+		return nil
+	}
+
+	session := &realtimeSession{
+		ctx:                  ctx,
+		meta:                 meta,
+		client:               client,
+		upstream:             upstream,
+		modelRatio:           billingratio.GetModelRatio(meta.ActualModelName, meta.ChannelType),
+		groupRatio:           billingratio.GetGroupRatio(meta.Group),
+		completionRatio:      billingratio.GetCompletionRatio(meta.ActualModelName, meta.ChannelType),
+		audioRatio:           billingratio.GetAudioRatio(meta.ActualModelName),
+		audioCompletionRatio: billingratio.GetAudioCompletionRatio(meta.ActualModelName),
+	}
+	session.run()
+	return nil
+}
+
+// forwardClose passes the close frame received from one side to the other one
+func forwardClose(conn *websocket.Conn, err error) {
+	code, text := websocket.CloseNormalClosure, ""
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		code, text = closeErr.Code, closeErr.Text
+	}
+	if code == websocket.CloseNoStatusReceived || code == websocket.CloseAbnormalClosure {
+		code = websocket.CloseNormalClosure
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
+
+func (s *realtimeSession) run() {
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		for {
+			messageType, data, err := s.client.ReadMessage()
+			if err != nil {
+				forwardClose(s.upstream, err)
+				_ = s.upstream.Close()
+				return
+			}
+			if err = s.upstream.WriteMessage(messageType, data); err != nil {
+				_ = s.client.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := s.upstream.ReadMessage()
+		if err != nil {
+			forwardClose(s.client, err)
+			break
+		}
+		exhausted := false
+		if messageType == websocket.TextMessage {
+			exhausted = s.handleEvent(data)
+		}
+		if err = s.client.WriteMessage(messageType, data); err != nil {
+			break
+		}
+		if exhausted {
+			logger.Warnf(s.ctx, "quota of token #%d is exhausted, closing the realtime session", s.meta.TokenId)
+			s.sendQuotaError()
+			break
+		}
+	}
+	_ = s.client.Close()
+	_ = s.upstream.Close()
+	<-clientDone
+	s.recordConsumeLog()
+}
+
+// handleEvent bills the response.done events, it returns true once the quota is exhausted
+func (s *realtimeSession) handleEvent(data []byte) bool {
+	if !strings.Contains(string(data), `"response.done"`) {
+		return false
+	}
+	var event openai.RealtimeEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		logger.Errorf(s.ctx, "unmarshal realtime event failed: %s", err.Error())
+		return false
+	}
+	if event.Type != "response.done" || event.Response == nil || event.Response.Usage == nil {
+		return false
+	}
+	return s.consume(event.Response.Usage)
+}
+
+func (s *realtimeSession) consume(usage *openai.RealtimeUsage) bool {
+	textInput, audioInput := usage.InputTokenDetails.TextTokens, usage.InputTokenDetails.AudioTokens
+	if textInput+audioInput == 0 {
+		textInput = usage.InputTokens
+	}
+	textOutput, audioOutput := usage.OutputTokenDetails.TextTokens, usage.OutputTokenDetails.AudioTokens
+	if textOutput+audioOutput == 0 {
+		textOutput = usage.OutputTokens
+	}
+	tokens := float64(textInput) +
+		float64(audioInput)*s.audioRatio +
+		float64(textOutput)*s.completionRatio +
+		float64(audioOutput)*s.audioRatio*s.audioCompletionRatio
+	ratio := s.modelRatio * s.groupRatio
+	quota := int64(math.Ceil(tokens * ratio))
+	if ratio != 0 && tokens != 0 && quota <= 0 {
+		quota = 1
+	}
+
+	s.responses++
+	s.quota += quota
+	recordChannelTokens(s.meta, usage.InputTokens+usage.OutputTokens)
+	s.upstreamCost += int64(math.Ceil(tokens * s.modelRatio * s.meta.Config.GetCostMultiplier()))
+	s.inputTokens += usage.InputTokens
+	s.outputTokens += usage.OutputTokens
+	s.inputAudioTokens += audioInput
+	s.outputAudioTokens += audioOutput
+
+	err := model.PostConsumeTokenQuota(s.meta.TokenId, quota)
+	if err != nil {
+		logger.Error(s.ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(s.ctx, s.meta.UserId)
+	if err != nil {
+		logger.Error(s.ctx, "error update user quota cache: "+err.Error())
+	}
+	return s.isQuotaExhausted()
+}
+
+func (s *realtimeSession) isQuotaExhausted() bool {
+	token, err := model.GetTokenById(s.meta.TokenId)
+	if err != nil {
+		logger.Error(s.ctx, "error getting token: "+err.Error())
+		return false
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		return true
+	}
+	userQuota, err := model.GetUserQuota(s.meta.UserId)
+	if err != nil {
+		logger.Error(s.ctx, "error getting user quota: "+err.Error())
+		return false
+	}
+	return userQuota <= 0
+}
+
+func (s *realtimeSession) sendQuotaError() {
+	event := gin.H{
+		"type": "error",
+		"error": relaymodel.Error{
+			Message: "token quota is exhausted",
+			Type:    "insufficient_quota",
+			Code:    "insufficient_quota",
+		},
+	}
+	_ = s.client.WriteJSON(event)
+	_ = s.client.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "quota exhausted"), time.Now().Add(time.Second))
+}
+
+func (s *realtimeSession) recordConsumeLog() {
+	if s.responses == 0 {
+		return
+	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f，音频倍率：%.2f × %.2f，音频输入 %d，音频输出 %d，响应数：%d",
+		s.modelRatio, s.groupRatio, s.completionRatio, s.audioRatio, s.audioCompletionRatio,
+		s.inputAudioTokens, s.outputAudioTokens, s.responses)
+	model.RecordConsumeLog(s.ctx, &model.Log{
+		UserId:           s.meta.UserId,
+		ChannelId:        s.meta.ChannelId,
+		PromptTokens:     s.inputTokens,
+		CompletionTokens: s.outputTokens,
+		ModelName:        s.meta.ActualModelName,
+		TokenName:        s.meta.TokenName,
+		Quota:            int(s.quota),
+		UpstreamCost:     int(s.upstreamCost),
+		Content:          logContent,
+		IsStream:         true,
+		ElapsedTime:      helper.CalcElapsedTime(s.meta.StartTime),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(s.meta.UserId, s.quota)
+	model.UpdateChannelUsedQuota(s.meta.ChannelId, s.quota)
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// a search unit is a query with up to 100 documents
+const rerankDocumentsPerSearchUnit = 100
+
+func getRerankRequest(c *gin.Context) (*relaymodel.RerankRequest, error) {
+	rerankRequest := &relaymodel.RerankRequest{}
+	err := common.UnmarshalBodyReusable(c, rerankRequest)
+	if err != nil {
+		return nil, err
+	}
+	return rerankRequest, nil
+}
+
+func validateRerankRequest(rerankRequest *relaymodel.RerankRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	if rerankRequest.Query == "" {
+		return openai.ErrorWrapper(errors.New("query is required"), "query_missing", http.StatusBadRequest)
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return openai.ErrorWrapper(errors.New("documents is required"), "documents_missing", http.StatusBadRequest)
+	}
+	if rerankRequest.TopN < 0 {
+		return openai.ErrorWrapper(errors.New("top_n must not be negative"), "invalid_top_n", http.StatusBadRequest)
+	}
+	switch {
+	case meta.APIType == apitype.Cohere:
+	case meta.APIType == apitype.OpenAI && meta.ChannelType != channeltype.Azure:
+	default:
+		return openai.ErrorWrapper(fmt.Errorf("rerank is not supported by channel type %d", meta.ChannelType), "rerank_not_supported", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// getRerankPromptTokens counts the tokens of the query and of every document
+func getRerankPromptTokens(rerankRequest *relaymodel.RerankRequest) int {
+	promptTokens := openai.CountTokenText(rerankRequest.Query, rerankRequest.Model)
+	for _, text := range rerankRequest.DocumentTexts() {
+		promptTokens += openai.CountTokenText(text, rerankRequest.Model)
+	}
+	return promptTokens
+}
+
+func getRerankSearchUnits(rerankRequest *relaymodel.RerankRequest) int {
+	searchUnits := (len(rerankRequest.Documents) + rerankDocumentsPerSearchUnit - 1) / rerankDocumentsPerSearchUnit
+	if searchUnits < 1 {
+		searchUnits = 1
+	}
+	return searchUnits
+}
+
+// getRerankQuota bills the models listed in RerankRatio per search unit and the others per document token
+func getRerankQuota(rerankRequest *relaymodel.RerankRequest, promptTokens int, searchUnits int, groupRatio float64, channelType int) (quota int64, modelRatio float64, billedBySearchUnit bool) {
+	modelRatio, billedBySearchUnit = billingratio.GetRerankRatio(rerankRequest.Model)
+	if billedBySearchUnit {
+		quota = int64(math.Ceil(float64(searchUnits) * modelRatio * groupRatio * 1000))
+		return
+	}
+	modelRatio = billingratio.GetModelRatio(rerankRequest.Model, channelType)
+	ratio := modelRatio * groupRatio
+	quota = int64(math.Ceil(float64(promptTokens) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return
+}
+
+func getRerankRequestBody(c *gin.Context, meta *meta.Meta, rerankRequest *relaymodel.RerankRequest, isModelMapped bool, a adaptor.Adaptor) (io.Reader, error) {
+	rerankAdaptor, ok := a.(adaptor.RerankAdaptor)
+	if !ok || (meta.APIType == apitype.OpenAI && meta.ChannelType != channeltype.SiliconFlow && !isModelMapped) {
+		// openai compatible channels take the request as is
+		return c.Request.Body, nil
+	}
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, rerankRequest)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
+	return bytes.NewBuffer(jsonData), nil
+}
+
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	rerankRequest, err := getRerankRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getRerankRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	var isModelMapped bool
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model, isModelMapped = getMappedModelName(rerankRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = rerankRequest.Model
+
+	bizErr := validateRerankRequest(rerankRequest, meta)
+	if bizErr != nil {
+		return bizErr
+	}
+
+	meta.PromptTokens = getRerankPromptTokens(rerankRequest)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	estimatedQuota, _, _ := getRerankQuota(rerankRequest, meta.PromptTokens, getRerankSearchUnits(rerankRequest), groupRatio, meta.ChannelType)
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-estimatedQuota < 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	requestBody, err := getRerankRequestBody(c, meta, rerankRequest, isModelMapped, adaptor)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+
+	// do request
+	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+
+	// do response
+	usage, _, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return respErr
+	}
+
+	// the search units billed by the upstream take precedence over the estimation
+	searchUnits := c.GetInt(ctxkey.RerankSearchUnits)
+	if searchUnits == 0 {
+		searchUnits = getRerankSearchUnits(rerankRequest)
+	}
+	promptTokens := meta.PromptTokens
+	if usage != nil && usage.PromptTokens != 0 {
+		promptTokens = usage.PromptTokens
+	}
+	quota, modelRatio, billedBySearchUnit := getRerankQuota(rerankRequest, promptTokens, searchUnits, groupRatio, meta.ChannelType)
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
+	if billedBySearchUnit {
+		promptTokens = 0
+		logContent = fmt.Sprintf("搜索单元：%d，%s", searchUnits, logContent)
+	}
+	// the upstream is billed at the cost multiplier of the channel instead of the group ratio
+	upstreamCost, _, _ := getRerankQuota(rerankRequest, promptTokens, searchUnits, meta.Config.GetCostMultiplier(), meta.ChannelType)
+	go postConsumeRerankQuota(ctx, meta, rerankRequest.Model, quota, upstreamCost, promptTokens, logContent)
+	return nil
+}
+
+func postConsumeRerankQuota(ctx context.Context, meta *meta.Meta, modelName string, quota int64, upstreamCost int64, promptTokens int, logContent string) {
+	recordChannelTokens(meta, promptTokens)
+	err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	model.RecordConsumeLog(ctx, &model.Log{
+		UserId:       meta.UserId,
+		ChannelId:    meta.ChannelId,
+		PromptTokens: promptTokens,
+		ModelName:    modelName,
+		TokenName:    meta.TokenName,
+		Quota:        int(quota),
+		UpstreamCost: int(upstreamCost),
+		Content:      logContent,
+		ElapsedTime:  helper.CalcElapsedTime(meta.StartTime),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// ResponseConverter renders the OpenAI chat completion output of an adaptor
+// in the wire format of an inbound API, e.g. Claude Messages.
+type ResponseConverter interface {
+	ContentType(stream bool) string
+	ConvertStreamChunk(w io.Writer, chunk *openai.ChatCompletionsStreamResponse) error
+	ConvertStreamEnd(w io.Writer, usage *relaymodel.Usage) error
+	ConvertResponse(w io.Writer, response *openai.TextResponse) error
+}
+
+// convertingResponseWriter sits between the adaptor and the client. Adaptors keep
+// writing OpenAI responses, which are parsed here and handed to the converter.
+type convertingResponseWriter struct {
+	gin.ResponseWriter
+	converter     ResponseConverter
+	stream        bool
+	status        int
+	buffer        bytes.Buffer
+	headerWritten bool
+	streamEnded   bool
+}
+
+func newConvertingResponseWriter(w gin.ResponseWriter, converter ResponseConverter, stream bool) *convertingResponseWriter {
+	return &convertingResponseWriter{
+		ResponseWriter: w,
+		converter:      converter,
+		stream:         stream,
+		status:         http.StatusOK,
+	}
+}
+
+func (w *convertingResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *convertingResponseWriter) WriteHeaderNow() {}
+
+func (w *convertingResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.stream {
+		w.drainStream()
+	}
+	return len(data), nil
+}
+
+func (w *convertingResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *convertingResponseWriter) Flush() {
+	if w.headerWritten {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *convertingResponseWriter) writeHeader() {
+	if w.headerWritten {
+		return
+	}
+	w.headerWritten = true
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", w.converter.ContentType(w.stream))
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *convertingResponseWriter) drainStream() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// incomplete line, keep it for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		w.handleStreamLine(strings.TrimSpace(line))
+	}
+}
+
+func (w *convertingResponseWriter) handleStreamLine(line string) {
+	if w.streamEnded || !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || strings.HasPrefix(data, "[DONE]") {
+		return
+	}
+	var chunk openai.ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.SysError("error unmarshalling stream chunk for conversion: " + err.Error())
+		return
+	}
+	w.writeHeader()
+	if err := w.converter.ConvertStreamChunk(w.ResponseWriter, &chunk); err != nil {
+		logger.SysError("error converting stream chunk: " + err.Error())
+	}
+}
+
+// Finish renders whatever the adaptor left in the buffer. usage is the usage
+// billed for this request, nil when the relay failed.
+func (w *convertingResponseWriter) Finish(usage *relaymodel.Usage) {
+	if w.stream {
+		w.handleStreamLine(strings.TrimSpace(w.buffer.String()))
+		w.buffer.Reset()
+		if !w.headerWritten && usage == nil {
+			// nothing was streamed, the error will be rendered by the caller
+			return
+		}
+		w.writeHeader()
+		if !w.streamEnded {
+			w.streamEnded = true
+			if err := w.converter.ConvertStreamEnd(w.ResponseWriter, usage); err != nil {
+				logger.SysError("error converting stream end: " + err.Error())
+			}
+		}
+		w.ResponseWriter.Flush()
+		return
+	}
+	if w.buffer.Len() == 0 {
+		return
+	}
+	var response openai.TextResponse
+	if w.status/100 != 2 || json.Unmarshal(w.buffer.Bytes(), &response) != nil {
+		// not a chat completion, pass it through untouched
+		w.ResponseWriter.WriteHeader(w.status)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	w.writeHeader()
+	if err := w.converter.ConvertResponse(w.ResponseWriter, &response); err != nil {
+		logger.SysError("error converting response: " + err.Error())
+	}
+}
+
+// relayConvertedChatRequest relays a chat completion request that was converted from
+// another inbound API, and renders the response through converter.
+func relayConvertedChatRequest(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, converter ResponseConverter) *relaymodel.ErrorWithStatusCode {
+	if err := validator.ValidateTextRequest(textRequest, relaymode.ChatCompletions); err != nil {
+		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+	}
+	meta.Mode = relaymode.ChatCompletions
+	meta.RequestURLPath = "/v1/chat/completions"
+	// channels that take the request body as is must receive the converted request
+	jsonData, err := json.Marshal(textRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	writer := newConvertingResponseWriter(c.Writer, converter, textRequest.Stream)
+	c.Writer = writer
+	usage, bizErr := relayTextRequest(c, meta, textRequest)
+	writer.Finish(usage)
+	c.Writer = writer.ResponseWriter
+	return bizErr
+}
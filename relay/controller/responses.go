@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayResponsesHelper serves the OpenAI Responses API. Requests are passed through to OpenAI and Azure
+// channels and translated to chat completions for the others. Responses are stored so that
+// previous_response_id works whichever channel served the previous turn.
+func RelayResponsesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	responsesRequest := &openai.ResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err != nil {
+		logger.Errorf(ctx, "unmarshal responses request failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	passthrough := isResponsesPassthrough(meta)
+
+	var chain []*model.ResponseRecord
+	if responsesRequest.PreviousResponseId != "" {
+		chain, err = model.GetResponseRecordChain(responsesRequest.PreviousResponseId, meta.UserId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the upstream may still know about responses that were not created through us
+			if !passthrough {
+				return openai.ErrorWrapper(fmt.Errorf("previous response with id '%s' not found", responsesRequest.PreviousResponseId), "previous_response_not_found", http.StatusNotFound)
+			}
+		} else if err != nil {
+			return openai.ErrorWrapper(err, "get_previous_response_failed", http.StatusInternalServerError)
+		}
+	}
+	history, err := getResponseChainMessages(chain)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_previous_response_failed", http.StatusInternalServerError)
+	}
+	textRequest, err := openai.RequestResponses2OpenAI(responsesRequest, history)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+
+	if passthrough {
+		return relayResponsesPassthrough(c, meta, responsesRequest, textRequest, chain, history)
+	}
+	converter := openai.NewResponsesConverter("resp_"+random.GetUUID(), responsesRequest)
+	bizErr := relayConvertedChatRequest(c, meta, textRequest, converter)
+	if bizErr != nil {
+		return bizErr
+	}
+	saveResponseRecord(ctx, meta, responsesRequest, converter.Response(), false)
+	return nil
+}
+
+func isResponsesPassthrough(meta *meta.Meta) bool {
+	return meta.ChannelType == channeltype.OpenAI || meta.ChannelType == channeltype.Azure
+}
+
+func getResponseChainMessages(chain []*model.ResponseRecord) ([]relaymodel.Message, error) {
+	var messages []relaymodel.Message
+	for _, record := range chain {
+		for _, data := range []string{record.Input, record.Output} {
+			if data == "" {
+				continue
+			}
+			var turn []relaymodel.Message
+			if err := json.Unmarshal([]byte(data), &turn); err != nil {
+				return nil, fmt.Errorf("invalid response record %s: %w", record.Id, err)
+			}
+			messages = append(messages, turn...)
+		}
+	}
+	return messages, nil
+}
+
+// isChainStoredUpstream tells whether the upstream of the channel holds every response of the chain
+func isChainStoredUpstream(chain []*model.ResponseRecord, channelId int) bool {
+	for _, record := range chain {
+		if !record.Passthrough || record.ChannelId != channelId {
+			return false
+		}
+	}
+	return true
+}
+
+func getResponsesRequestBody(c *gin.Context, meta *meta.Meta, chain []*model.ResponseRecord, history []relaymodel.Message) ([]byte, bool, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, false, err
+	}
+	body := make(map[string]any)
+	if err = json.Unmarshal(requestBody, &body); err != nil {
+		return nil, false, err
+	}
+	body["model"] = meta.ActualModelName
+	systemPromptReset := false
+	if meta.ForcedSystemPrompt != "" {
+		body["instructions"] = meta.ForcedSystemPrompt
+		systemPromptReset = true
+	}
+	if len(chain) > 0 && !isChainStoredUpstream(chain, meta.ChannelId) {
+		// replay the conversation to an upstream that did not serve all of it
+		delete(body, "previous_response_id")
+		items := openai.MessagesToResponsesInput(history)
+		switch input := body["input"].(type) {
+		case string:
+			items = append(items, map[string]any{"type": "message", "role": "user", "content": input})
+		case []any:
+			items = append(items, input...)
+		}
+		body["input"] = items
+	}
+	jsonData, err := json.Marshal(body)
+	return jsonData, systemPromptReset, err
+}
+
+func relayResponsesPassthrough(c *gin.Context, meta *meta.Meta, responsesRequest *openai.ResponsesRequest, textRequest *relaymodel.GeneralOpenAIRequest, chain []*model.ResponseRecord, history []relaymodel.Message) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	if err := validator.ValidateTextRequest(textRequest, relaymode.ChatCompletions); err != nil {
+		return openai.ErrorWrapper(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	meta.IsStream = responsesRequest.Stream
+	meta.OriginModelName = responsesRequest.Model
+	meta.ActualModelName, _ = getMappedModelName(responsesRequest.Model, meta.ModelMapping)
+	textRequest.Model = meta.ActualModelName
+
+	requestBody, systemPromptReset, err := getResponsesRequestBody(c, meta, chain, history)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	// get model ratio & group ratio
+	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	// pre-consume quota
+	promptTokens := getPromptTokens(textRequest, relaymode.ChatCompletions)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(requestBody))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+
+	var response *openai.ResponsesResponse
+	var respErr *relaymodel.ErrorWithStatusCode
+	if meta.IsStream {
+		respErr, response = openai.ResponsesStreamHandler(c, resp)
+	} else {
+		respErr, response = openai.ResponsesHandler(c, resp)
+	}
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+	var usage *relaymodel.Usage
+	if response != nil {
+		usage = openai.ResponsesUsage2Usage(response.Usage)
+	}
+	if usage == nil || usage.TotalTokens == 0 {
+		responseText := ""
+		if response != nil {
+			responseText = openai.ResponsesOutputText(response)
+		}
+		usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, promptTokens)
+	}
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	if response != nil && response.Id != "" {
+		saveResponseRecord(ctx, meta, responsesRequest, response, true)
+	}
+	return nil
+}
+
+func saveResponseRecord(ctx context.Context, meta *meta.Meta, responsesRequest *openai.ResponsesRequest, response *openai.ResponsesResponse, passthrough bool) {
+	if responsesRequest.Store != nil && !*responsesRequest.Store {
+		return
+	}
+	input, err := openai.ResponsesInputToMessages(responsesRequest.Input)
+	if err != nil {
+		logger.Errorf(ctx, "convert responses input failed: %s", err.Error())
+		return
+	}
+	inputJson, _ := json.Marshal(input)
+	outputJson, _ := json.Marshal(openai.ResponsesOutputToMessages(response.Output))
+	responseJson, _ := json.Marshal(response)
+	record := &model.ResponseRecord{
+		Id:                 response.Id,
+		UserId:             meta.UserId,
+		TokenId:            meta.TokenId,
+		ChannelId:          meta.ChannelId,
+		PreviousResponseId: responsesRequest.PreviousResponseId,
+		Model:              responsesRequest.Model,
+		Passthrough:        passthrough,
+		Input:              string(inputJson),
+		Output:             string(outputJson),
+		Response:           string(responseJson),
+	}
+	if response.Usage != nil {
+		record.PromptTokens = response.Usage.InputTokens
+		record.CompletionTokens = response.Usage.OutputTokens
+	}
+	if err = record.Insert(); err != nil {
+		logger.Errorf(ctx, "save response record failed: %s", err.Error())
+	}
+}
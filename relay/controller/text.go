@@ -36,6 +36,14 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		logger.Errorf(ctx, "getAndValidateTextRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
 	}
+	_, bizErr := relayTextRequest(c, meta, textRequest)
+	return bizErr
+}
+
+// relayTextRequest relays a parsed OpenAI text request to the selected channel and bills it.
+// It is shared by the inbound APIs that are converted to chat completions.
+func relayTextRequest(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
 	meta.IsStream = textRequest.Stream
 
 	// map model name
@@ -43,6 +51,20 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	textRequest.Model, _ = getMappedModelName(textRequest.Model, meta.ModelMapping)
 	meta.ActualModelName = textRequest.Model
 
+	// inline the files uploaded through /v1/files
+	filesResolved, err := resolveFileContent(meta, textRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_file_reference", http.StatusBadRequest)
+	}
+	if filesResolved {
+		// channels that take the request body as is must receive the inline data as well
+		jsonData, err := json.Marshal(textRequest)
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	}
+
 	// 创建聊天记录服务
 	chatService := model.NewChatRecordService(
 		meta.UserId,
@@ -85,37 +107,38 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// get model ratio & group ratio
 	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
-	ratio := modelRatio * groupRatio
+	ratio := modelRatio * groupRatio * getBatchRatio(meta)
 	// pre-consume quota
 	promptTokens := getPromptTokens(textRequest, meta.Mode)
 	meta.PromptTokens = promptTokens
 	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
 	if bizErr != nil {
 		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
-		return bizErr
+		return nil, bizErr
 	}
 
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
-		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+		return nil, openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(meta)
 
 	// get request body
 	requestBody, err := getRequestBody(c, meta, textRequest, adaptor)
 	if err != nil {
-		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
 	// do request
-	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	var resp *http.Response
+	resp, adaptor, err = doHedgedRequest(c, meta, adaptor, requestBody)
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
-		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 	if isErrorHappened(meta, resp) {
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
-		return RelayErrorHandler(resp)
+		return nil, RelayErrorHandler(resp)
 	}
 
 	// do response
@@ -133,7 +156,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 			model.SaveChatRecordAsync(chatService, "", model.ChatRoleAssistant, int(usage.PromptTokens), int(usage.CompletionTokens), int(usage.TotalTokens), model.ChatRecordStatusFailed, errorMsg)
 		}
 
-		return respErr
+		return nil, respErr
 	}
 
 	// 保存成功的助手回复到聊天记录
@@ -144,7 +167,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 
 	// post-consume quota
 	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
-	return nil
+	return usage, nil
 }
 
 func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
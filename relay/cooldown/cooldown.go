@@ -0,0 +1,129 @@
+package cooldown
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+// A channel whose upstream said it is rate limited, through a 429 with Retry-After or through
+// x-ratelimit-remaining-* falling to 0, cools down until the reset time and gets no request meanwhile.
+
+// MaxCooldown caps the reset times, some upstreams report those of daily quotas
+const MaxCooldown = 10 * time.Minute
+
+type store interface {
+	get(channelId int) time.Time
+	set(channelId int, until time.Time)
+}
+
+var localStore = newMemoryStore()
+
+func getStore() store {
+	if common.RedisEnabled {
+		return redisStore{}
+	}
+	return localStore
+}
+
+// IsCoolingDown tells whether the channel should be skipped because of its rate limit
+func IsCoolingDown(channelId int) bool {
+	return time.Now().Before(getStore().get(channelId))
+}
+
+// Until returns the end of the cooldown of the channel, which is in the past when it is not cooling down
+func Until(channelId int) time.Time {
+	return getStore().get(channelId)
+}
+
+// Start makes the channel cool down for the duration
+func Start(channelId int, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	if duration > MaxCooldown {
+		duration = MaxCooldown
+	}
+	until := time.Now().Add(duration)
+	if until.After(getStore().get(channelId)) {
+		getStore().set(channelId, until)
+	}
+}
+
+// RecordResponse starts the cooldown of the channel when the headers of the response ask for it
+func RecordResponse(channelId int, resp *http.Response) {
+	if duration, ok := FromResponse(resp); ok {
+		Start(channelId, duration)
+	}
+}
+
+// FromResponse returns how long the upstream asks to wait before the next request
+func FromResponse(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if duration, ok := parseMilliseconds(header.Get("retry-after-ms")); ok {
+			return duration, true
+		}
+		if duration, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			return duration, true
+		}
+	}
+	// the limit of requests or tokens is used up until its reset
+	var cooldown time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		if strings.TrimSpace(header.Get("x-ratelimit-remaining-"+limit)) != "0" {
+			continue
+		}
+		if duration, ok := parseReset(header.Get("x-ratelimit-reset-" + limit)); ok && duration > cooldown {
+			cooldown = duration
+		}
+	}
+	return cooldown, cooldown > 0
+}
+
+func parseMilliseconds(value string) (time.Duration, bool) {
+	milliseconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || milliseconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(milliseconds * float64(time.Millisecond)), true
+}
+
+// parseRetryAfter reads the seconds or the http date of Retry-After
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), seconds > 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		duration := time.Until(date)
+		return duration, duration > 0
+	}
+	return 0, false
+}
+
+// parseReset reads the resets of x-ratelimit-reset-*, which are durations such as 6m0s or 20ms,
+// seconds, or RFC 3339 times
+func parseReset(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration, duration > 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), seconds > 0
+	}
+	if reset, err := time.Parse(time.RFC3339, value); err == nil {
+		duration := time.Until(reset)
+		return duration, duration > 0
+	}
+	return 0, false
+}
@@ -0,0 +1,59 @@
+package cooldown
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func newResponse(statusCode int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: statusCode, Header: make(http.Header)}
+	for key, value := range headers {
+		resp.Header.Set(key, value)
+	}
+	return resp
+}
+
+func TestFromResponse(t *testing.T) {
+	duration, ok := FromResponse(newResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "20"}))
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Second, duration)
+
+	duration, ok = FromResponse(newResponse(http.StatusTooManyRequests, map[string]string{"retry-after-ms": "1500", "Retry-After": "2"}))
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, duration)
+
+	duration, ok = FromResponse(newResponse(http.StatusOK, map[string]string{
+		"x-ratelimit-remaining-requests": "0",
+		"x-ratelimit-reset-requests":     "6m0s",
+		"x-ratelimit-remaining-tokens":   "0",
+		"x-ratelimit-reset-tokens":       "20ms",
+	}))
+	assert.True(t, ok)
+	assert.Equal(t, 6*time.Minute, duration)
+
+	// the limits that are not used up don't matter, nor does Retry-After on a success
+	_, ok = FromResponse(newResponse(http.StatusOK, map[string]string{
+		"x-ratelimit-remaining-requests": "12",
+		"x-ratelimit-reset-requests":     "1s",
+		"Retry-After":                    "5",
+	}))
+	assert.False(t, ok)
+}
+
+func TestCooldown(t *testing.T) {
+	common.RedisEnabled = false
+	assert.False(t, IsCoolingDown(1))
+	Start(1, time.Minute)
+	assert.True(t, IsCoolingDown(1))
+	assert.False(t, IsCoolingDown(2))
+	// a shorter cooldown doesn't cut the running one
+	Start(1, time.Millisecond)
+	assert.True(t, Until(1).After(time.Now().Add(50*time.Second)))
+	Start(3, time.Hour)
+	assert.True(t, Until(3).Before(time.Now().Add(MaxCooldown+time.Second)))
+}
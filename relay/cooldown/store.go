@@ -0,0 +1,60 @@
+package cooldown
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// memoryStore keeps the cooldowns of this node only, it is used when redis is not enabled
+type memoryStore struct {
+	lock  sync.RWMutex
+	until map[int]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		until: make(map[int]time.Time),
+	}
+}
+
+func (s *memoryStore) get(channelId int) time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.until[channelId]
+}
+
+func (s *memoryStore) set(channelId int, until time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.until[channelId] = until
+}
+
+// redisStore shares the cooldowns between the nodes, a key lives as long as its cooldown
+type redisStore struct{}
+
+func redisKey(channelId int) string {
+	return "channel_cooldown:" + strconv.Itoa(channelId)
+}
+
+func (redisStore) get(channelId int) time.Time {
+	value, err := common.RedisGet(redisKey(channelId))
+	if err != nil {
+		return time.Time{}
+	}
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(until)
+}
+
+func (redisStore) set(channelId int, until time.Time) {
+	err := common.RedisSet(redisKey(channelId), strconv.FormatInt(until.UnixMilli(), 10), time.Until(until))
+	if err != nil {
+		logger.SysError("failed to set the cooldown of channel " + strconv.Itoa(channelId) + ": " + err.Error())
+	}
+}
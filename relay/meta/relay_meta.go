@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -35,6 +36,10 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
 	StartTime          time.Time
+	// BatchId is set when the request is executed for a batch of /v1/batches
+	BatchId string
+	// Hedge describes the race of a hedged request, it is empty when the request was not hedged
+	Hedge string
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -53,6 +58,7 @@ func GetByContext(c *gin.Context) *Meta {
 		RequestURLPath:     c.Request.URL.String(),
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
 		StartTime:          time.Now(),
+		BatchId:            helper.GetBatchID(c.Request.Context()),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
@@ -1,5 +1,10 @@
 package model
 
+import (
+	"encoding/base64"
+	"fmt"
+)
+
 type ImageRequest struct {
 	Model          string `json:"model"`
 	Prompt         string `json:"prompt" binding:"required"`
@@ -9,4 +14,19 @@ type ImageRequest struct {
 	ResponseFormat string `json:"response_format,omitempty"`
 	Style          string `json:"style,omitempty"`
 	User           string `json:"user,omitempty"`
+	// Image and Mask are the files uploaded to /v1/images/edits and /v1/images/variations
+	Image []*ImageFile `json:"-"`
+	Mask  *ImageFile   `json:"-"`
+}
+
+// ImageFile is an image uploaded in a multipart/form-data request
+type ImageFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// DataURL returns the image as a data URL, for the upstreams that take images inline
+func (f *ImageFile) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", f.ContentType, base64.StdEncoding.EncodeToString(f.Data))
 }
@@ -1,5 +1,7 @@
 package model
 
+import "strings"
+
 type Message struct {
 	Role             string  `json:"role,omitempty"`
 	Content          any     `json:"content,omitempty"`
@@ -72,6 +74,17 @@ func (m Message) ParseContent() []MessageContent {
 						},
 					})
 				}
+			case ContentTypeFile:
+				if subObj, ok := contentMap["file"].(map[string]any); ok {
+					file := &File{}
+					file.FileId, _ = subObj["file_id"].(string)
+					file.Filename, _ = subObj["filename"].(string)
+					file.FileData, _ = subObj["file_data"].(string)
+					contentList = append(contentList, MessageContent{
+						Type: ContentTypeFile,
+						File: file,
+					})
+				}
 			}
 		}
 		return contentList
@@ -84,8 +97,26 @@ type ImageURL struct {
 	Detail string `json:"detail,omitempty"`
 }
 
+// File is a file part of the message content, uploaded files are referenced by FileId
+// and resolved to FileData, a base64 data URL, before the request is converted.
+type File struct {
+	FileId   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
+// InlineData splits FileData into its mime type and base64 encoded content.
+func (f *File) InlineData() (mimeType string, data string, ok bool) {
+	header, data, found := strings.Cut(strings.TrimPrefix(f.FileData, "data:"), ",")
+	if !found || !strings.HasPrefix(f.FileData, "data:") || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
 type MessageContent struct {
 	Type     string    `json:"type,omitempty"`
 	Text     string    `json:"text"`
 	ImageURL *ImageURL `json:"image_url,omitempty"`
+	File     *File     `json:"file,omitempty"`
 }
@@ -0,0 +1,65 @@
+package model
+
+// RerankRequest is the request of /v1/rerank, compatible with Cohere, Jina and SiliconFlow
+type RerankRequest struct {
+	Model string `json:"model"`
+	Query string `json:"query"`
+	// Documents are either strings or objects with a text field
+	Documents       []any `json:"documents"`
+	TopN            int   `json:"top_n,omitempty"`
+	ReturnDocuments *bool `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int   `json:"max_chunks_per_doc,omitempty"`
+}
+
+// DocumentTexts returns the text of every document, in the order of the request
+func (r RerankRequest) DocumentTexts() []string {
+	texts := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		switch v := document.(type) {
+		case string:
+			texts = append(texts, v)
+		case map[string]any:
+			text, _ := v["text"].(string)
+			texts = append(texts, text)
+		default:
+			texts = append(texts, "")
+		}
+	}
+	return texts
+}
+
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+type RerankBilledUnits struct {
+	SearchUnits  int `json:"search_units,omitempty"`
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+}
+
+type RerankTokens struct {
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+}
+
+type RerankMeta struct {
+	BilledUnits *RerankBilledUnits `json:"billed_units,omitempty"`
+	Tokens      *RerankTokens      `json:"tokens,omitempty"`
+}
+
+// RerankResponse is the response of /v1/rerank, upstreams report their usage either
+// in usage (Jina) or in meta (Cohere, SiliconFlow)
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	Results []RerankResult `json:"results"`
+	Meta    *RerankMeta    `json:"meta,omitempty"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
@@ -0,0 +1,108 @@
+package modelpattern
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The models of a channel, of a token and the keys of a model mapping may be patterns: globs such as
+// gpt-4o-* where * matches any characters and ? a single one, or regular expressions between slashes
+// such as /^claude-3-(opus|sonnet)/. The wildcards of a glob and the groups of a regular expression are
+// captured, so that a model mapping can refer to them with $1, $2 and so on.
+
+var compiled sync.Map // pattern -> *regexp.Regexp, nil for the invalid ones
+
+// IsPattern tells whether the name is a glob or a regular expression rather than a model name
+func IsPattern(name string) bool {
+	if len(name) > 2 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+		return true
+	}
+	return strings.ContainsAny(name, "*?")
+}
+
+func compile(pattern string) *regexp.Regexp {
+	if re, ok := compiled.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	var expr string
+	if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	} else {
+		var builder strings.Builder
+		builder.WriteString("^")
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				builder.WriteString("(.*)")
+			case '?':
+				builder.WriteString("(.)")
+			default:
+				builder.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		builder.WriteString("$")
+		expr = builder.String()
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		re = nil
+	}
+	compiled.Store(pattern, re)
+	return re
+}
+
+// Match tells whether the model matches the pattern, a name that is not a pattern only matches itself
+func Match(pattern string, modelName string) bool {
+	if !IsPattern(pattern) {
+		return pattern == modelName
+	}
+	re := compile(pattern)
+	return re != nil && re.MatchString(modelName)
+}
+
+// InList tells whether the model matches one of the comma separated names or patterns
+func InList(modelName string, list string) bool {
+	for _, pattern := range strings.Split(list, ",") {
+		if Match(pattern, modelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Map resolves the model through the mapping. The model itself is looked up first, then the patterns are
+// tried from the longest one, which is usually the most specific.
+func Map(modelName string, mapping map[string]string) (string, bool) {
+	if mapping == nil {
+		return modelName, false
+	}
+	if mappedModelName := mapping[modelName]; mappedModelName != "" {
+		return mappedModelName, true
+	}
+	patterns := make([]string, 0)
+	for pattern, mappedModelName := range mapping {
+		if mappedModelName != "" && IsPattern(pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for _, pattern := range patterns {
+		re := compile(pattern)
+		if re == nil {
+			continue
+		}
+		match := re.FindStringSubmatchIndex(modelName)
+		if match == nil {
+			continue
+		}
+		return string(re.ExpandString(nil, mapping[pattern], modelName, match)), true
+	}
+	return modelName, false
+}
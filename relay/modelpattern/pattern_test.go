@@ -0,0 +1,45 @@
+package modelpattern
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("gpt-4o", "gpt-4o"))
+	assert.False(t, Match("gpt-4o", "gpt-4o-mini"))
+	assert.True(t, Match("gpt-4o-*", "gpt-4o-mini"))
+	assert.False(t, Match("gpt-4o-*", "gpt-4o"))
+	assert.True(t, Match("o?-mini", "o1-mini"))
+	assert.True(t, Match("openai/*", "openai/gpt-4o"))
+	assert.True(t, Match("/^claude-3-(opus|sonnet)/", "claude-3-opus-20240229"))
+	assert.False(t, Match("/^claude-3-(opus|sonnet)/", "claude-3-haiku-20240307"))
+	assert.False(t, Match("/[/", "["))
+	assert.True(t, InList("gpt-4o-mini", "claude-3-opus,gpt-4o-*"))
+	assert.False(t, InList("gpt-4", "claude-3-opus,gpt-4o-*"))
+}
+
+func TestMap(t *testing.T) {
+	mapping := map[string]string{
+		"gpt-4":                  "gpt-4-turbo",
+		"openai/*":               "$1",
+		"openai/gpt-4o-*":        "gpt-4o-$1-2024",
+		"/^claude-(.+)-latest$/": "claude-${1}-20240620",
+	}
+	mapped, ok := Map("gpt-4", mapping)
+	assert.True(t, ok)
+	assert.Equal(t, "gpt-4-turbo", mapped)
+
+	// the longest pattern wins
+	mapped, _ = Map("openai/gpt-4o-mini", mapping)
+	assert.Equal(t, "gpt-4o-mini-2024", mapped)
+	mapped, _ = Map("openai/o1", mapping)
+	assert.Equal(t, "o1", mapped)
+	mapped, _ = Map("claude-3-5-sonnet-latest", mapping)
+	assert.Equal(t, "claude-3-5-sonnet-20240620", mapped)
+
+	mapped, ok = Map("gemini-pro", mapping)
+	assert.False(t, ok)
+	assert.Equal(t, "gemini-pro", mapped)
+}
@@ -13,4 +13,20 @@ const (
 	AudioTranslation
 	// Proxy is a special relay mode for proxying requests to custom upstream
 	Proxy
+	// ClaudeMessages accepts Anthropic Messages requests and relays them to any channel
+	ClaudeMessages
+	// GeminiGenerateContent accepts Gemini generateContent requests and relays them to any channel
+	GeminiGenerateContent
+	// Responses accepts OpenAI Responses requests, translated to chat completions for non-OpenAI channels
+	Responses
+	ImagesEdits
+	ImagesVariations
+	// Rerank accepts Cohere compatible rerank requests
+	Rerank
+	// Realtime relays the websocket sessions of the OpenAI Realtime API
+	Realtime
+	// FineTuning passes the fine-tuning jobs through to the OpenAI and Azure channels
+	FineTuning
+	// Ollama accepts Ollama chat and generate requests and relays them to any channel
+	Ollama
 )
@@ -16,6 +16,10 @@ func GetByPath(path string) int {
 		relayMode = Moderations
 	} else if strings.HasPrefix(path, "/v1/images/generations") {
 		relayMode = ImagesGenerations
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = ImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = ImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = Edits
 	} else if strings.HasPrefix(path, "/v1/audio/speech") {
@@ -26,6 +30,20 @@ func GetByPath(path string) int {
 		relayMode = AudioTranslation
 	} else if strings.HasPrefix(path, "/v1/oneapi/proxy") {
 		relayMode = Proxy
+	} else if strings.HasPrefix(path, "/v1/messages") {
+		relayMode = ClaudeMessages
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		relayMode = GeminiGenerateContent
+	} else if strings.HasPrefix(path, "/v1/responses") {
+		relayMode = Responses
+	} else if strings.HasPrefix(path, "/v1/rerank") {
+		relayMode = Rerank
+	} else if strings.HasPrefix(path, "/v1/realtime") {
+		relayMode = Realtime
+	} else if strings.HasPrefix(path, "/v1/fine_tuning") {
+		relayMode = FineTuning
+	} else if strings.HasPrefix(path, "/api/chat") || strings.HasPrefix(path, "/api/generate") {
+		relayMode = Ollama
 	}
 	return relayMode
 }
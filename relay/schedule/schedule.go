@@ -0,0 +1,183 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A schedule is a list of weekly time ranges separated by semicolons, such as "mon-fri 22:00-08:00; sat,sun 00:00-24:00".
+// The days are optional, a range without days applies to every day. A range whose end is not after its
+// start runs past midnight, into the next day.
+
+// MaxLookAhead bounds the search of the next change of a schedule
+const MaxLookAhead = 8 * 24 * time.Hour
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type timeRange struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+}
+
+type Schedule []timeRange
+
+var parsed sync.Map    // spec -> Schedule
+var locations sync.Map // name -> *time.Location
+
+func parseClock(clock string) (int, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(clock), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	h, err := strconv.Atoi(hour)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	m, err := strconv.Atoi(minute)
+	if err != nil || h < 0 || m < 0 || m > 59 || h > 24 || h == 24 && m != 0 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	return h*60 + m, nil
+}
+
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(part)), "-")
+		first, ok := dayNames[from]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return days, fmt.Errorf("invalid day %q", to)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// Parse parses the schedule, an empty one is always open
+func Parse(spec string) (Schedule, error) {
+	if cached, ok := parsed.Load(spec); ok {
+		return cached.(Schedule), nil
+	}
+	var schedule Schedule
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		r := timeRange{days: [7]bool{true, true, true, true, true, true, true}}
+		clocks := entry
+		if days, rest, ok := strings.Cut(entry, " "); ok {
+			var err error
+			if r.days, err = parseDays(days); err != nil {
+				return nil, err
+			}
+			clocks = rest
+		}
+		start, end, ok := strings.Cut(clocks, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time range %q", clocks)
+		}
+		var err error
+		if r.start, err = parseClock(start); err != nil {
+			return nil, err
+		}
+		if r.end, err = parseClock(end); err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, r)
+	}
+	parsed.Store(spec, schedule)
+	return schedule, nil
+}
+
+// Contains tells whether the schedule is open at t, in the location of t
+func (s Schedule) Contains(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	yesterday := (day + 6) % 7
+	for _, r := range s {
+		if r.start < r.end {
+			if r.days[day] && minute >= r.start && minute < r.end {
+				return true
+			}
+			continue
+		}
+		// the range runs past midnight
+		if r.days[day] && minute >= r.start || r.days[yesterday] && minute < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange returns the first minute after t at which the schedule opens or closes, the zero time if it never does
+func (s Schedule) NextChange(t time.Time) time.Time {
+	open := s.Contains(t)
+	next := t.Truncate(time.Minute)
+	for end := t.Add(MaxLookAhead); next.Before(end); {
+		next = next.Add(time.Minute)
+		if s.Contains(next) != open {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// Location loads the time zone, the empty name being the local one
+func Location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// PeriodStart returns the last daily reset at or before t, the reset time being a clock such as "08:00" in the
+// location of t. The empty reset time is midnight.
+func PeriodStart(t time.Time, resetTime string) (time.Time, error) {
+	minutes := 0
+	if resetTime != "" {
+		var err error
+		if minutes, err = parseClock(resetTime); err != nil {
+			return time.Time{}, err
+		}
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), minutes/60, minutes%60, 0, 0, t.Location())
+	if start.After(t) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, nil
+}
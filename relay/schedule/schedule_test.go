@@ -0,0 +1,45 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	schedule, err := Parse("mon-fri 22:00-08:00; sat,sun 00:00-24:00")
+	assert.NoError(t, err)
+	// 2024-07-01 is a monday
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 7, day, hour, minute, 0, 0, time.UTC)
+	}
+	assert.False(t, schedule.Contains(at(1, 12, 0)))
+	assert.True(t, schedule.Contains(at(1, 22, 0)))
+	assert.True(t, schedule.Contains(at(2, 7, 59)))
+	assert.False(t, schedule.Contains(at(2, 8, 0)))
+	assert.True(t, schedule.Contains(at(6, 12, 0)))
+	// the friday night runs into the weekend, and the sunday ends at midnight
+	assert.True(t, schedule.Contains(at(6, 3, 0)))
+	assert.False(t, schedule.Contains(at(8, 12, 0)))
+	assert.Equal(t, at(1, 22, 0), schedule.NextChange(at(1, 12, 30)))
+
+	always, err := Parse("")
+	assert.NoError(t, err)
+	assert.True(t, always.Contains(at(1, 12, 0)))
+	assert.True(t, always.NextChange(at(1, 12, 0)).IsZero())
+
+	_, err = Parse("mon-fri 25:00-08:00")
+	assert.Error(t, err)
+	_, err = Parse("someday 10:00-12:00")
+	assert.Error(t, err)
+}
+
+func TestPeriodStart(t *testing.T) {
+	start, err := PeriodStart(time.Date(2024, 7, 1, 7, 0, 0, 0, time.UTC), "08:00")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 30, 8, 0, 0, 0, time.UTC), start)
+	start, err = PeriodStart(time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC), "")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), start)
+}
@@ -74,6 +74,12 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ListAllModels)
+			channelRoute.GET("/traffic", controller.GetChannelTrafficShares)
+			channelRoute.GET("/keys/:id", controller.GetChannelKeys)
+			channelRoute.PUT("/keys/:id", controller.UpdateChannelKeyStatus)
+			channelRoute.GET("/abilities/:id", controller.GetChannelAbilities)
+			channelRoute.PUT("/abilities/:id", controller.UpdateChannelAbilityStatus)
+			channelRoute.GET("/probes/:id", controller.GetChannelProbes)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
@@ -108,6 +114,7 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/margin", middleware.AdminAuth(), controller.GetLogsMargin)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
@@ -17,6 +17,69 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("", controller.ListModels)
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
+	responsesRouter := router.Group("/v1/responses")
+	responsesRouter.Use(middleware.TokenAuth())
+	{
+		responsesRouter.GET("/:id", controller.RetrieveResponse)
+		responsesRouter.DELETE("/:id", controller.DeleteResponse)
+	}
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(middleware.TokenAuth())
+	{
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.GET("/:id", controller.RetrieveFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id/content", controller.RetrieveFileContent)
+	}
+	batchesRouter := router.Group("/v1/batches")
+	batchesRouter.Use(middleware.TokenAuth())
+	{
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("/:id", controller.RetrieveBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
+	assistantsRouter := router.Group("/v1/assistants")
+	assistantsRouter.Use(middleware.TokenAuth())
+	{
+		assistantsRouter.GET("", controller.ListAssistants)
+		assistantsRouter.POST("", controller.CreateAssistant)
+		assistantsRouter.GET("/:id", controller.RetrieveAssistant)
+		assistantsRouter.POST("/:id", controller.ModifyAssistant)
+		assistantsRouter.DELETE("/:id", controller.DeleteAssistant)
+	}
+	threadsRouter := router.Group("/v1/threads")
+	threadsRouter.Use(middleware.TokenAuth())
+	{
+		threadsRouter.POST("", controller.CreateThread)
+		threadsRouter.POST("/runs", controller.CreateThreadAndRun)
+		threadsRouter.GET("/:id", controller.RetrieveThread)
+		threadsRouter.POST("/:id", controller.ModifyThread)
+		threadsRouter.DELETE("/:id", controller.DeleteThread)
+		threadsRouter.GET("/:id/messages", controller.ListThreadMessages)
+		threadsRouter.POST("/:id/messages", controller.CreateThreadMessage)
+		threadsRouter.GET("/:id/messages/:messageId", controller.RetrieveThreadMessage)
+		threadsRouter.POST("/:id/messages/:messageId", controller.ModifyThreadMessage)
+		threadsRouter.GET("/:id/runs", controller.ListRuns)
+		threadsRouter.POST("/:id/runs", controller.CreateRun)
+		threadsRouter.GET("/:id/runs/:runId", controller.RetrieveRun)
+		threadsRouter.POST("/:id/runs/:runId", controller.ModifyRun)
+		threadsRouter.POST("/:id/runs/:runId/submit_tool_outputs", controller.SubmitToolOutputs)
+		threadsRouter.POST("/:id/runs/:runId/cancel", controller.CancelRun)
+		threadsRouter.GET("/:id/runs/:runId/steps", controller.ListRunSteps)
+		threadsRouter.GET("/:id/runs/:runId/steps/:stepId", controller.RetrieveRunStep)
+	}
+	fineTuningRouter := router.Group("/v1/fine_tuning/jobs")
+	fineTuningRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth())
+	{
+		fineTuningRouter.GET("", controller.ListFineTuningJobs)
+		fineTuningRouter.POST("", middleware.Distribute(), controller.CreateFineTuningJob)
+		fineTuningRouter.GET("/:id", controller.RetrieveFineTuningJob)
+		fineTuningRouter.POST("/:id/cancel", controller.CancelFineTuningJob)
+		fineTuningRouter.GET("/:id/events", controller.ListFineTuningJobEvents)
+		fineTuningRouter.GET("/:id/checkpoints", controller.ListFineTuningJobEvents)
+	}
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
 	{
@@ -25,50 +88,34 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/chat/completions", controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
-		relayV1Router.POST("/images/edits", controller.RelayNotImplemented)
-		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
+		relayV1Router.POST("/images/edits", controller.Relay)
+		relayV1Router.POST("/images/variations", controller.Relay)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
-		relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
-		relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
-		relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/fine_tuning/jobs/:id/cancel", controller.RelayNotImplemented)
-		relayV1Router.GET("/fine_tuning/jobs/:id/events", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/models/:model", controller.RelayNotImplemented)
 		relayV1Router.POST("/moderations", controller.Relay)
-		relayV1Router.POST("/assistants", controller.RelayNotImplemented)
-		relayV1Router.GET("/assistants/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/assistants/:id", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/assistants/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/assistants", controller.RelayNotImplemented)
-		relayV1Router.POST("/assistants/:id/files", controller.RelayNotImplemented)
-		relayV1Router.GET("/assistants/:id/files/:fileId", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/assistants/:id/files/:fileId", controller.RelayNotImplemented)
-		relayV1Router.GET("/assistants/:id/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/threads/:id", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/messages", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/messages/:messageId", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/messages/:messageId", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/messages/:messageId/files/:filesId", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/messages/:messageId/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs/:runsId", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs/:runsId", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs/:runsId/submit_tool_outputs", controller.RelayNotImplemented)
-		relayV1Router.POST("/threads/:id/runs/:runsId/cancel", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs/:runsId/steps/:stepId", controller.RelayNotImplemented)
-		relayV1Router.GET("/threads/:id/runs/:runsId/steps", controller.RelayNotImplemented)
+		relayV1Router.POST("/rerank", controller.Relay)
+		// https://platform.openai.com/docs/guides/realtime
+		relayV1Router.GET("/realtime", controller.Relay)
+		// https://docs.anthropic.com/en/api/messages
+		relayV1Router.POST("/messages", controller.Relay)
+		relayV1Router.POST("/responses", controller.Relay)
+	}
+	// https://github.com/ollama/ollama/blob/main/docs/api.md
+	ollamaRouter := router.Group("/api")
+	ollamaRouter.Use(middleware.RelayPanicRecover(), middleware.JSONBody(), middleware.TokenAuth())
+	{
+		ollamaRouter.GET("/tags", controller.ListOllamaModels)
+		ollamaRouter.POST("/chat", middleware.Distribute(), controller.Relay)
+		ollamaRouter.POST("/generate", middleware.Distribute(), controller.Relay)
+	}
+	// https://ai.google.dev/api/generate-content
+	relayV1BetaRouter := router.Group("/v1beta")
+	relayV1BetaRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
+	{
+		relayV1BetaRouter.POST("/models/:model", controller.Relay)
 	}
 }